@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	pb "ZFS/grpc"
+	"ZFS/logger"
+	"ZFS/storage"
+	"ZFS/utils"
+	"context"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// aclReloadInterval 检查 acl 文件是否变化的间隔
+const aclReloadInterval = 2 * time.Second
+
+// accessControl 根据 acl 文件中的规则树检查每个 FileServer 请求，文件变化时自动重新加载。
+// 规则同时作用于请求中的路径和存储展开符号链接之后的实际位置，
+// 经由 pub -> secret 这样的链接访问时同样受 secret 的规则约束
+type accessControl struct {
+	filename string
+	stor     storage.Storage // 用于解析实际位置，nil时只按请求中的路径检查
+	root     atomic.Pointer[utils.ZFSNode]
+	modTime  time.Time
+	size     int64
+}
+
+func newAccessControl(filename string, root *utils.ZFSNode, stor storage.Storage) *accessControl {
+	a := &accessControl{filename: filename, stor: stor}
+	a.root.Store(root)
+	if info, err := os.Stat(filename); err == nil {
+		a.modTime, a.size = info.ModTime(), info.Size()
+	}
+	return a
+}
+
+// reload 在 acl 文件发生变化时重新加载规则，返回是否重新加载。加载失败时保留原有规则
+func (a *accessControl) reload() (bool, error) {
+	info, err := os.Stat(a.filename)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(a.modTime) && info.Size() == a.size {
+		return false, nil
+	}
+	a.modTime, a.size = info.ModTime(), info.Size()
+	root, err := utils.LoadACL(a.filename)
+	if err != nil {
+		return false, err
+	}
+	a.root.Store(root)
+	return true, nil
+}
+
+// watch 定期检查 acl 文件，直到 ctx 结束
+func (a *accessControl) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := a.reload()
+			if err != nil {
+				logger.Log.Error("重新加载acl文件失败，继续使用原有规则", zap.Error(err))
+			} else if reloaded {
+				logger.Log.Info("acl文件已重新加载", zap.String("file", a.filename))
+			}
+		}
+	}
+}
+
+// aclCheck 一次请求需要通过的一项检查
+type aclCheck struct {
+	path string
+	op   string
+}
+
+// aclChecks 列出请求需要的权限，不涉及路径的消息（如上传的数据分块）返回空列表。
+// 没有在这里声明的消息类型返回 false 并一律拒绝，新增的RPC必须先声明所需的权限
+func aclChecks(req any) ([]aclCheck, bool) {
+	switch r := req.(type) {
+	case *pb.ListDirectoryRequest:
+		return []aclCheck{{r.GetDirectoryPath(), utils.ACLList}}, true
+	case *pb.StatRequest:
+		return []aclCheck{{r.GetPath(), utils.ACLList}}, true
+	case *pb.WatchDirectoryRequest:
+		return []aclCheck{{r.GetDirectoryPath(), utils.ACLList}}, true
+	case *pb.FindRequest:
+		return []aclCheck{{r.GetDirectoryPath(), utils.ACLList}}, true
+	case *pb.UsageRequest:
+		return []aclCheck{{r.GetPath(), utils.ACLList}}, true
+	case *pb.DownloadFileRequest:
+		return []aclCheck{{r.GetFilePath(), utils.ACLRead}}, true
+	case *pb.ChecksumRequest:
+		return []aclCheck{{r.GetFilePath(), utils.ACLRead}}, true
+	case *pb.UploadFileRequest:
+		if info := r.GetInfo(); info != nil {
+			return []aclCheck{{info.GetFilePath(), utils.ACLWrite}}, true
+		}
+		return nil, true
+	case *pb.MakeDirectoryRequest:
+		return []aclCheck{{r.GetDirectoryPath(), utils.ACLWrite}}, true
+	case *pb.DeleteFileRequest:
+		return []aclCheck{{r.GetFilePath(), utils.ACLDelete}}, true
+	case *pb.RenameRequest:
+		return []aclCheck{
+			{r.GetFilePath(), utils.ACLDelete},
+			{renameTarget(r.GetFilePath(), r.GetNewName()), utils.ACLWrite},
+		}, true
+	case *pb.MoveRequest:
+		return []aclCheck{{r.GetSourcePath(), utils.ACLDelete}, {r.GetDestinationPath(), utils.ACLWrite}}, true
+	case *pb.CopyFromRequest:
+		// 读取源文件的权限由源节点检查，本节点和调用方（通过 onBehalfOf 传递）都需要有权读取
+		return []aclCheck{{r.GetDestinationPath(), utils.ACLWrite}}, true
+	case *pb.CapacityRequest:
+		// 整个节点的信息，需要有权查看存储根目录
+		return []aclCheck{{"", utils.ACLList}}, true
+	case *pb.LimitsRequest:
+		// 包含所有调用方的身份和流量，只对管理员开放
+		return []aclCheck{{"", utils.ACLAdmin}}, true
+	case *pb.GetNodeInfoRequest:
+		// 建立连接时用于功能协商，不涉及存储内容
+		return nil, true
+	}
+	return nil, false
+}
+
+// allows 调用方是否有权对path执行op，用于逐项过滤 Find 和 WatchDirectory 的结果；
+// 没有访问控制时总是允许
+func (a *accessControl) allows(ctx context.Context, path, op string) bool {
+	if a == nil {
+		return true
+	}
+	root := a.root.Load()
+	if root == nil {
+		return true
+	}
+	for _, identity := range callerIdentities(ctx) {
+		if allowed, err := a.permitted(root, path, identity, op); !allowed || err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// renameTarget 返回重命名后的路径，与存储层一样先规范化再取上级目录。
+// 路径不合法时原样返回，对原路径的检查会拒绝该请求
+func renameTarget(p, newName string) string {
+	clean, err := storage.CleanPath(p)
+	if err != nil {
+		return p
+	}
+	return path.Join(path.Dir(clean), newName)
+}
+
+// onBehalfOfMetadataKey 节点代替调用方向其他节点发起请求（如 CopyFrom 拉取源文件）时，
+// 在该元数据中携带原调用方的身份
+const onBehalfOfMetadataKey = "zfs-on-behalf-of"
+
+// onBehalfOf 在发往其他节点的请求中附带当前调用方的身份
+func onBehalfOf(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, onBehalfOfMetadataKey, peerIdentity(ctx))
+}
+
+// callerIdentities 返回需要检查权限的全部身份：直接的调用方，以及它代替的原调用方。
+// 代替他人发起的请求必须两者都有权限，节点不能借此替调用方访问调用方自己无权访问的内容；
+// 元数据由调用方自行填写，只会增加限制，不会扩大权限
+func callerIdentities(ctx context.Context) []string {
+	identities := []string{peerIdentity(ctx)}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(onBehalfOfMetadataKey); len(values) > 0 {
+		identities = append(identities, values[0])
+	}
+	return identities
+}
+
+// permitted 按请求中的路径和实际位置检查，两者都允许时才允许。
+// 删除和作为移动来源时操作作用于条目本身，不展开最后一部分的符号链接
+func (a *accessControl) permitted(root *utils.ZFSNode, p, identity, op string) (bool, error) {
+	clean, err := storage.CleanPath(p)
+	if err != nil {
+		return false, err
+	}
+	if !root.Allowed(clean, identity, op) {
+		return false, nil
+	}
+	if a.stor == nil {
+		return true, nil
+	}
+	real, err := a.stor.RealPath(clean, op != utils.ACLDelete)
+	if err != nil {
+		return false, err
+	}
+	return real == clean || root.Allowed(real, identity, op), nil
+}
+
+// check 检查调用方是否有权执行请求，拒绝时返回 PermissionDenied
+func (a *accessControl) check(ctx context.Context, req any) error {
+	root := a.root.Load()
+	if root == nil {
+		return nil
+	}
+	checks, ok := aclChecks(req)
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "权限不足：请求 %T 没有声明访问权限", req)
+	}
+	for _, identity := range callerIdentities(ctx) {
+		for _, c := range checks {
+			// 按规范化之后的路径检查，避免 a\b 绕过针对 a/b 的规则；分解形式的文件名由 Allowed 处理
+			allowed, err := a.permitted(root, c.path, identity, c.op)
+			if err != nil {
+				return toStatusError(err)
+			}
+			if !allowed {
+				if identity == "" {
+					identity = "匿名调用方"
+				}
+				return status.Errorf(codes.PermissionDenied, "权限不足：%s 不允许对 %s 执行 %s", identity, c.path, c.op)
+			}
+		}
+	}
+	return nil
+}
+
+// isFileServiceMethod 访问控制只作用于 FileService，健康检查和反射服务不涉及存储内容
+func isFileServiceMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+pb.FileService_ServiceDesc.ServiceName+"/")
+}
+
+func (a *accessControl) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !isFileServiceMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	if err := a.check(ctx, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor 流式请求的路径在消息中，因此在每次接收消息时检查
+func (a *accessControl) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !isFileServiceMethod(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	return handler(srv, &aclServerStream{ServerStream: ss, acl: a})
+}
+
+type aclServerStream struct {
+	grpc.ServerStream
+	acl *accessControl
+}
+
+func (s *aclServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.acl.check(s.Context(), m)
+}
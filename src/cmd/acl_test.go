@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"ZFS/utils"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "ZFS/grpc"
+)
+
+// identityContext 模拟通过mTLS认证、证书CN为 identity 的调用方
+func identityContext(identity string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: identity}}
+	info := credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info})
+}
+
+func TestAccessControlCheck(t *testing.T) {
+	aclFile := filepath.Join(t.TempDir(), "acl.yaml")
+	rules := "name: root\nrules:\n- peers: [\"*\"]\n  allow: [list, read]\n- peers: [node1]\n  allow: [\"*\"]\n"
+	if err := os.WriteFile(aclFile, []byte(rules), 0644); err != nil {
+		t.Fatalf("写入acl文件失败: %v", err)
+	}
+	root, err := utils.LoadACL(aclFile)
+	if err != nil {
+		t.Fatalf("加载acl文件失败: %v", err)
+	}
+	acl := newAccessControl(aclFile, root, nil)
+
+	tests := []struct {
+		identity string
+		req      any
+		allowed  bool
+	}{
+		{"node2", &pb.ListDirectoryRequest{DirectoryPath: "."}, true},
+		{"node2", &pb.DownloadFileRequest{FilePath: "a.txt"}, true},
+		{"node2", &pb.DeleteFileRequest{FilePath: "a.txt"}, false},
+		{"node2", &pb.MoveRequest{SourcePath: "a.txt", DestinationPath: "b"}, false},
+		{"node1", &pb.MoveRequest{SourcePath: "a.txt", DestinationPath: "b"}, true},
+		{"", &pb.UploadFileRequest{Data: &pb.UploadFileRequest_Info{Info: &pb.UploadFileInfo{FilePath: "a.txt"}}}, false},
+		{"", &pb.UploadFileRequest{Data: &pb.UploadFileRequest_Chunk{Chunk: &pb.FileChunk{}}}, true},
+		{"node2", &pb.GetNodeInfoRequest{}, true},
+		{"node2", &pb.CapacityRequest{}, true},
+		// 限速状态包含所有调用方的身份，只有管理员可以查看
+		{"node2", &pb.LimitsRequest{}, false},
+		{"node1", &pb.LimitsRequest{}, true},
+		// 没有声明权限的消息类型一律拒绝，即使调用方拥有全部权限
+		{"node1", &pb.FileChunk{}, false},
+	}
+	for _, tt := range tests {
+		err := acl.check(identityContext(tt.identity), tt.req)
+		if tt.allowed && err != nil {
+			t.Errorf("%s %T 应当被允许: %v", tt.identity, tt.req, err)
+		}
+		if !tt.allowed && status.Code(err) != codes.PermissionDenied {
+			t.Errorf("%s %T 应当返回 PermissionDenied，实际: %v", tt.identity, tt.req, err)
+		}
+	}
+
+	// 修改 acl 文件后重新加载，新的规则立即生效
+	time.Sleep(10 * time.Millisecond)
+	rules += "- peers: [node2]\n  allow: [delete]\n"
+	if err := os.WriteFile(aclFile, []byte(rules), 0644); err != nil {
+		t.Fatalf("写入acl文件失败: %v", err)
+	}
+	if reloaded, err := acl.reload(); !reloaded || err != nil {
+		t.Fatalf("重新加载acl文件失败: %v, %v", reloaded, err)
+	}
+	if err := acl.check(identityContext("node2"), &pb.DeleteFileRequest{FilePath: "a.txt"}); err != nil {
+		t.Errorf("重新加载后应当允许删除: %v", err)
+	}
+	if reloaded, _ := acl.reload(); reloaded {
+		t.Error("文件没有变化时不应重新加载")
+	}
+
+	// 新规则不合法时保留原有规则
+	time.Sleep(10 * time.Millisecond)
+	if err := os.WriteFile(aclFile, []byte("name: root\nrules:\n- peers: [\"*\"]\n  allow: [everything]\n"), 0644); err != nil {
+		t.Fatalf("写入acl文件失败: %v", err)
+	}
+	if _, err := acl.reload(); err == nil {
+		t.Error("不合法的acl文件应当加载失败")
+	}
+	if err := acl.check(identityContext("node2"), &pb.DeleteFileRequest{FilePath: "a.txt"}); err != nil {
+		t.Errorf("加载失败后应当保留原有规则: %v", err)
+	}
+}
+
+func TestAccessControlNormalizesPaths(t *testing.T) {
+	aclFile := filepath.Join(t.TempDir(), "acl.yaml")
+	rules := "name: root\nrules:\n- peers: [\"*\"]\n  allow: [list, read]\nchildren:\n- name: secret\n  rules:\n  - peers: [\"*\"]\n    deny: [read]\n- name: caf\u00e9\n  rules:\n  - peers: [\"*\"]\n    deny: [read]\n"
+	if err := os.WriteFile(aclFile, []byte(rules), 0644); err != nil {
+		t.Fatalf("写入acl文件失败: %v", err)
+	}
+	root, err := utils.LoadACL(aclFile)
+	if err != nil {
+		t.Fatalf("加载acl文件失败: %v", err)
+	}
+	acl := newAccessControl(aclFile, root, nil)
+
+	tests := []struct {
+		path string
+		code codes.Code
+	}{
+		{"docs/a.txt", codes.OK},
+		{"secret/a.txt", codes.PermissionDenied},
+		{`secret\a.txt`, codes.PermissionDenied},
+		{"caf\u0065\u0301/a.txt", codes.PermissionDenied},
+		{"docs/../secret/a.txt", codes.PermissionDenied},
+		{"../secret/a.txt", codes.PermissionDenied},
+		{"secret\x00/a.txt", codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		err := acl.check(context.Background(), &pb.DownloadFileRequest{FilePath: tt.path})
+		if status.Code(err) != tt.code {
+			t.Errorf("%q 应当返回 %v，实际: %v", tt.path, tt.code, err)
+		}
+	}
+}
+
+// 重命名的目标与存储层一样按规范化后的路径计算，不能借反斜杠或 .. 把目标算到别的目录
+func TestAccessControlRenameTarget(t *testing.T) {
+	acl := newAccessControl(filepath.Join(t.TempDir(), "acl.yaml"), &utils.ZFSNode{
+		Name:     "root",
+		Rules:    []utils.ACLRule{{Peers: []string{"*"}, Allow: []string{utils.ACLList, utils.ACLRead}}},
+		Children: []*utils.ZFSNode{{Name: "docs", Rules: []utils.ACLRule{{Peers: []string{"*"}, Allow: []string{utils.ACLDelete, utils.ACLWrite}}}}},
+	}, nil)
+	for _, p := range []string{"docs/a.txt", `docs\a.txt`, "docs/sub/../a.txt"} {
+		if err := acl.check(identityContext("node2"), &pb.RenameRequest{FilePath: p, NewName: "b.txt"}); err != nil {
+			t.Errorf("在 docs 内重命名 %q 应当被允许: %v", p, err)
+		}
+	}
+	if err := acl.check(identityContext("node2"), &pb.RenameRequest{FilePath: "a.txt", NewName: "b.txt"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("在根目录重命名应当被拒绝，实际: %v", err)
+	}
+}
+
+// 节点代替调用方从源节点拉取文件时，源节点同时按节点和原调用方的身份检查
+func TestAccessControlOnBehalfOf(t *testing.T) {
+	acl := newAccessControl(filepath.Join(t.TempDir(), "acl.yaml"), &utils.ZFSNode{
+		Name:     "root",
+		Rules:    []utils.ACLRule{{Peers: []string{"node2", "alice"}, Allow: []string{utils.ACLRead}}},
+		Children: []*utils.ZFSNode{{Name: "secret", Rules: []utils.ACLRule{{Peers: []string{"alice"}, Deny: []string{utils.ACLRead}}}}},
+	}, nil)
+	req := &pb.DownloadFileRequest{FilePath: "secret/a.txt"}
+	if err := acl.check(identityContext("node2"), req); err != nil {
+		t.Errorf("node2 自己读取应当被允许: %v", err)
+	}
+
+	// 目标节点发起的请求中携带原调用方的身份
+	outgoing := onBehalfOf(identityContext("alice"))
+	md, _ := metadata.FromOutgoingContext(outgoing)
+	delegated := metadata.NewIncomingContext(identityContext("node2"), md)
+	if err := acl.check(delegated, req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("代替 alice 读取 secret 应当被拒绝，实际: %v", err)
+	}
+	if err := acl.check(delegated, &pb.DownloadFileRequest{FilePath: "public/a.txt"}); err != nil {
+		t.Errorf("代替 alice 读取 public 应当被允许: %v", err)
+	}
+	if acl.allows(delegated, "secret/a.txt", utils.ACLRead) {
+		t.Error("逐项过滤时同样应当按原调用方的身份检查")
+	}
+}
+
+func TestAccessControlInterceptor(t *testing.T) {
+	storageRoot := t.TempDir()
+	os.WriteFile(filepath.Join(storageRoot, "public.txt"), []byte("public"), 0644)
+	os.WriteFile(filepath.Join(storageRoot, "secret.txt"), []byte("secret"), 0644)
+	root := &utils.ZFSNode{
+		Name:     "root",
+		Rules:    []utils.ACLRule{{Peers: []string{"*"}, Allow: []string{utils.ACLList, utils.ACLRead}}},
+		Children: []*utils.ZFSNode{{Name: "secret.txt", Rules: []utils.ACLRule{{Peers: []string{"*"}, Deny: []string{utils.ACLRead}}}}},
+	}
+	server := newTestFileServer(t, storageRoot)
+	acl := newAccessControl(filepath.Join(t.TempDir(), "acl.yaml"), root, server.storage)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听端口失败: %v", err)
+	}
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(acl.unaryInterceptor), grpc.ChainStreamInterceptor(acl.streamInterceptor))
+	pb.RegisterFileServiceServer(grpcServer, server)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	conn, err := GetConn("node1", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("建立grpc连接失败: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewFileServiceClient(conn)
+	ctx := context.Background()
+
+	if _, err := client.ListDirectory(ctx, &pb.ListDirectoryRequest{DirectoryPath: "."}); err != nil {
+		t.Errorf("列出目录应当被允许: %v", err)
+	}
+	if _, err := client.MakeDirectory(ctx, &pb.MakeDirectoryRequest{DirectoryPath: "new"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("创建目录应当被拒绝，实际: %v", err)
+	}
+	download := func(name string) error {
+		stream, err := client.DownloadFile(ctx, &pb.DownloadFileRequest{FilePath: name})
+		if err != nil {
+			return err
+		}
+		for {
+			if _, err := stream.Recv(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	if err := download("public.txt"); err != nil {
+		t.Errorf("下载 public.txt 应当被允许: %v", err)
+	}
+	if err := download("secret.txt"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("下载 secret.txt 应当被拒绝，实际: %v", err)
+	}
+	// 经由符号链接访问时同样按链接的目标检查
+	if err := os.Symlink("secret.txt", filepath.Join(storageRoot, "link.txt")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+	if err := download("link.txt"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("经由链接下载 secret.txt 应当被拒绝，实际: %v", err)
+	}
+
+	stream, err := client.UploadFile(ctx)
+	if err != nil {
+		t.Fatalf("UploadFile 调用失败: %v", err)
+	}
+	stream.Send(&pb.UploadFileRequest{Data: &pb.UploadFileRequest_Info{Info: &pb.UploadFileInfo{FilePath: "upload.txt"}}})
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("上传应当被拒绝，实际: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(storageRoot, "upload.txt")); !os.IsNotExist(err) {
+		t.Error("被拒绝的上传不应创建文件")
+	}
+}
@@ -0,0 +1,399 @@
+package cmd
+
+import (
+	pb "ZFS/grpc"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// followInterval follow 模式下检查文件是否有追加内容的间隔
+const followInterval = time.Second
+
+// rangeChunkSize head 和 tail 每次按范围读取的字节数
+const rangeChunkSize = 64 << 10
+
+// binarySampleSize 判断内容是否为二进制时检查的字节数
+const binarySampleSize = 8 << 10
+
+// defaultLines head 和 tail 默认显示的行数
+const defaultLines = 10
+
+// errBinary 文件内容不是文本，直接输出会扰乱终端
+var errBinary = errors.New("文件包含二进制内容，请使用 get 下载")
+
+// followTailSize follow 模式下记录的已发送内容末尾的字节数，文件变化时据此判断是追加还是被替换
+const followTailSize = 64
+
+// follow 从offset开始持续发送文件追加的内容，直到ctx取消；文件被删除时返回错误。
+// 文件变小、修改时间回退或已发送内容的末尾发生变化时视为被截断或替换（例如日志轮转），从头发送
+func (s *FileServer) follow(ctx context.Context, filePath string, offset int64, out *chunkWriter) error {
+	tail, err := s.readTail(ctx, filePath, offset)
+	if err != nil {
+		return err
+	}
+	var modTime time.Time
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		info, err := s.storage.Stat(ctx, filePath)
+		if err != nil {
+			return err
+		}
+		if info.Size == offset && info.ModTime.Equal(modTime) {
+			continue
+		}
+		replaced := info.Size < offset || info.ModTime.Before(modTime)
+		if !replaced && len(tail) > 0 {
+			current, err := s.readTail(ctx, filePath, offset)
+			if err != nil {
+				return err
+			}
+			replaced = !bytes.Equal(current, tail)
+		}
+		modTime = info.ModTime
+		if replaced {
+			offset, tail = 0, nil
+		}
+		if info.Size == offset {
+			continue
+		}
+		reader, err := s.storage.DownloadFile(ctx, filePath, offset, info.Size-offset)
+		if err != nil {
+			return err
+		}
+		recorder := tailBuffer(tail)
+		n, err := io.Copy(io.MultiWriter(out, &recorder), readerOnly{reader})
+		reader.Close()
+		offset, tail = offset+n, recorder
+		if err != nil {
+			return err
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// readTail 读取文件中offset之前的最后 followTailSize 个字节
+func (s *FileServer) readTail(ctx context.Context, filePath string, offset int64) ([]byte, error) {
+	n := min(offset, followTailSize)
+	if n == 0 {
+		return nil, nil
+	}
+	reader, err := s.storage.DownloadFile(ctx, filePath, offset-n, n)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// tailBuffer 只保留写入内容的最后 followTailSize 个字节
+type tailBuffer []byte
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	b := append(*t, p...)
+	if len(b) > followTailSize {
+		b = append([]byte(nil), b[len(b)-followTailSize:]...)
+	}
+	*t = b
+	return len(p), nil
+}
+
+// isBinary 样本中出现NUL字节或不是合法的UTF-8时视为二进制内容；
+// 样本末尾可能截断了一个多字节字符，不算作不合法
+func isBinary(sample []byte) bool {
+	if len(sample) > binarySampleSize {
+		sample = sample[:binarySampleSize]
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+	for i := len(sample) - 1; i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(sample[i]) {
+			if !utf8.FullRune(sample[i:]) {
+				sample = sample[:i]
+			}
+			break
+		}
+	}
+	return !utf8.Valid(sample)
+}
+
+// readRange 读取远程文件从offset开始的length个字节，到达文件末尾时返回的内容较短
+func readRange(ctx context.Context, client pb.FileServiceClient, p string, offset, length int64) ([]byte, error) {
+	stream, err := client.DownloadFile(ctx, &pb.DownloadFileRequest{FilePath: p, Offset: offset, Length: length})
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newStreamReader(stream)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return data, reader.verify()
+}
+
+// catFile 将远程文件的全部内容写入out，开头的内容不是文本时不输出
+func catFile(ctx context.Context, client pb.FileServiceClient, p string, out io.Writer) error {
+	stream, err := client.DownloadFile(ctx, &pb.DownloadFileRequest{FilePath: p})
+	if err != nil {
+		return err
+	}
+	reader, err := newStreamReader(stream)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	br := bufio.NewReaderSize(reader, binarySampleSize)
+	sample, err := br.Peek(binarySampleSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	if isBinary(sample) {
+		return errBinary
+	}
+	if _, err := io.Copy(out, br); err != nil {
+		return err
+	}
+	return reader.verify()
+}
+
+// headFile 将远程文件的前n行写入out，按范围分段读取，不会下载整个文件
+func headFile(ctx context.Context, client pb.FileServiceClient, p string, n int, out io.Writer) error {
+	var offset int64
+	for lines := 0; lines < n; {
+		data, err := readRange(ctx, client, p, offset, rangeChunkSize)
+		if err != nil {
+			return err
+		}
+		if offset == 0 && isBinary(data) {
+			return errBinary
+		}
+		eof := len(data) < rangeChunkSize
+		for i, b := range data {
+			if b == '\n' {
+				lines++
+				if lines == n {
+					data = data[:i+1]
+					break
+				}
+			}
+		}
+		if _, err := out.Write(data); err != nil {
+			return err
+		}
+		if eof {
+			break
+		}
+		offset += rangeChunkSize
+	}
+	return nil
+}
+
+// tailFile 将远程文件的最后n行写入out，从文件末尾向前按范围读取，返回读取时的文件大小
+func tailFile(ctx context.Context, client pb.FileServiceClient, p string, n int, out io.Writer) (int64, error) {
+	resp, err := client.Stat(ctx, &pb.StatRequest{Path: p})
+	if err != nil {
+		return 0, err
+	}
+	if resp.Entry.GetIsDirectory() {
+		return 0, fmt.Errorf("%s 是目录", p)
+	}
+	size := resp.Entry.GetSize()
+	if n == 0 {
+		return size, nil
+	}
+	var data []byte
+	start := -1 // 最后n行在data中的起始位置
+	for offset := size; offset > 0 && start < 0; {
+		from := max(offset-rangeChunkSize, 0)
+		chunk, err := readRange(ctx, client, p, from, offset-from)
+		if err != nil {
+			return 0, err
+		}
+		data = append(chunk, data...)
+		offset = from
+		start = lastLines(data, n)
+		if start < 0 && offset == 0 {
+			start = 0
+		}
+	}
+	data = data[max(start, 0):]
+	if isBinary(data) {
+		return 0, errBinary
+	}
+	if _, err := out.Write(data); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// lastLines 返回最后n行在data中的起始位置，data中不足n个完整的行时返回-1。
+// 末尾的换行属于最后一行，不单独计为一行
+func lastLines(data []byte, n int) int {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	for i := 0; i < n; i++ {
+		end = bytes.LastIndexByte(data[:end], '\n')
+		if end < 0 {
+			return -1
+		}
+	}
+	return end + 1
+}
+
+// followFile 从offset开始持续将远程文件追加的内容写入out，直到ctx取消
+func followFile(ctx context.Context, client pb.FileServiceClient, p string, offset int64, out io.Writer) error {
+	stream, err := client.DownloadFile(ctx, &pb.DownloadFileRequest{FilePath: p, Offset: offset, Follow: true})
+	if err != nil {
+		return err
+	}
+	reader, err := newStreamReader(stream)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(out, reader)
+	return err
+}
+
+// lineWriter 记录最后写入的字节，命令结束时补上缺少的换行，避免提示符接在内容之后
+type lineWriter struct {
+	w    io.Writer
+	last byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.last = p[len(p)-1]
+	}
+	return w.w.Write(p)
+}
+
+func (w *lineWriter) finish() {
+	if w.last != 0 && w.last != '\n' {
+		fmt.Fprintln(w.w)
+	}
+}
+
+// parseLinesOptions 解析 head/tail 的 [-n N] [-f] <文件>，allowFollow 为 false 时不接受 -f
+func parseLinesOptions(args []string, allowFollow bool) (int, bool, string, bool) {
+	n := defaultLines
+	var follow bool
+	var target string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-n" && i+1 < len(args):
+			v, err := strconv.Atoi(args[i+1])
+			if err != nil || v < 0 {
+				return 0, false, "", false
+			}
+			n = v
+			i++
+		case args[i] == "-f" && allowFollow:
+			follow = true
+		case target == "" && !strings.HasPrefix(args[i], "-"):
+			target = args[i]
+		default:
+			return 0, false, "", false
+		}
+	}
+	return n, follow, target, target != ""
+}
+
+// cat 显示远程文件的全部内容，按 Ctrl+C 提前结束
+func cat(m *Manager, args []string) string {
+	if len(args) != 1 {
+		return ErrorMsg("cat 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out := &lineWriter{w: os.Stdout}
+	err := catFile(ctx, pb.NewFileServiceClient(m.currentConn), m.remotePath(args[0]), out)
+	out.finish()
+	if err != nil && ctx.Err() == nil {
+		return ErrorMsg(describeError(err))
+	}
+	return ""
+}
+
+// head 显示远程文件的前N行：head [-n N] <文件>，默认10行
+func head(m *Manager, args []string) string {
+	n, _, target, ok := parseLinesOptions(args, false)
+	if !ok {
+		return ErrorMsg("head 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	if msg := m.requireFeature(featureRanges); msg != "" {
+		return msg
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	out := &lineWriter{w: os.Stdout}
+	err := headFile(ctx, pb.NewFileServiceClient(m.currentConn), m.remotePath(target), n, out)
+	out.finish()
+	if err != nil {
+		return ErrorMsg(describeError(err))
+	}
+	return ""
+}
+
+// tail 显示远程文件的最后N行：tail [-n N] [-f] <文件>，默认10行；-f 持续显示追加的内容，按 Ctrl+C 结束
+func tail(m *Manager, args []string) string {
+	n, follow, target, ok := parseLinesOptions(args, true)
+	if !ok {
+		return ErrorMsg("tail 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	if msg := m.requireFeature(featureRanges); msg != "" {
+		return msg
+	}
+	if follow {
+		if msg := m.requireFeature(featureFollow); msg != "" {
+			return msg
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	client := pb.NewFileServiceClient(m.currentConn)
+	p := m.remotePath(target)
+	out := &lineWriter{w: os.Stdout}
+	defer out.finish()
+	size, err := tailFile(ctx, client, p, n, out)
+	if err == nil && follow {
+		err = followFile(ctx, client, p, size, out)
+	}
+	if err != nil && ctx.Err() == nil {
+		return ErrorMsg(describeError(err))
+	}
+	return ""
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"ZFS/config"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "ZFS/grpc"
+)
+
+// syncBuffer 可以在follow过程中并发读取的输出缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// writeLines 写入count行 "line N"，总大小超过多个 rangeChunkSize
+func writeLines(t *testing.T, p string, count int, trailingNewline bool) []string {
+	t.Helper()
+	lines := make([]string, count)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d 日志", i+1)
+	}
+	content := strings.Join(lines, "\n")
+	if trailingNewline {
+		content += "\n"
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	return lines
+}
+
+func TestHeadTail(t *testing.T) {
+	root := t.TempDir()
+	lines := writeLines(t, filepath.Join(root, "app.log"), 20000, true)
+	writeLines(t, filepath.Join(root, "short.log"), 3, false)
+	client := pb.NewFileServiceClient(startTestServer(t, newTestFileServer(t, root).storage))
+	ctx := context.Background()
+	join := func(lines []string) string { return strings.Join(lines, "\n") + "\n" }
+
+	tests := []struct {
+		name string
+		run  func(*bytes.Buffer) error
+		want string
+	}{
+		{"head", func(b *bytes.Buffer) error { return headFile(ctx, client, "app.log", 3, b) }, join(lines[:3])},
+		{"head 跨越多个范围", func(b *bytes.Buffer) error { return headFile(ctx, client, "app.log", 12000, b) }, join(lines[:12000])},
+		{"head 0行", func(b *bytes.Buffer) error { return headFile(ctx, client, "app.log", 0, b) }, ""},
+		{"head 超过文件行数", func(b *bytes.Buffer) error { return headFile(ctx, client, "short.log", 10, b) }, "line 1 日志\nline 2 日志\nline 3 日志"},
+		{"tail", func(b *bytes.Buffer) error { _, err := tailFile(ctx, client, "app.log", 3, b); return err }, join(lines[19997:])},
+		{"tail 跨越多个范围", func(b *bytes.Buffer) error { _, err := tailFile(ctx, client, "app.log", 12000, b); return err }, join(lines[8000:])},
+		{"tail 没有末尾换行", func(b *bytes.Buffer) error { _, err := tailFile(ctx, client, "short.log", 2, b); return err }, "line 2 日志\nline 3 日志"},
+		{"tail 超过文件行数", func(b *bytes.Buffer) error { _, err := tailFile(ctx, client, "short.log", 10, b); return err }, "line 1 日志\nline 2 日志\nline 3 日志"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := tt.run(&b); err != nil {
+			t.Errorf("%s 失败: %v", tt.name, err)
+			continue
+		}
+		if b.String() != tt.want {
+			t.Errorf("%s 的输出不正确，共 %d 字节，期望 %d 字节", tt.name, b.Len(), len(tt.want))
+		}
+	}
+}
+
+func TestCatBinary(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "text.txt"), []byte("你好，world\n"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "image.png"), []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	client := pb.NewFileServiceClient(startTestServer(t, newTestFileServer(t, root).storage))
+	ctx := context.Background()
+
+	var b bytes.Buffer
+	if err := catFile(ctx, client, "text.txt", &b); err != nil || b.String() != "你好，world\n" {
+		t.Errorf("cat 的输出为 %q, %v", b.String(), err)
+	}
+	b.Reset()
+	if err := catFile(ctx, client, "image.png", &b); !errors.Is(err, errBinary) || b.Len() != 0 {
+		t.Errorf("二进制文件应当拒绝输出: %v，已输出 %d 字节", err, b.Len())
+	}
+	if err := headFile(ctx, client, "image.png", 1, &b); !errors.Is(err, errBinary) {
+		t.Errorf("head 二进制文件应当拒绝输出: %v", err)
+	}
+	if _, err := tailFile(ctx, client, "image.png", 1, &b); !errors.Is(err, errBinary) {
+		t.Errorf("tail 二进制文件应当拒绝输出: %v", err)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	text := []byte(strings.Repeat("日志", binarySampleSize))
+	tests := []struct {
+		sample []byte
+		want   bool
+	}{
+		{[]byte("plain text\n"), false},
+		{[]byte{}, false},
+		{text[:7], false}, // 末尾截断了一个多字节字符
+		{text, false},
+		{[]byte("a\x00b"), true},
+		{[]byte("a\xffb"), true},
+	}
+	for _, tt := range tests {
+		if got := isBinary(tt.sample); got != tt.want {
+			t.Errorf("isBinary(%q) = %v", tt.sample, got)
+		}
+	}
+}
+
+func TestTailFollow(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "app.log")
+	writeLines(t, p, 5, true)
+	client := pb.NewFileServiceClient(startTestServer(t, newTestFileServer(t, root).storage))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var out syncBuffer
+	size, err := tailFile(ctx, client, "app.log", 2, &out)
+	if err != nil {
+		t.Fatalf("tail 失败: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- followFile(ctx, client, "app.log", size, &out) }()
+
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("打开测试文件失败: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("appended 1\nappended 2\n"); err != nil {
+		t.Fatalf("追加内容失败: %v", err)
+	}
+	want := "line 4 日志\nline 5 日志\nappended 1\nappended 2\n"
+	deadline := time.Now().Add(5 * followInterval)
+	for out.String() != want && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if out.String() != want {
+		t.Fatalf("follow 的输出为 %q", out.String())
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("取消后 follow 应当结束")
+	}
+
+	stream, err := client.DownloadFile(context.Background(), &pb.DownloadFileRequest{FilePath: "app.log", Length: 10, Follow: true})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("follow 与 length 同时使用应当返回 InvalidArgument，实际: %v", err)
+	}
+}
+
+func TestTailFollowReplaced(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(root, "app.log")
+	if err := os.WriteFile(p, []byte("old 1\nold 2\n"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	s := newTestFileServer(t, root)
+	s.limits = newLimiter(config.LimitsConfig{MaxPeerStreams: 1})
+	conn, _ := serveTestFileServer(t, s)
+	client := pb.NewFileServiceClient(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var out syncBuffer
+	done := make(chan error, 1)
+	go func() { done <- followFile(ctx, client, "app.log", 0, &out) }()
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * followInterval)
+		for out.String() != want && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if out.String() != want {
+			t.Fatalf("follow 的输出为 %q，期望 %q", out.String(), want)
+		}
+	}
+	waitFor("old 1\nold 2\n")
+
+	// 跟随期间不占用下载流名额，同一调用方仍然可以下载
+	if _, err := readRange(context.Background(), client, "app.log", 0, 5); err != nil {
+		t.Errorf("follow 期间下载应当被接受: %v", err)
+	}
+
+	// 日志轮转后新文件比已发送的位置更长，仍然要从头发送
+	rotated := filepath.Join(root, "app.log.new")
+	if err := os.WriteFile(rotated, []byte("new 1\nnew 2\nnew 3\n"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	if err := os.Rename(rotated, p); err != nil {
+		t.Fatalf("替换测试文件失败: %v", err)
+	}
+	waitFor("old 1\nold 2\nnew 1\nnew 2\nnew 3\n")
+	cancel()
+	<-done
+}
+
+func TestParseLinesOptions(t *testing.T) {
+	tests := []struct {
+		args        []string
+		allowFollow bool
+		n           int
+		follow      bool
+		target      string
+		ok          bool
+	}{
+		{[]string{"app.log"}, false, defaultLines, false, "app.log", true},
+		{[]string{"-n", "20", "app.log"}, false, 20, false, "app.log", true},
+		{[]string{"-f", "-n", "0", "app.log"}, true, 0, true, "app.log", true},
+		{[]string{"app.log", "-f"}, true, defaultLines, true, "app.log", true},
+		{[]string{"-f", "app.log"}, false, 0, false, "", false},
+		{[]string{"-n", "-1", "app.log"}, false, 0, false, "", false},
+		{[]string{"-n"}, false, 0, false, "", false},
+		{[]string{"a", "b"}, false, 0, false, "", false},
+		{nil, true, 0, false, "", false},
+	}
+	for _, tt := range tests {
+		n, follow, target, ok := parseLinesOptions(tt.args, tt.allowFollow)
+		if ok != tt.ok || (ok && (n != tt.n || follow != tt.follow || target != tt.target)) {
+			t.Errorf("%v: 解析结果为 %d %v %q %v", tt.args, n, follow, target, ok)
+		}
+	}
+}
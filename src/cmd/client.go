@@ -1 +1,45 @@
 package cmd
+
+import (
+	"ZFS/storage"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// describeError 将远程调用返回的错误转换为面向用户的说明，
+// 包装在本地错误中的状态错误只替换状态错误本身的部分
+func describeError(err error) string {
+	var se interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &se) {
+		return err.Error()
+	}
+	inner := se.(error)
+	return strings.Replace(err.Error(), inner.Error(), describeStatus(se.GRPCStatus()), 1)
+}
+
+// describeStatus 按状态码给出说明，服务端返回的说明已经足够清楚的状态码直接使用其说明
+func describeStatus(st *status.Status) string {
+	switch st.Code() {
+	case codes.Unavailable:
+		return "节点无法连接：" + st.Message()
+	case codes.DeadlineExceeded:
+		return "请求超时"
+	case codes.Canceled:
+		return "操作已取消"
+	case codes.Unauthenticated:
+		return "认证失败：" + st.Message()
+	case codes.ResourceExhausted:
+		// 存储空间不足的说明已经足够清楚，其余是限速返回的繁忙
+		if strings.HasPrefix(st.Message(), storage.ErrNoSpace.Error()) {
+			return st.Message()
+		}
+		return "节点繁忙：" + st.Message()
+	case codes.Unimplemented:
+		return "对方节点版本过旧，不支持该操作"
+	case codes.Internal, codes.Unknown:
+		return "节点内部错误：" + st.Message()
+	}
+	return st.Message()
+}
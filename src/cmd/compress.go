@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"ZFS/config"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 文件传输支持的压缩算法
+const (
+	compressionNone = "identity"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+// compressionSampleSize 服务端判断是否值得压缩时采样的字节数
+const compressionSampleSize = 64 * 1024
+
+// defaultCompressionMaxRatio 采样压缩率（压缩后/压缩前）高于该值时不压缩
+const defaultCompressionMaxRatio = 0.9
+
+// compressedContentTypes 本身已经压缩过的内容类型，再次压缩没有收益
+var compressedContentTypes = []string{
+	"image/", "video/", "audio/",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/vnd.rar",
+	"application/x-bzip2", "application/x-xz", "application/x-compress",
+}
+
+func isCompressedContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	// svg 是文本格式，可以压缩
+	if strings.HasPrefix(contentType, "image/svg") {
+		return false
+	}
+	for _, prefix := range compressedContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSupportedCompression(algorithm string) bool {
+	return algorithm == compressionGzip || algorithm == compressionZstd
+}
+
+func newCompressor(algorithm string, w io.Writer) (io.WriteCloser, error) {
+	switch algorithm {
+	case compressionGzip:
+		return gzip.NewWriterLevel(w, gzip.BestSpeed)
+	case compressionZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, fmt.Errorf("不支持的压缩算法: %s", algorithm)
+	}
+}
+
+func newDecompressor(algorithm string, r io.Reader) (io.ReadCloser, error) {
+	switch algorithm {
+	case compressionGzip:
+		return gzip.NewReader(r)
+	case compressionZstd:
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("不支持的压缩算法: %s", algorithm)
+	}
+}
+
+// compressionMaxRatio 配置的采样压缩率上限，未配置时使用默认值
+func compressionMaxRatio(conf config.TransferConfig) float64 {
+	if conf.CompressionMaxRatio <= 0 {
+		return defaultCompressionMaxRatio
+	}
+	return conf.CompressionMaxRatio
+}
+
+// worthCompressingFile 上传前按与服务端下载时相同的规则判断本地文件是否值得压缩，采样后回到文件开头
+func worthCompressingFile(file *os.File, algorithm string, maxRatio float64) (bool, error) {
+	if isCompressedContentType(mime.TypeByExtension(filepath.Ext(file.Name()))) {
+		return false, nil
+	}
+	sample := make([]byte, compressionSampleSize)
+	n, err := io.ReadFull(file, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return worthCompressing(algorithm, sample[:n], maxRatio), nil
+}
+
+// worthCompressing 压缩采样数据，压缩率不高于maxRatio时才值得压缩
+func worthCompressing(algorithm string, sample []byte, maxRatio float64) bool {
+	if len(sample) == 0 {
+		return false
+	}
+	var buf bytes.Buffer
+	w, err := newCompressor(algorithm, &buf)
+	if err != nil {
+		return false
+	}
+	if _, err := w.Write(sample); err != nil {
+		return false
+	}
+	if err := w.Close(); err != nil {
+		return false
+	}
+	return float64(buf.Len())/float64(len(sample)) <= maxRatio
+}
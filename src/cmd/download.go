@@ -0,0 +1,504 @@
+package cmd
+
+import (
+	pb "ZFS/grpc"
+	"ZFS/utils"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// partSuffix 未完成下载的临时文件后缀
+const partSuffix = ".part"
+
+// defaultParallel 递归下载目录时默认的并发下载数
+const defaultParallel = 4
+
+// maxAdmissionRetries 下载因服务端并发上限被拒绝后的最大重试次数
+const maxAdmissionRetries = 10
+
+var (
+	// errNothingToResume 没有可以续传的下载记录
+	errNothingToResume = errors.New("没有可续传的下载记录")
+	// errRemoteChanged 远程文件在上次下载中断之后发生了变化，已下载的部分不能再使用
+	errRemoteChanged = errors.New("远程文件已发生变化，无法续传")
+	// errIntegrity 下载的文件与服务端的大小或校验值不一致
+	errIntegrity = errors.New("文件校验失败")
+)
+
+// partMeta 记录 .part 文件对应的远程文件及其开始下载时的版本，与 .part 文件一起保存在 dataRoot 中，
+// 重新下载同一个文件时据此判断能否从断点续传：远程文件的大小、修改时间或内容标识变化后需要从头下载。
+// 大小和修改时间都不变的改写只能由内容标识发现，S3使用ETag，其他后端使用整个文件的校验值
+type partMeta struct {
+	Node     string `json:"node"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	ModTime  int64  `json:"modTime"`
+	ETag     string `json:"etag,omitempty"`
+	Checksum string `json:"checksum,omitempty"` // 算法:十六进制校验值，没有ETag时记录
+}
+
+func partMetaPath(partPath string) string {
+	return partPath + ".json"
+}
+
+// loadPartMeta 读取 .part 文件的续传记录，记录不存在或 .part 文件缺失时返回 false
+func loadPartMeta(partPath string) (partMeta, int64, bool) {
+	var meta partMeta
+	data, err := os.ReadFile(partMetaPath(partPath))
+	if err != nil {
+		return meta, 0, false
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, 0, false
+	}
+	info, err := os.Stat(partPath)
+	if err != nil || info.IsDir() {
+		return meta, 0, false
+	}
+	return meta, info.Size(), true
+}
+
+// remoteVersion 查询远程文件当前的版本，作为续传记录。查询失败时版本未知，不能用来续传。
+// 对方节点不支持 Checksum 时只能依据大小和修改时间判断，续传完成后的整体校验仍会发现不一致
+func (m *Manager) remoteVersion(ctx context.Context, remotePath string) (partMeta, error) {
+	meta := partMeta{Node: m.currentNode, Path: remotePath}
+	client := pb.NewFileServiceClient(m.currentConn)
+	resp, err := client.Stat(ctx, &pb.StatRequest{Path: remotePath})
+	if err != nil {
+		return meta, err
+	}
+	entry := resp.GetEntry()
+	meta.Size, meta.ModTime, meta.ETag = entry.GetSize(), entry.GetModTime(), entry.GetEtag()
+	if meta.ETag != "" || !m.supports(featureChecksum) {
+		return meta, nil
+	}
+	sum, err := client.Checksum(ctx, &pb.ChecksumRequest{FilePath: remotePath})
+	if status.Code(err) == codes.Unimplemented {
+		return meta, nil
+	}
+	if err != nil {
+		return meta, err
+	}
+	meta.Checksum = sum.GetAlgorithm() + ":" + sum.GetChecksum()
+	return meta, nil
+}
+
+func savePartMeta(partPath string, meta partMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partMetaPath(partPath), data, 0644)
+}
+
+// downloadFile 将远程文件下载到 localFilePath。数据先写入 .part 文件，完整接收后才重命名到目标位置；
+// 若存在同一远程文件的 .part 记录，则从已下载的位置继续，opts.resume 为 true 时没有记录则报错。
+// opts.compress 为 true 时请求服务端压缩传输；opts.jobs 大于 1 且没有续传记录时改为多段并发下载。
+// 对方节点不支持按范围读取时总是从头下载，不支持压缩时按原样传输。返回续传的起始偏移量
+func (m *Manager) downloadFile(ctx context.Context, remotePath, localFilePath string, opts getOptions) (int64, error) {
+	partPath := localFilePath + partSuffix
+	if !m.supports(featureRanges) {
+		opts.jobs = 0
+	}
+	if !m.supports(featureCompression) {
+		opts.compress = false
+	}
+
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	meta, size, ok := loadPartMeta(partPath)
+	if !ok && !opts.resume && opts.jobs > 1 {
+		return 0, m.downloadRanges(ctx, remotePath, localFilePath, opts)
+	}
+	// 续传前确认远程文件仍是记录中的版本，包括内容标识，之后才在已下载的部分后追加
+	want, versionErr := m.remoteVersion(ctx, remotePath)
+	if ok && versionErr == nil && meta == want && m.supports(featureRanges) {
+		offset = size
+		flags = os.O_WRONLY | os.O_APPEND
+	} else if opts.resume {
+		if ok && versionErr != nil {
+			return 0, fmt.Errorf("查询远程文件失败：%w", versionErr)
+		}
+		if ok && meta.Node == want.Node && meta.Path == want.Path {
+			return 0, errRemoteChanged
+		}
+		return 0, errNothingToResume
+	} else if opts.jobs > 1 {
+		return 0, m.downloadRanges(ctx, remotePath, localFilePath, opts)
+	} else if err := savePartMeta(partPath, want); err != nil {
+		return 0, fmt.Errorf("写入续传记录失败：%w", err)
+	}
+
+	// 出错时保留 .part 文件，重新执行 get 即可从断点继续；一个字节都没有收到时则不留下记录
+	var written int64
+	discard := func() {
+		if offset+written == 0 {
+			os.Remove(partPath)
+			os.Remove(partMetaPath(partPath))
+		}
+	}
+	req := &pb.DownloadFileRequest{
+		FilePath: remotePath,
+		Offset:   offset,
+	}
+	if opts.compress {
+		req.Compression = m.compression()
+	}
+	client := pb.NewFileServiceClient(m.currentConn)
+	stream, err := client.DownloadFile(ctx, req)
+	if err != nil {
+		discard()
+		return offset, fmt.Errorf("远程调用出错：%w", err)
+	}
+	file, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return offset, fmt.Errorf("创建本地文件失败：%w", err)
+	}
+	defer file.Close()
+	reader, err := newStreamReader(stream)
+	if err != nil {
+		file.Close()
+		discard()
+		return offset, err
+	}
+	defer reader.Close()
+	buf := getBuffer(normalizeChunkSize(m.transfer.ChunkSize))
+	defer putBuffer(buf)
+	for {
+		n, err := reader.Read(*buf)
+		if n > 0 {
+			written += int64(n)
+			if _, err := file.Write((*buf)[:n]); err != nil {
+				return offset, fmt.Errorf("写入本地文件失败：%w", err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			discard()
+			return offset, fmt.Errorf("接收文件数据失败：%w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return offset, fmt.Errorf("写入本地文件失败：%w", err)
+	}
+	if reader.hasher != nil {
+		err := reader.verify()
+		// 续传时本次传输只覆盖文件的后半部分，还需要校验完整文件
+		if err == nil && offset > 0 {
+			err = verifyWholeFile(ctx, client, remotePath, partPath, reader.algorithm)
+		}
+		if err != nil {
+			return offset, quarantine(partPath, localFilePath, err)
+		}
+	}
+	if err := os.Rename(partPath, localFilePath); err != nil {
+		return offset, fmt.Errorf("重命名本地文件失败：%w", err)
+	}
+	os.Remove(partMetaPath(partPath))
+	return offset, nil
+}
+
+// streamHasher 根据服务端在header中声明的校验算法创建哈希实例，旧版本节点不提供时返回nil，跳过校验
+func streamHasher(header metadata.MD) (hash.Hash, string, error) {
+	values := header.Get(algorithmMetadataKey)
+	if len(values) == 0 {
+		return nil, "", nil
+	}
+	hasher, err := utils.NewHash(values[0])
+	if err != nil {
+		return nil, "", err
+	}
+	return hasher, values[0], nil
+}
+
+// chunkReader 将 DownloadFile 的响应流适配为 io.Reader，读出的是线路上的原始（可能已压缩）数据
+type chunkReader struct {
+	stream pb.FileService_DownloadFileClient
+	buf    []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = chunk.Content
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// streamReader 读取 DownloadFile 的响应流，按服务端header中声明的压缩算法解压，
+// 并对解压后的内容计算校验值
+type streamReader struct {
+	stream       pb.FileService_DownloadFileClient
+	reader       io.Reader
+	decompressor io.ReadCloser
+	hasher       hash.Hash
+	algorithm    string
+	received     int64
+}
+
+func newStreamReader(stream pb.FileService_DownloadFileClient) (*streamReader, error) {
+	r := &streamReader{stream: stream}
+	r.reader = &chunkReader{stream: stream}
+	header, err := stream.Header()
+	if err != nil {
+		// 获取header失败时，错误会在后续 Recv 中返回
+		return r, nil
+	}
+	if r.hasher, r.algorithm, err = streamHasher(header); err != nil {
+		return nil, err
+	}
+	if values := header.Get(compressionMetadataKey); len(values) > 0 && values[0] != compressionNone {
+		if r.decompressor, err = newDecompressor(values[0], r.reader); err != nil {
+			return nil, err
+		}
+		r.reader = r.decompressor
+	}
+	return r, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.received += int64(n)
+		if r.hasher != nil {
+			r.hasher.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+// Close 释放解压器占用的资源
+func (r *streamReader) Close() error {
+	if r.decompressor != nil {
+		return r.decompressor.Close()
+	}
+	return nil
+}
+
+// verify 在读取到 io.EOF 之后，将接收到的内容与服务端trailer中的记录比较
+func (r *streamReader) verify() error {
+	if r.hasher == nil {
+		return nil
+	}
+	return verifyTrailer(r.stream.Trailer(), r.algorithm, r.hasher, r.received)
+}
+
+// verifyTrailer 将接收到的字节数和校验值与服务端trailer中的记录比较
+func verifyTrailer(trailer metadata.MD, algorithm string, hasher hash.Hash, written int64) error {
+	if values := trailer.Get(sizeMetadataKey); len(values) > 0 {
+		size, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("服务端返回的文件大小不合法：%s", values[0])
+		}
+		if size != written {
+			return fmt.Errorf("文件大小不匹配：服务端发送 %d 字节，实际接收 %d 字节", size, written)
+		}
+	}
+	values := trailer.Get(checksumMetadataKey)
+	if len(values) == 0 {
+		return errors.New("服务端未返回校验值")
+	}
+	expected := algorithm + ":" + hex.EncodeToString(hasher.Sum(nil))
+	if values[0] != expected {
+		return fmt.Errorf("校验值不匹配：服务端 %s，本地 %s", values[0], expected)
+	}
+	return nil
+}
+
+// verifyWholeFile 向服务端查询完整文件的校验值，并与本地文件比较
+func verifyWholeFile(ctx context.Context, client pb.FileServiceClient, remotePath, localPath, algorithm string) error {
+	resp, err := client.Checksum(ctx, &pb.ChecksumRequest{FilePath: remotePath, Algorithm: algorithm})
+	if err != nil {
+		return fmt.Errorf("查询文件校验值失败：%w", err)
+	}
+	local, size, err := fileChecksum(localPath, algorithm)
+	if err != nil {
+		return err
+	}
+	if size != resp.Size {
+		return fmt.Errorf("文件大小不匹配：服务端 %d 字节，本地 %d 字节", resp.Size, size)
+	}
+	if local != resp.Checksum {
+		return fmt.Errorf("校验值不匹配：服务端 %s:%s，本地 %s:%s", algorithm, resp.Checksum, algorithm, local)
+	}
+	return nil
+}
+
+// fileChecksum 计算本地文件的校验值
+func fileChecksum(path, algorithm string) (string, int64, error) {
+	hasher, err := utils.NewHash(algorithm)
+	if err != nil {
+		return "", 0, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// quarantine 将校验失败的文件移动到 <文件名>.corrupt，避免被误当作完整文件使用
+func quarantine(partPath, localFilePath string, cause error) error {
+	os.Remove(partMetaPath(partPath))
+	corruptPath := localFilePath + ".corrupt"
+	if err := os.Rename(partPath, corruptPath); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("%w：%v，已删除本地文件", errIntegrity, cause)
+	}
+	return fmt.Errorf("%w：%v，已隔离到 %s", errIntegrity, cause, corruptPath)
+}
+
+// retriesExhausted 重试次数用尽后服务端仍然拒绝，外层的 retryAdmission 不再重复重试
+type retriesExhausted struct{ error }
+
+func (e retriesExhausted) Unwrap() error { return e.error }
+
+// retryAdmission 执行 fn，服务端因并发已满拒绝时按其建议的间隔重试，最多 maxAdmissionRetries 次
+func retryAdmission(ctx context.Context, fn func() error) error {
+	err := fn()
+	for attempt := 0; ; attempt++ {
+		if errors.As(err, new(retriesExhausted)) {
+			return err
+		}
+		delay, ok := retryDelay(err)
+		if !ok {
+			return err
+		}
+		if attempt == maxAdmissionRetries {
+			return retriesExhausted{err}
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		err = fn()
+	}
+}
+
+// remoteFile 递归下载时待下载的远程文件
+type remoteFile struct {
+	remotePath string
+	localPath  string
+	size       int64
+}
+
+// downloadSummary 递归下载的结果统计
+type downloadSummary struct {
+	files    int      // 下载成功的文件数
+	bytes    int64    // 下载成功的字节数
+	skipped  int      // 因本地已存在而跳过的文件数
+	failures []string // 失败的文件及原因
+}
+
+func (s *downloadSummary) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("下载完成：成功 %d 个文件（%s），跳过 %d 个，失败 %d 个",
+		s.files, utils.FormatFileSize(s.bytes), s.skipped, len(s.failures)))
+	for _, failure := range s.failures {
+		sb.WriteString("\n  ")
+		sb.WriteString(failure)
+	}
+	return sb.String()
+}
+
+// walkRemote 遍历远程目录树，在本地创建对应的目录结构并返回其中的所有文件
+func (m *Manager) walkRemote(remoteDir, localDir string, summary *downloadSummary) []remoteFile {
+	var files []remoteFile
+	if err := os.MkdirAll(localDir, os.ModePerm); err != nil {
+		summary.failures = append(summary.failures, fmt.Sprintf("%s：创建目录失败：%v", remoteDir, err))
+		return nil
+	}
+	entries, err := m.listDirectory(remoteDir)
+	if err != nil {
+		summary.failures = append(summary.failures, fmt.Sprintf("%s：列出目录失败：%s", remoteDir, describeError(err)))
+		return nil
+	}
+	for _, entry := range entries {
+		// 防止恶意的条目名称写到 localDir 之外
+		if entry.Name == "" || entry.Name == "." || entry.Name == ".." || strings.ContainsAny(entry.Name, `/\`) {
+			summary.failures = append(summary.failures, fmt.Sprintf("%s/%s：名称不合法", remoteDir, entry.Name))
+			continue
+		}
+		remotePath := path.Join(remoteDir, entry.Name)
+		localPath := filepath.Join(localDir, entry.Name)
+		if entry.IsDirectory {
+			files = append(files, m.walkRemote(remotePath, localPath, summary)...)
+			continue
+		}
+		if entry.IsSymlink {
+			// link 策略下的符号链接不能读取内容，不作为文件下载
+			continue
+		}
+		files = append(files, remoteFile{remotePath: remotePath, localPath: localPath, size: entry.Size})
+	}
+	return files
+}
+
+// downloadDirectory 递归下载远程目录到 localDir，最多同时下载 opts.parallel 个文件
+func (m *Manager) downloadDirectory(ctx context.Context, remoteDir, localDir string, opts getOptions) *downloadSummary {
+	summary := &downloadSummary{}
+	files := m.walkRemote(remoteDir, localDir, summary)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.parallel)
+	for _, file := range files {
+		if opts.skipExisting {
+			if info, err := os.Stat(file.localPath); err == nil && !info.IsDir() && info.Size() == file.size {
+				summary.skipped++
+				continue
+			}
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(file remoteFile) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := retryAdmission(ctx, func() error {
+				_, err := m.downloadFile(ctx, file.remotePath, file.localPath, opts)
+				return err
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				summary.failures = append(summary.failures, fmt.Sprintf("%s：%s", file.remotePath, describeError(err)))
+				return
+			}
+			summary.files++
+			summary.bytes += file.size
+		}(file)
+	}
+	wg.Wait()
+	sort.Strings(summary.failures)
+	return summary
+}
@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"ZFS/config"
+	"ZFS/storage"
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// newTestManager 创建已经 cd 到 node1 根目录的 Manager
+func newTestManager(t *testing.T, stor storage.Storage) *Manager {
+	t.Helper()
+	m := NewManager("root", &sync.Map{}, t.TempDir(), config.TransferConfig{})
+	m.relativePath = []string{"node1"}
+	m.currentNode = "node1"
+	m.currentConn = startTestServer(t, stor)
+	return m
+}
+
+// currentVersion 返回远程文件当前的版本，模拟一次刚开始的下载写入的续传记录
+func currentVersion(t *testing.T, m *Manager, remotePath string) partMeta {
+	t.Helper()
+	meta, err := m.remoteVersion(context.Background(), remotePath)
+	if err != nil {
+		t.Fatalf("查询远程文件版本失败: %v", err)
+	}
+	return meta
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	storageRoot := t.TempDir()
+	stor, err := storage.NewLocalStorage(storageRoot, storage.SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := os.WriteFile(filepath.Join(storageRoot, "big.bin"), content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	m := newTestManager(t, stor)
+	localFilePath := filepath.Join(m.dataRoot, "node1", "big.bin")
+	partPath := localFilePath + partSuffix
+	if err := os.MkdirAll(filepath.Dir(localFilePath), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+
+	// 没有 .part 记录时 -c 应当报错
+	if _, err := m.downloadFile(context.Background(), "big.bin", localFilePath, getOptions{resume: true}); !errors.Is(err, errNothingToResume) {
+		t.Fatalf("预期 errNothingToResume，实际: %v", err)
+	}
+
+	// 模拟一次中断的下载：已写入前 3000 字节
+	if err := os.WriteFile(partPath, content[:3000], 0644); err != nil {
+		t.Fatalf("写入 .part 文件失败: %v", err)
+	}
+	if err := savePartMeta(partPath, currentVersion(t, m, "big.bin")); err != nil {
+		t.Fatalf("写入续传记录失败: %v", err)
+	}
+
+	offset, err := m.downloadFile(context.Background(), "big.bin", localFilePath, getOptions{resume: true})
+	if err != nil {
+		t.Fatalf("续传失败: %v", err)
+	}
+	if offset != 3000 {
+		t.Errorf("续传起始位置错误: got %d, expected 3000", offset)
+	}
+	data, err := os.ReadFile(localFilePath)
+	if err != nil {
+		t.Fatalf("读取下载文件失败: %v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Error("续传后的文件内容不匹配")
+	}
+	for _, p := range []string{partPath, partMetaPath(partPath)} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("下载完成后应当删除 %s", p)
+		}
+	}
+
+	// 记录属于其他远程文件时应当重新下载
+	if err := os.WriteFile(partPath, []byte("garbage"), 0644); err != nil {
+		t.Fatalf("写入 .part 文件失败: %v", err)
+	}
+	if err := savePartMeta(partPath, partMeta{Node: "node2", Path: "big.bin"}); err != nil {
+		t.Fatalf("写入续传记录失败: %v", err)
+	}
+	if offset, err := m.downloadFile(context.Background(), "big.bin", localFilePath, getOptions{}); err != nil || offset != 0 {
+		t.Fatalf("重新下载失败: offset=%d, err=%v", offset, err)
+	}
+	if data, _ := os.ReadFile(localFilePath); !bytes.Equal(data, content) {
+		t.Error("重新下载后的文件内容不匹配")
+	}
+
+	// 远程文件在中断之后被修改，已下载的部分作废：-c 报错，不带 -c 时从头下载
+	if err := os.WriteFile(partPath, content[:3000], 0644); err != nil {
+		t.Fatalf("写入 .part 文件失败: %v", err)
+	}
+	if err := savePartMeta(partPath, currentVersion(t, m, "big.bin")); err != nil {
+		t.Fatalf("写入续传记录失败: %v", err)
+	}
+	content = append(content, "appended"...)
+	if err := os.WriteFile(filepath.Join(storageRoot, "big.bin"), content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	if _, err := m.downloadFile(context.Background(), "big.bin", localFilePath, getOptions{resume: true}); !errors.Is(err, errRemoteChanged) {
+		t.Fatalf("预期 errRemoteChanged，实际: %v", err)
+	}
+	if offset, err := m.downloadFile(context.Background(), "big.bin", localFilePath, getOptions{}); err != nil || offset != 0 {
+		t.Fatalf("远程文件变化后重新下载失败: offset=%d, err=%v", offset, err)
+	}
+	if data, _ := os.ReadFile(localFilePath); !bytes.Equal(data, content) {
+		t.Error("远程文件变化后下载的内容不匹配")
+	}
+
+	// 大小和修改时间都不变的改写由校验值发现，不在旧内容之后追加
+	if err := os.WriteFile(partPath, content[:3000], 0644); err != nil {
+		t.Fatalf("写入 .part 文件失败: %v", err)
+	}
+	if err := savePartMeta(partPath, currentVersion(t, m, "big.bin")); err != nil {
+		t.Fatalf("写入续传记录失败: %v", err)
+	}
+	remote := filepath.Join(storageRoot, "big.bin")
+	info, err := os.Stat(remote)
+	if err != nil {
+		t.Fatalf("读取测试文件信息失败: %v", err)
+	}
+	rewritten := bytes.ToUpper(content)
+	if err := os.WriteFile(remote, rewritten, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	if err := os.Chtimes(remote, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("恢复修改时间失败: %v", err)
+	}
+	if _, err := m.downloadFile(context.Background(), "big.bin", localFilePath, getOptions{resume: true}); !errors.Is(err, errRemoteChanged) {
+		t.Fatalf("内容改写后预期 errRemoteChanged，实际: %v", err)
+	}
+	if data, _ := os.ReadFile(partPath); !bytes.Equal(data, content[:3000]) {
+		t.Error("拒绝续传时不应修改已下载的部分")
+	}
+	if offset, err := m.downloadFile(context.Background(), "big.bin", localFilePath, getOptions{}); err != nil || offset != 0 {
+		t.Fatalf("内容改写后重新下载失败: offset=%d, err=%v", offset, err)
+	}
+	if data, _ := os.ReadFile(localFilePath); !bytes.Equal(data, rewritten) {
+		t.Error("内容改写后下载的内容不匹配")
+	}
+
+	// 远程文件不存在时不应留下 .part 记录
+	missing := filepath.Join(m.dataRoot, "node1", "missing.bin")
+	if _, err := m.downloadFile(context.Background(), "missing.bin", missing, getOptions{}); err == nil {
+		t.Fatal("下载不存在的文件时应当返回错误")
+	}
+	if _, err := os.Stat(missing + partSuffix); !os.IsNotExist(err) {
+		t.Error("下载失败且未收到数据时不应保留 .part 文件")
+	}
+}
+
+func TestDownloadFileIntegrity(t *testing.T) {
+	storageRoot := t.TempDir()
+	stor, err := storage.NewLocalStorage(storageRoot, storage.SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	content := bytes.Repeat([]byte("abcdefghij"), 1000)
+	if err := os.WriteFile(filepath.Join(storageRoot, "data.bin"), content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	m := newTestManager(t, stor)
+	localFilePath := filepath.Join(m.dataRoot, "node1", "data.bin")
+	partPath := localFilePath + partSuffix
+	if err := os.MkdirAll(filepath.Dir(localFilePath), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+
+	// 已下载的部分与服务端内容不一致，续传后完整文件校验应当失败
+	if err := os.WriteFile(partPath, bytes.Repeat([]byte("x"), 3000), 0644); err != nil {
+		t.Fatalf("写入 .part 文件失败: %v", err)
+	}
+	if err := savePartMeta(partPath, currentVersion(t, m, "data.bin")); err != nil {
+		t.Fatalf("写入续传记录失败: %v", err)
+	}
+	if _, err := m.downloadFile(context.Background(), "data.bin", localFilePath, getOptions{}); !errors.Is(err, errIntegrity) {
+		t.Fatalf("预期 errIntegrity，实际: %v", err)
+	}
+	if _, err := os.Stat(localFilePath); !os.IsNotExist(err) {
+		t.Error("校验失败时不应生成目标文件")
+	}
+	if _, err := os.Stat(localFilePath + ".corrupt"); err != nil {
+		t.Errorf("校验失败的文件应当被隔离: %v", err)
+	}
+	if _, err := os.Stat(partMetaPath(partPath)); !os.IsNotExist(err) {
+		t.Error("校验失败后应当删除续传记录")
+	}
+
+	// 重新下载应当得到完整且校验通过的文件
+	if _, err := m.downloadFile(context.Background(), "data.bin", localFilePath, getOptions{}); err != nil {
+		t.Fatalf("重新下载失败: %v", err)
+	}
+	if data, _ := os.ReadFile(localFilePath); !bytes.Equal(data, content) {
+		t.Error("重新下载后的文件内容不匹配")
+	}
+}
+
+func TestDownloadFileCompressed(t *testing.T) {
+	storageRoot := t.TempDir()
+	stor, err := storage.NewLocalStorage(storageRoot, storage.SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	content := bytes.Repeat([]byte("compressible line of text\n"), 20000)
+	if err := os.WriteFile(filepath.Join(storageRoot, "log.txt"), content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	m := newTestManager(t, stor)
+	localDir := filepath.Join(m.dataRoot, "node1")
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+
+	for _, algorithm := range []string{compressionGzip, compressionZstd} {
+		m.transfer.Compression = algorithm
+		localFilePath := filepath.Join(localDir, "log-"+algorithm+".txt")
+		if _, err := m.downloadFile(context.Background(), "log.txt", localFilePath, getOptions{compress: true}); err != nil {
+			t.Fatalf("%s 压缩下载失败: %v", algorithm, err)
+		}
+		if data, _ := os.ReadFile(localFilePath); !bytes.Equal(data, content) {
+			t.Errorf("%s 压缩下载后的文件内容不匹配", algorithm)
+		}
+	}
+}
+
+func TestSplitRanges(t *testing.T) {
+	tests := []struct {
+		size   int64
+		jobs   int
+		ranges int
+	}{
+		{0, 4, 1},
+		{100, 4, 1},
+		{minRangeSize * 2, 4, 2},
+		{minRangeSize*10 + 7, 4, 4},
+	}
+	for _, tt := range tests {
+		ranges := splitRanges(tt.size, tt.jobs)
+		if len(ranges) != tt.ranges {
+			t.Errorf("splitRanges(%d, %d) 得到 %d 段，预期 %d", tt.size, tt.jobs, len(ranges), tt.ranges)
+			continue
+		}
+		// 各段应当首尾相连并覆盖整个文件
+		var next int64
+		for _, r := range ranges {
+			if r.offset != next {
+				t.Errorf("splitRanges(%d, %d) 的分段不连续: %+v", tt.size, tt.jobs, ranges)
+				break
+			}
+			next += r.length
+		}
+		if next != tt.size {
+			t.Errorf("splitRanges(%d, %d) 覆盖 %d 字节", tt.size, tt.jobs, next)
+		}
+	}
+}
+
+func TestDownloadFileRanges(t *testing.T) {
+	storageRoot := t.TempDir()
+	stor, err := storage.NewLocalStorage(storageRoot, storage.SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	content := make([]byte, 3*minRangeSize+12345)
+	rand.New(rand.NewSource(4)).Read(content)
+	if err := os.WriteFile(filepath.Join(storageRoot, "large.bin"), content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	m := newTestManager(t, stor)
+	localDir := filepath.Join(m.dataRoot, "node1")
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+
+	for _, opts := range []getOptions{{jobs: 4}, {jobs: 8, compress: true}} {
+		localFilePath := filepath.Join(localDir, "large.bin")
+		if _, err := m.downloadFile(context.Background(), "large.bin", localFilePath, opts); err != nil {
+			t.Fatalf("并发下载失败 %+v: %v", opts, err)
+		}
+		if data, _ := os.ReadFile(localFilePath); !bytes.Equal(data, content) {
+			t.Errorf("并发下载后的文件内容不匹配 %+v", opts)
+		}
+		if _, err := os.Stat(localFilePath + partSuffix); !os.IsNotExist(err) {
+			t.Error("下载完成后不应保留 .part 文件")
+		}
+		os.Remove(localFilePath)
+	}
+
+	// 远程文件不存在时不应留下任何本地文件
+	missing := filepath.Join(localDir, "missing.bin")
+	if _, err := m.downloadFile(context.Background(), "missing.bin", missing, getOptions{jobs: 4}); err == nil {
+		t.Error("下载不存在的文件应当失败")
+	}
+	if _, err := os.Stat(missing + partSuffix); !os.IsNotExist(err) {
+		t.Error("下载失败时不应保留 .part 文件")
+	}
+}
+
+func TestDownloadDirectory(t *testing.T) {
+	storageRoot := t.TempDir()
+	stor, err := storage.NewLocalStorage(storageRoot, storage.SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	files := map[string]string{
+		"dataset/a.csv":         "1,2,3",
+		"dataset/b.csv":         "4,5,6",
+		"dataset/sub/c.csv":     "7,8,9",
+		"dataset/sub/deep/d.md": "# d",
+	}
+	for name, content := range files {
+		p := filepath.Join(storageRoot, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("创建测试目录失败: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("写入测试文件失败: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(storageRoot, "dataset", "empty"), 0755); err != nil {
+		t.Fatalf("创建测试目录失败: %v", err)
+	}
+	m := newTestManager(t, stor)
+	localDir := filepath.Join(m.dataRoot, "node1", "dataset")
+
+	summary := m.downloadDirectory(context.Background(), "dataset", localDir, getOptions{parallel: 2})
+	if summary.files != 4 || summary.bytes != 18 || len(summary.failures) != 0 {
+		t.Fatalf("下载结果不正确: %s", summary)
+	}
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(m.dataRoot, "node1", filepath.FromSlash(name)))
+		if err != nil || string(data) != content {
+			t.Errorf("%s 内容不正确: %q, %v", name, data, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(localDir, "empty")); err != nil || !info.IsDir() {
+		t.Error("空目录也应当在本地创建")
+	}
+
+	// -s 跳过本地已存在且大小相同的文件
+	if err := os.WriteFile(filepath.Join(storageRoot, "dataset", "a.csv"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	summary = m.downloadDirectory(context.Background(), "dataset", localDir, getOptions{parallel: 2, skipExisting: true})
+	if summary.files != 1 || summary.skipped != 3 {
+		t.Fatalf("跳过已存在文件的结果不正确: %s", summary)
+	}
+	if data, _ := os.ReadFile(filepath.Join(localDir, "a.csv")); string(data) != "changed" {
+		t.Errorf("大小不同的文件应当重新下载，实际内容: %q", data)
+	}
+}
+
+func TestParseGetOptions(t *testing.T) {
+	opts, target, ok := parseGetOptions([]string{"-r", "-s", "-z", "-p", "8", "-j", "3", "dataset"})
+	if !ok || target != "dataset" || !opts.recursive || !opts.skipExisting || !opts.compress || opts.parallel != 8 || opts.jobs != 3 {
+		t.Errorf("解析结果不正确: %+v, %s, %v", opts, target, ok)
+	}
+	for _, args := range [][]string{{}, {"-p", "0", "a"}, {"-p"}, {"-j", "0", "a"}, {"-j"}, {"a", "b"}, {"-x", "a"}} {
+		if _, _, ok := parseGetOptions(args); ok {
+			t.Errorf("%v 应当解析失败", args)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	pb "ZFS/grpc"
+	"ZFS/storage"
+	"ZFS/utils"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errFindLimit 结果数达到请求中的上限时用于提前结束遍历
+var errFindLimit = errors.New("已达到结果数上限")
+
+// 单次 Find 遍历的上限，避免一个请求在很深或很大的目录树上长时间占用服务端；测试中会调小
+var (
+	maxFindDepth   = 64      // 相对于起点的最大深度，更深的条目不会被匹配
+	maxFindEntries = 1000000 // 最多检查的条目数，超出时结束遍历并返回 OutOfRange
+)
+
+// findDepth 返回 p 相对于起点 base 的深度，起点下的直接子项为 1
+func findDepth(base, p string) int {
+	if base != "" {
+		p = strings.TrimPrefix(p, base+"/")
+	}
+	return strings.Count(p, "/") + 1
+}
+
+// findMatcher Find请求中的过滤条件
+type findMatcher struct {
+	req   *pb.FindRequest
+	regex *regexp.Regexp
+}
+
+// newFindMatcher 检查请求中的条件，模式不合法时返回 InvalidArgument
+func newFindMatcher(req *pb.FindRequest) (*findMatcher, error) {
+	f := &findMatcher{req: req}
+	if req.GetName() != "" {
+		if _, err := path.Match(req.GetName(), ""); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "名称模式不合法: %s", req.GetName())
+		}
+	}
+	if req.GetRegex() != "" {
+		re, err := regexp.Compile(req.GetRegex())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "正则表达式不合法: %v", err)
+		}
+		f.regex = re
+	}
+	switch req.GetType() {
+	case "", "f", "d":
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "不支持的类型: %s", req.GetType())
+	}
+	return f, nil
+}
+
+// match 条目是否满足全部条件；大小条件只匹配文件，修改时间未知的条目不满足时间条件
+func (f *findMatcher) match(info storage.FileInfo) bool {
+	req := f.req
+	switch req.GetType() {
+	case "f":
+		if info.IsDirectory || info.IsSymlink {
+			return false
+		}
+	case "d":
+		if !info.IsDirectory {
+			return false
+		}
+	}
+	if req.GetName() != "" {
+		if ok, _ := path.Match(req.GetName(), info.Name); !ok {
+			return false
+		}
+	}
+	if f.regex != nil && !f.regex.MatchString(info.Name) {
+		return false
+	}
+	if req.GetMinSize() > 0 || req.GetMaxSize() > 0 {
+		if info.IsDirectory || info.Size < req.GetMinSize() {
+			return false
+		}
+		if req.GetMaxSize() > 0 && info.Size >= req.GetMaxSize() {
+			return false
+		}
+	}
+	if req.GetModifiedAfter() > 0 || req.GetModifiedBefore() > 0 {
+		if info.ModTime.IsZero() || info.ModTime.Unix() < req.GetModifiedAfter() {
+			return false
+		}
+		if req.GetModifiedBefore() > 0 && info.ModTime.Unix() >= req.GetModifiedBefore() {
+			return false
+		}
+	}
+	return true
+}
+
+// sizeUnits find -size 支持的单位，没有单位时按字节计算
+var sizeUnits = map[byte]int64{
+	'c': 1,
+	'k': 1 << 10,
+	'M': 1 << 20,
+	'G': 1 << 30,
+}
+
+// parseFindSize 解析 -size 的参数：+N 表示大于N，-N 表示小于N，N 表示按单位向下取整后等于N
+func parseFindSize(arg string, req *pb.FindRequest) bool {
+	sign, arg := findSign(arg)
+	unit := int64(1)
+	if n := len(arg); n > 0 {
+		if u, ok := sizeUnits[arg[n-1]]; ok {
+			unit = u
+			arg = arg[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	// (n+1)*unit 也不能溢出
+	if err != nil || n < 0 || n > math.MaxInt64/unit-1 {
+		return false
+	}
+	switch sign {
+	case '+':
+		req.MinSize = n*unit + 1
+	case '-':
+		// MaxSize为0表示不限，无法表示小于0
+		if n == 0 {
+			return false
+		}
+		req.MaxSize = n * unit
+	default:
+		req.MinSize = n * unit
+		req.MaxSize = (n + 1) * unit
+	}
+	return true
+}
+
+// mtimeUnits find -mtime 支持的单位，没有单位时按天计算
+var mtimeUnits = map[byte]time.Duration{
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+}
+
+// parseFindMtime 解析 -mtime 的参数：+N 表示N个单位之前，-N 表示N个单位以内，N 表示恰好N个单位前的那一段时间
+func parseFindMtime(arg string, now time.Time, req *pb.FindRequest) bool {
+	sign, arg := findSign(arg)
+	unit := 24 * time.Hour
+	if n := len(arg); n > 0 {
+		if u, ok := mtimeUnits[arg[n-1]]; ok {
+			unit = u
+			arg = arg[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	// (n+1)*unit 也不能超出 time.Duration 的范围
+	if err != nil || n < 0 || n > int64(math.MaxInt64/unit)-1 {
+		return false
+	}
+	before := func(k int64) int64 { return now.Add(-time.Duration(k) * unit).Unix() }
+	switch sign {
+	case '+':
+		req.ModifiedBefore = before(n + 1)
+	case '-':
+		if n == 0 {
+			return false
+		}
+		req.ModifiedAfter = before(n)
+	default:
+		req.ModifiedAfter = before(n + 1)
+		req.ModifiedBefore = before(n)
+	}
+	return true
+}
+
+func findSign(arg string) (byte, string) {
+	if strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-") {
+		return arg[0], arg[1:]
+	}
+	return 0, arg
+}
+
+// parseFindOptions 解析 find [目录] [-name 模式] [-regex 表达式] [-size N] [-mtime N] [-type f|d]
+func parseFindOptions(args []string, now time.Time) (*pb.FindRequest, string, bool) {
+	req := &pb.FindRequest{}
+	var dir string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		// 目录只能作为第一个参数
+		if !strings.HasPrefix(arg, "-") {
+			if i > 0 {
+				return nil, "", false
+			}
+			dir = arg
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, "", false
+		}
+		value := args[i+1]
+		i++
+		switch arg {
+		case "-name":
+			req.Name = value
+		case "-regex":
+			req.Regex = value
+		case "-size":
+			if !parseFindSize(value, req) {
+				return nil, "", false
+			}
+		case "-mtime":
+			if !parseFindMtime(value, now, req) {
+				return nil, "", false
+			}
+		case "-type":
+			if value != "f" && value != "d" {
+				return nil, "", false
+			}
+			req.Type = value
+		default:
+			return nil, "", false
+		}
+	}
+	return req, dir, true
+}
+
+// findFiles 调用 Find 并对每个匹配项调用fn，返回匹配项数量
+func findFiles(ctx context.Context, client pb.FileServiceClient, req *pb.FindRequest, fn func(*pb.FindResult)) (int, error) {
+	stream, err := client.Find(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+		fn(result)
+	}
+}
+
+// formatFindResult 以 find 的习惯显示匹配项：目录以 / 结尾，文件附带大小
+func formatFindResult(r *pb.FindResult) string {
+	if r.Entry.GetIsDirectory() {
+		return r.Path + "/"
+	}
+	return fmt.Sprintf("%s  %s", r.Path, utils.FormatFileSize(r.Entry.GetSize()))
+}
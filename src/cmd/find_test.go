@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"ZFS/utils"
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	pb "ZFS/grpc"
+)
+
+// writeFindTree 创建查找用的目录树，返回存储根目录
+func writeFindTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"report-2026-09.csv", 2048, 2 * time.Hour},
+		{"docs/report-2026-08.csv", 100, 40 * 24 * time.Hour},
+		{"docs/readme.md", 10, time.Hour},
+		{"docs/archive/big.bin", 3 << 20, 10 * 24 * time.Hour},
+		{"docs/archive/empty.txt", 0, time.Hour},
+	}
+	for _, f := range files {
+		p := filepath.Join(root, f.name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("创建目录失败: %v", err)
+		}
+		if err := os.WriteFile(p, make([]byte, f.size), 0644); err != nil {
+			t.Fatalf("写入文件失败: %v", err)
+		}
+		mtime := now.Add(-f.age)
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatalf("修改时间失败: %v", err)
+		}
+	}
+	return root
+}
+
+func findPaths(t *testing.T, client pb.FileServiceClient, req *pb.FindRequest) []string {
+	t.Helper()
+	var paths []string
+	_, err := findFiles(context.Background(), client, req, func(r *pb.FindResult) {
+		paths = append(paths, r.Path)
+	})
+	if err != nil {
+		t.Fatalf("Find 调用失败: %v", err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestFind(t *testing.T) {
+	root := writeFindTree(t)
+	client := pb.NewFileServiceClient(startTestServer(t, newTestFileServer(t, root).storage))
+	now := time.Now()
+	mtime := func(arg, typ string) *pb.FindRequest {
+		req := &pb.FindRequest{Type: typ}
+		if !parseFindMtime(arg, now, req) {
+			t.Fatalf("解析 -mtime %s 失败", arg)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.FindRequest
+		want []string
+	}{
+		{"glob", &pb.FindRequest{Name: "report-*.csv"}, []string{"docs/report-2026-08.csv", "report-2026-09.csv"}},
+		{"regex", &pb.FindRequest{Regex: `^report-\d{4}-09`}, []string{"report-2026-09.csv"}},
+		{"子目录", &pb.FindRequest{DirectoryPath: "docs/archive"}, []string{"docs/archive/big.bin", "docs/archive/empty.txt"}},
+		{"目录", &pb.FindRequest{Type: "d"}, []string{"docs", "docs/archive"}},
+		{"大于1M", &pb.FindRequest{MinSize: 1<<20 + 1}, []string{"docs/archive/big.bin"}},
+		{"空文件", &pb.FindRequest{MaxSize: 1}, []string{"docs/archive/empty.txt"}},
+		{"一天以内的文件", mtime("-1", "f"), []string{"docs/archive/empty.txt", "docs/readme.md", "report-2026-09.csv"}},
+		{"30天以前", mtime("+30", ""), []string{"docs/report-2026-08.csv"}},
+		{"组合条件", &pb.FindRequest{Name: "*.csv", MaxSize: 1024}, []string{"docs/report-2026-08.csv"}},
+	}
+	for _, tt := range tests {
+		got := findPaths(t, client, tt.req)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: 结果为 %v，期望 %v", tt.name, got, tt.want)
+		}
+	}
+
+	if got := findPaths(t, client, &pb.FindRequest{Type: "f", Limit: 2}); len(got) != 2 {
+		t.Errorf("limit 为2时返回了 %d 项", len(got))
+	}
+
+	for _, req := range []*pb.FindRequest{{Name: "[a"}, {Regex: "("}, {Type: "x"}} {
+		_, err := findFiles(context.Background(), client, req, func(*pb.FindResult) {})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%v 应当返回 InvalidArgument，实际: %v", req, err)
+		}
+	}
+	// 不能查找存储根目录之外的内容
+	if _, err := findFiles(context.Background(), client, &pb.FindRequest{DirectoryPath: "../"}, func(*pb.FindResult) {}); err == nil {
+		t.Error("查找存储根目录之外的目录应当失败")
+	}
+}
+
+type dummyFindServer struct {
+	grpc.ServerStream
+	ctx     context.Context
+	results []string
+}
+
+func (d *dummyFindServer) Send(r *pb.FindResult) error {
+	d.results = append(d.results, r.Path)
+	return nil
+}
+
+func (d *dummyFindServer) Context() context.Context {
+	return d.ctx
+}
+
+func TestFindAccessControl(t *testing.T) {
+	root := writeFindTree(t)
+	aclFile := filepath.Join(t.TempDir(), "acl.yaml")
+	rules := "name: root\nrules:\n- peers: [\"*\"]\n  allow: [list, read]\nchildren:\n- name: docs\n  children:\n  - name: archive\n    rules:\n    - peers: [node2]\n      deny: [list]\n"
+	if err := os.WriteFile(aclFile, []byte(rules), 0644); err != nil {
+		t.Fatalf("写入acl文件失败: %v", err)
+	}
+	tree, err := utils.LoadACL(aclFile)
+	if err != nil {
+		t.Fatalf("加载acl文件失败: %v", err)
+	}
+	s := newTestFileServer(t, root)
+	s.acl = newAccessControl(aclFile, tree, s.storage)
+
+	stream := &dummyFindServer{ctx: identityContext("node2")}
+	if err := s.Find(&pb.FindRequest{Type: "f"}, stream); err != nil {
+		t.Fatalf("Find 失败: %v", err)
+	}
+	sort.Strings(stream.results)
+	want := []string{"docs/readme.md", "docs/report-2026-08.csv", "report-2026-09.csv"}
+	if !reflect.DeepEqual(stream.results, want) {
+		t.Errorf("结果为 %v，期望 %v", stream.results, want)
+	}
+}
+
+func TestFindWalkLimits(t *testing.T) {
+	s := newTestFileServer(t, writeFindTree(t))
+	defer func(depth, entries int) { maxFindDepth, maxFindEntries = depth, entries }(maxFindDepth, maxFindEntries)
+
+	// 超过深度上限的条目不会被匹配
+	maxFindDepth = 1
+	stream := &dummyFindServer{ctx: context.Background()}
+	if err := s.Find(&pb.FindRequest{}, stream); err != nil {
+		t.Fatalf("Find 失败: %v", err)
+	}
+	sort.Strings(stream.results)
+	if want := []string{"docs", "report-2026-09.csv"}; !reflect.DeepEqual(stream.results, want) {
+		t.Errorf("结果为 %v，期望 %v", stream.results, want)
+	}
+	stream = &dummyFindServer{ctx: context.Background()}
+	if err := s.Find(&pb.FindRequest{DirectoryPath: "docs"}, stream); err != nil {
+		t.Fatalf("Find 失败: %v", err)
+	}
+	if len(stream.results) != 3 {
+		t.Errorf("深度应当相对于起点计算，结果为 %v", stream.results)
+	}
+
+	// 检查的条目超过上限时结束遍历
+	maxFindDepth, maxFindEntries = 64, 3
+	err := s.Find(&pb.FindRequest{}, &dummyFindServer{ctx: context.Background()})
+	if status.Code(err) != codes.OutOfRange {
+		t.Errorf("超出条目上限时应当返回 OutOfRange，实际: %v", err)
+	}
+}
+
+func TestParseFindOptions(t *testing.T) {
+	now := time.Unix(1_000_000_000, 0)
+	day := int64(24 * 60 * 60)
+	tests := []struct {
+		args []string
+		dir  string
+		want *pb.FindRequest
+		ok   bool
+	}{
+		{[]string{}, "", &pb.FindRequest{}, true},
+		{[]string{"docs", "-name", "*.csv", "-type", "f"}, "docs", &pb.FindRequest{Name: "*.csv", Type: "f"}, true},
+		{[]string{"-size", "+1M"}, "", &pb.FindRequest{MinSize: 1<<20 + 1}, true},
+		{[]string{"-size", "-10k"}, "", &pb.FindRequest{MaxSize: 10 << 10}, true},
+		{[]string{"-size", "0"}, "", &pb.FindRequest{MaxSize: 1}, true},
+		{[]string{"-size", "2k"}, "", &pb.FindRequest{MinSize: 2 << 10, MaxSize: 3 << 10}, true},
+		{[]string{"-mtime", "-7"}, "", &pb.FindRequest{ModifiedAfter: now.Unix() - 7*day}, true},
+		{[]string{"-mtime", "+7"}, "", &pb.FindRequest{ModifiedBefore: now.Unix() - 8*day}, true},
+		{[]string{"-mtime", "2h"}, "", &pb.FindRequest{ModifiedAfter: now.Unix() - 3*3600, ModifiedBefore: now.Unix() - 2*3600}, true},
+		{[]string{"-regex", "^a.*"}, "", &pb.FindRequest{Regex: "^a.*"}, true},
+		{[]string{"-name"}, "", nil, false},
+		{[]string{"-size", "-0"}, "", nil, false},
+		{[]string{"-size", "abc"}, "", nil, false},
+		// 换算成字节后超出 int64 的范围
+		{[]string{"-size", "9000000000G"}, "", nil, false},
+		{[]string{"-size", "+9223372036854775807"}, "", nil, false},
+		{[]string{"-mtime", "-200000000"}, "", nil, false},
+		{[]string{"-type", "l"}, "", nil, false},
+		{[]string{"-name", "*.csv", "docs"}, "", nil, false},
+		{[]string{"-depth", "1"}, "", nil, false},
+	}
+	for _, tt := range tests {
+		req, dir, ok := parseFindOptions(tt.args, now)
+		if ok != tt.ok {
+			t.Errorf("%v: ok = %v，期望 %v", tt.args, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if dir != tt.dir || req.Name != tt.want.Name || req.Regex != tt.want.Regex || req.Type != tt.want.Type ||
+			req.MinSize != tt.want.MinSize || req.MaxSize != tt.want.MaxSize ||
+			req.ModifiedAfter != tt.want.ModifiedAfter || req.ModifiedBefore != tt.want.ModifiedBefore {
+			t.Errorf("%v: 解析结果为 %q %v，期望 %q %v", tt.args, dir, req, tt.dir, tt.want)
+		}
+	}
+}
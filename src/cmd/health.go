@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	pb "ZFS/grpc"
+	"ZFS/storage"
+	"context"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"time"
+)
+
+// defaultHealthCheckInterval 默认的健康检查间隔
+const defaultHealthCheckInterval = 10 * time.Second
+
+// healthCheckTimeout 单次检查存储后端的超时时间
+const healthCheckTimeout = 5 * time.Second
+
+// healthMonitor 定期检查存储后端和 etcd 注册，并通过标准 gRPC 健康检查服务报告状态
+type healthMonitor struct {
+	server     *health.Server
+	storage    storage.Storage
+	registered func() bool
+}
+
+// newHealthMonitor registered 为nil时不检查 etcd 注册
+func newHealthMonitor(stor storage.Storage, registered func() bool) *healthMonitor {
+	return &healthMonitor{
+		server:     health.NewServer(),
+		storage:    stor,
+		registered: registered,
+	}
+}
+
+// healthCheckInterval 配置中的间隔为秒，未配置时使用默认值
+func healthCheckInterval(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultHealthCheckInterval
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// check 检查一次并更新整体和 FileService 的服务状态
+func (h *healthMonitor) check(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	status := healthpb.HealthCheckResponse_SERVING
+	if h.registered != nil && !h.registered() {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+		if err := h.storage.Ping(ctx); err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	h.server.SetServingStatus("", status)
+	h.server.SetServingStatus(pb.FileService_ServiceDesc.ServiceName, status)
+	return status
+}
+
+// run 立即检查一次，之后按间隔检查，直到ctx取消
+func (h *healthMonitor) run(ctx context.Context, interval time.Duration) {
+	h.check(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			h.server.Shutdown()
+			return
+		case <-ticker.C:
+			h.check(ctx)
+		}
+	}
+}
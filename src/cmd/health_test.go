@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"ZFS/storage"
+	"context"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	pb "ZFS/grpc"
+)
+
+// serveHealthCheck 启动只注册健康检查服务的服务端
+func serveHealthCheck(t *testing.T, monitor *healthMonitor) healthpb.HealthClient {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听端口失败: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, monitor.server)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := GetConn("node1", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("建立grpc连接失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func checkHealth(t *testing.T, client healthpb.HealthClient, service string, want healthpb.HealthCheckResponse_ServingStatus) {
+	t.Helper()
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("健康检查失败: %v", err)
+	}
+	if resp.GetStatus() != want {
+		t.Fatalf("服务 %q 的状态为 %v，期望 %v", service, resp.GetStatus(), want)
+	}
+}
+
+func TestHealthMonitor(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "storage")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	stor, err := storage.NewLocalStorage(root, storage.SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	var registered atomic.Bool
+	registered.Store(true)
+	monitor := newHealthMonitor(stor, registered.Load)
+	client := serveHealthCheck(t, monitor)
+	service := pb.FileService_ServiceDesc.ServiceName
+
+	if got := monitor.check(context.Background()); got != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("存储可用时状态为 %v", got)
+	}
+	checkHealth(t, client, "", healthpb.HealthCheckResponse_SERVING)
+	checkHealth(t, client, service, healthpb.HealthCheckResponse_SERVING)
+
+	// 存储根目录被删除
+	if err := os.RemoveAll(root); err != nil {
+		t.Fatalf("删除目录失败: %v", err)
+	}
+	monitor.check(context.Background())
+	checkHealth(t, client, "", healthpb.HealthCheckResponse_NOT_SERVING)
+	checkHealth(t, client, service, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	// 存储恢复后重新可用
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	monitor.check(context.Background())
+	checkHealth(t, client, service, healthpb.HealthCheckResponse_SERVING)
+
+	// etcd 注册失效
+	registered.Store(false)
+	monitor.check(context.Background())
+	checkHealth(t, client, service, healthpb.HealthCheckResponse_NOT_SERVING)
+}
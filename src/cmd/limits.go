@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"ZFS/config"
+	pb "ZFS/grpc"
+	"context"
+	"fmt"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultRetryAfter 超出并发上限时默认建议客户端等待的时间
+const defaultRetryAfter = time.Second
+
+const (
+	// peerIdleTimeout 调用方没有进行中的下载且空闲超过该时长后，移除其使用记录
+	peerIdleTimeout = 10 * time.Minute
+	// peerSweepInterval 清理空闲调用方记录的最短间隔
+	peerSweepInterval = time.Minute
+)
+
+// limiter 服务端下载的限速与并发准入控制，为nil时不做任何限制
+type limiter struct {
+	conf   config.LimitsConfig
+	global *rate.Limiter
+
+	mu      sync.Mutex
+	streams int
+	watches int
+	bytes   int64
+	peers   map[string]*peerUsage
+	swept   time.Time
+}
+
+// peerUsage 单个调用方的限速器和使用情况
+type peerUsage struct {
+	limiter *rate.Limiter
+	streams int
+	watches int
+	bytes   int64
+	// lastActive 最近一次归还名额的时间，用于清理空闲的记录
+	lastActive time.Time
+}
+
+func newLimiter(conf config.LimitsConfig) *limiter {
+	return &limiter{
+		conf:   conf,
+		global: newRateLimiter(conf.MaxBandwidth),
+		peers:  make(map[string]*peerUsage),
+	}
+}
+
+// newRateLimiter 创建按字节计数的令牌桶，突发量不超过一个最大分块，速率不大于0时返回nil
+func newRateLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	burst := bytesPerSecond
+	if burst > maxChunkSize {
+		burst = maxChunkSize
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(burst))
+}
+
+// callerKey 返回限速使用的调用方标识：优先使用证书中的身份，匿名调用方按地址区分
+func callerKey(ctx context.Context) string {
+	if identity := peerIdentity(ctx); identity != "" {
+		return identity
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return "anonymous@" + host
+		}
+	}
+	return "anonymous"
+}
+
+// admit 为调用方占用一个下载流名额，超出总数或该调用方的上限时返回 ResourceExhausted。
+// 被拒绝的调用方不会留下记录，避免任意地址的请求使记录无限增长
+func (l *limiter) admit(key string) (*downloadSlot, error) {
+	if l == nil {
+		return nil, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(time.Now())
+	usage := l.peers[key]
+	if l.conf.MaxStreams > 0 && l.streams >= l.conf.MaxStreams {
+		return nil, l.exhausted(fmt.Sprintf("服务端同时进行的下载已达上限 %d", l.conf.MaxStreams))
+	}
+	if l.conf.MaxPeerStreams > 0 && usage != nil && usage.streams >= l.conf.MaxPeerStreams {
+		return nil, l.exhausted(fmt.Sprintf("%s 同时进行的下载已达上限 %d", key, l.conf.MaxPeerStreams))
+	}
+	if usage == nil {
+		usage = &peerUsage{limiter: newRateLimiter(l.conf.MaxPeerBandwidth)}
+		l.peers[key] = usage
+	}
+	l.streams++
+	usage.streams++
+	return &downloadSlot{limiter: l, usage: usage}, nil
+}
+
+// admitWatch 为调用方占用一个监视名额（watch 或 tail -f），超出总数或该调用方的上限时返回 ResourceExhausted。
+// 返回的函数用于归还名额
+func (l *limiter) admitWatch(key string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(time.Now())
+	usage := l.peers[key]
+	if l.conf.MaxWatches > 0 && l.watches >= l.conf.MaxWatches {
+		return nil, l.exhausted(fmt.Sprintf("服务端同时进行的监视（watch、tail -f）已达上限 %d", l.conf.MaxWatches))
+	}
+	if l.conf.MaxPeerWatches > 0 && usage != nil && usage.watches >= l.conf.MaxPeerWatches {
+		return nil, l.exhausted(fmt.Sprintf("%s 同时进行的监视（watch、tail -f）已达上限 %d", key, l.conf.MaxPeerWatches))
+	}
+	if usage == nil {
+		usage = &peerUsage{limiter: newRateLimiter(l.conf.MaxPeerBandwidth)}
+		l.peers[key] = usage
+	}
+	l.watches++
+	usage.watches++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.watches--
+			usage.watches--
+			usage.lastActive = time.Now()
+		})
+	}, nil
+}
+
+// sweep 移除没有进行中的下载和目录监视且空闲超过 peerIdleTimeout 的调用方记录，调用方需持有 l.mu
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < peerSweepInterval {
+		return
+	}
+	l.swept = now
+	for key, usage := range l.peers {
+		if usage.streams == 0 && usage.watches == 0 && now.Sub(usage.lastActive) > peerIdleTimeout {
+			delete(l.peers, key)
+		}
+	}
+}
+
+// exhausted 构造带有重试间隔的 ResourceExhausted 错误
+func (l *limiter) exhausted(msg string) error {
+	retry := defaultRetryAfter
+	if l.conf.RetryAfter > 0 {
+		retry = time.Duration(l.conf.RetryAfter) * time.Second
+	}
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("%s，请 %d 秒后重试", msg, int(retry.Seconds())))
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retry)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// retryDelay 返回 ResourceExhausted 错误中服务端建议的重试间隔
+func retryDelay(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return defaultRetryAfter, true
+}
+
+// downloadSlot 一个已获准的下载流，发送数据前需要通过 wait 申请带宽
+type downloadSlot struct {
+	limiter *limiter
+	usage   *peerUsage
+	once    sync.Once
+}
+
+// wait 按调用方和全局的速率限制等待，直到可以发送 n 个字节
+func (s *downloadSlot) wait(ctx context.Context, n int) error {
+	if s == nil {
+		return nil
+	}
+	for remaining := n; remaining > 0; {
+		piece := remaining
+		for _, lim := range []*rate.Limiter{s.usage.limiter, s.limiter.global} {
+			if lim != nil && piece > lim.Burst() {
+				piece = lim.Burst()
+			}
+		}
+		for _, lim := range []*rate.Limiter{s.usage.limiter, s.limiter.global} {
+			if lim == nil {
+				continue
+			}
+			if err := lim.WaitN(ctx, piece); err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return ctxErr
+				}
+				return err
+			}
+		}
+		remaining -= piece
+	}
+	s.limiter.mu.Lock()
+	s.usage.bytes += int64(n)
+	s.limiter.bytes += int64(n)
+	s.limiter.mu.Unlock()
+	return nil
+}
+
+// release 归还下载流名额，可以重复调用
+func (s *downloadSlot) release() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		s.limiter.mu.Lock()
+		defer s.limiter.mu.Unlock()
+		s.limiter.streams--
+		s.usage.streams--
+		s.usage.lastActive = time.Now()
+	})
+}
+
+// snapshot 返回限速配置和当前使用情况
+func (l *limiter) snapshot() *pb.LimitsResponse {
+	if l == nil {
+		return &pb.LimitsResponse{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	resp := &pb.LimitsResponse{
+		MaxBandwidth:     l.conf.MaxBandwidth,
+		MaxPeerBandwidth: l.conf.MaxPeerBandwidth,
+		MaxStreams:       int32(l.conf.MaxStreams),
+		MaxPeerStreams:   int32(l.conf.MaxPeerStreams),
+		ActiveStreams:    int32(l.streams),
+		BytesSent:        l.bytes,
+		MaxWatches:       int32(l.conf.MaxWatches),
+		MaxPeerWatches:   int32(l.conf.MaxPeerWatches),
+		ActiveWatches:    int32(l.watches),
+	}
+	for key, usage := range l.peers {
+		resp.Peers = append(resp.Peers, &pb.PeerUsage{
+			Identity:      key,
+			ActiveStreams: int32(usage.streams),
+			BytesSent:     usage.bytes,
+			ActiveWatches: int32(usage.watches),
+		})
+	}
+	sort.Slice(resp.Peers, func(i, j int) bool { return resp.Peers[i].Identity < resp.Peers[j].Identity })
+	return resp
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"ZFS/config"
+	"bytes"
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "ZFS/grpc"
+)
+
+func TestLimiterAdmission(t *testing.T) {
+	l := newLimiter(config.LimitsConfig{MaxStreams: 3, MaxPeerStreams: 2, RetryAfter: 2})
+	a, err := l.admit("node1")
+	if err != nil {
+		t.Fatalf("第一个下载流应当被接受: %v", err)
+	}
+	if _, err := l.admit("node1"); err != nil {
+		t.Fatalf("第二个下载流应当被接受: %v", err)
+	}
+	_, err = l.admit("node1")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("超出每个调用方的上限时应当返回 ResourceExhausted，实际: %v", err)
+	}
+	if delay, ok := retryDelay(err); !ok || delay != 2*time.Second {
+		t.Errorf("重试间隔为 %v，预期 2s", delay)
+	}
+	if _, err := l.admit("node2"); err != nil {
+		t.Fatalf("其他调用方应当被接受: %v", err)
+	}
+	if _, err := l.admit("node3"); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("超出总上限时应当返回 ResourceExhausted，实际: %v", err)
+	}
+
+	a.release()
+	a.release() // 重复归还不应影响计数
+	if _, err := l.admit("node3"); err != nil {
+		t.Fatalf("归还名额后应当被接受: %v", err)
+	}
+	snapshot := l.snapshot()
+	if snapshot.ActiveStreams != 3 || len(snapshot.Peers) != 3 || snapshot.Peers[0].Identity != "node1" || snapshot.Peers[0].ActiveStreams != 1 {
+		t.Errorf("使用情况不正确: %+v", snapshot)
+	}
+
+	// 被拒绝的调用方不留下记录，空闲的记录在超时后被移除
+	l.admit("node4")
+	if _, ok := l.peers["node4"]; ok {
+		t.Error("被拒绝的调用方不应留下记录")
+	}
+	l.peers["node2"].lastActive = time.Now().Add(-2 * peerIdleTimeout)
+	l.peers["node2"].streams = 0
+	l.swept = time.Time{}
+	l.sweep(time.Now())
+	if _, ok := l.peers["node2"]; ok {
+		t.Error("空闲超时的调用方记录应当被移除")
+	}
+	if _, ok := l.peers["node1"]; !ok {
+		t.Error("有进行中下载的调用方记录不应被移除")
+	}
+
+	var unlimited *limiter
+	slot, err := unlimited.admit("node1")
+	if err != nil || slot.wait(context.Background(), 1<<30) != nil {
+		t.Error("没有配置限速时不应限制")
+	}
+	slot.release()
+	if _, ok := retryDelay(os.ErrNotExist); ok {
+		t.Error("其他错误不应被当作可重试")
+	}
+}
+
+func TestDownloadFileBandwidthLimit(t *testing.T) {
+	storageRoot := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 24*1024) // 384KiB
+	if err := os.WriteFile(filepath.Join(storageRoot, "data.bin"), content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	s := newTestFileServer(t, storageRoot)
+	s.limits = newLimiter(config.LimitsConfig{MaxPeerBandwidth: 256 * 1024})
+
+	// 突发量为一秒的流量，剩余的 128KiB 需要等待约 0.5 秒
+	start := time.Now()
+	stream := &dummyDownloadFileServer{ctx: context.Background()}
+	if err := s.DownloadFile(&pb.DownloadFileRequest{FilePath: "data.bin"}, stream); err != nil {
+		t.Fatalf("DownloadFile 返回错误: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("限速后下载耗时 %v，预期至少 400ms", elapsed)
+	}
+	resp, err := s.Limits(context.Background(), &pb.LimitsRequest{})
+	if err != nil {
+		t.Fatalf("Limits 返回错误: %v", err)
+	}
+	if resp.BytesSent != int64(len(content)) || resp.ActiveStreams != 0 || resp.MaxPeerBandwidth != 256*1024 {
+		t.Errorf("使用情况不正确: %+v", resp)
+	}
+
+	// 已取消的请求在等待带宽时立即结束
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.DownloadFile(&pb.DownloadFileRequest{FilePath: "data.bin"}, &dummyDownloadFileServer{ctx: ctx}); err == nil {
+		t.Error("请求取消后下载应当失败")
+	}
+}
+
+func TestDownloadRetriesWhenBusy(t *testing.T) {
+	storageRoot := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789abcdef"), (3*minRangeSize+4096)/16)
+	if err := os.WriteFile(filepath.Join(storageRoot, "large.bin"), content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	s := newTestFileServer(t, storageRoot)
+	s.limits = newLimiter(config.LimitsConfig{MaxStreams: 2, RetryAfter: 1})
+	m := newTestManager(t, s.storage)
+	m.currentConn, _ = serveTestFileServer(t, s)
+	localFilePath := filepath.Join(m.dataRoot, "node1", "large.bin")
+	if err := os.MkdirAll(filepath.Dir(localFilePath), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+
+	// 四段中有两段超出并发上限，应当等待后重试而不是整体失败
+	if _, err := m.downloadFile(context.Background(), "large.bin", localFilePath, getOptions{jobs: 4}); err != nil {
+		t.Fatalf("并发下载应当在重试后成功: %v", err)
+	}
+	if data, _ := os.ReadFile(localFilePath); !bytes.Equal(data, content) {
+		t.Error("并发下载后的文件内容不匹配")
+	}
+	os.Remove(localFilePath)
+
+	// 名额被占满时单个文件的下载同样等待重试
+	busy, err := s.limits.admit("other")
+	if err != nil {
+		t.Fatalf("占用名额失败: %v", err)
+	}
+	defer busy.release()
+	held, err := s.limits.admit("other")
+	if err != nil {
+		t.Fatalf("占用名额失败: %v", err)
+	}
+	time.AfterFunc(200*time.Millisecond, held.release)
+	if out := get(m, []string{"large.bin"}); !strings.Contains(out, "文件下载成功") {
+		t.Fatalf("get 应当在重试后成功: %s", out)
+	}
+	if data, _ := os.ReadFile(localFilePath); !bytes.Equal(data, content) {
+		t.Error("下载后的文件内容不匹配")
+	}
+}
+
+func TestFormatLimits(t *testing.T) {
+	out := formatLimits(&pb.LimitsResponse{
+		MaxPeerBandwidth: 1024 * 1024,
+		MaxStreams:       8,
+		ActiveStreams:    1,
+		MaxWatches:       64,
+		ActiveWatches:    3,
+		Peers:            []*pb.PeerUsage{{Identity: "node1", ActiveStreams: 1, BytesSent: 2048, ActiveWatches: 3}},
+	})
+	for _, want := range []string{"总计 不限，每个调用方 1.00MB/s", "总计 8，每个调用方 不限", "监视上限：总计 64，每个调用方 不限", "当前监视：3", "node1", "监视 3"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出中缺少 %q:\n%s", want, out)
+		}
+	}
+}
@@ -26,11 +26,6 @@ func Start() {
 	}
 	logger.InitLogger(conf)
 	logger.Log.Info("日志模块初始化成功")
-	root := utils.InitACL("acl.yaml")
-	if root != nil {
-
-	}
-	logger.Log.Info("ACL模块初始化成功")
 	etcdEndpoint := conf.Etcd.EtcdEndpoints
 	serviceAddr := conf.Etcd.Address
 	ttl := conf.Etcd.TTL
@@ -47,24 +42,33 @@ func Start() {
 		log.Fatalf("初始化存储层失败: %v", err)
 	}
 	logger.Log.Info("存储层初始化成功", zap.String("type", conf.Storage.Type))
+	acl := newAccessControl("acl.yaml", utils.InitACL("acl.yaml"), stor)
+	logger.Log.Info("ACL模块初始化成功")
+	if err := setupTLS(conf.TLS); err != nil {
+		logger.Log.Error("加载TLS证书失败", zap.Error(err))
+		log.Fatalf("加载TLS证书失败: %v", err)
+	}
 	
-	cleanup, err := etcd.RegisterService(ctx, etcdEndpoint, serviceAddr, nodeName, int64(ttl), dialTimeout)
+	registration, err := etcd.Register(ctx, etcdEndpoint, serviceAddr, nodeName, int64(ttl), dialTimeout)
 	if err != nil {
 		logger.Log.Error("服务注册失败", zap.Error(err))
 		log.Fatalf("服务注册失败: %v", err)
 	}
+	monitor := newHealthMonitor(stor, registration.Active)
 	go func() {
 		if err := etcd.DiscoverService(ctx, etcdEndpoint, &nodes); err != nil {
 			logger.Log.Error("服务发现异常", zap.Error(err))
 		}
 	}()
-	go StartServer(conf.Etcd.Address, stor)
+	go acl.watch(ctx, aclReloadInterval)
+	go monitor.run(ctx, healthCheckInterval(conf.GRPC.HealthCheckInterval))
+	go StartServer(conf.Etcd.Address, stor, conf, acl, monitor)
 	ch := make(chan string)
 	dataRoot := conf.Storage.DataRoot
 	if dataRoot == "" {
 		dataRoot = "./data"
 	}
-	manager := NewManager("root", &nodes, dataRoot)
+	manager := NewManager("root", &nodes, dataRoot, conf.Transfer)
 	mutex := make(chan struct{})
 	go func() {
 		mutex <- struct{}{}
@@ -100,5 +104,5 @@ func Start() {
 			mutex <- struct{}{}
 		}()
 	}
-	cleanup()
+	registration.Cleanup()
 }
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	pb "ZFS/grpc"
+	"ZFS/utils"
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Version 构建版本，发布时通过 -ldflags "-X ZFS/cmd.Version=v1.2.0" 设置
+var Version = "dev"
+
+// protocolVersion 协议版本，新增RPC或改变已有RPC的语义时递增；
+// 不支持 GetNodeInfo 的节点视为协议版本0
+const protocolVersion = 4
+
+// GetNodeInfo 返回的功能名称，客户端在调用对应的RPC前据此判断对方节点是否支持
+const (
+	featureUpload            = "upload"             // UploadFile
+	featureUploadCompression = "upload-compression" // UploadFile 接收压缩后的数据分块
+	featureCompression       = "compression"        // DownloadFile 压缩传输
+	featureRanges            = "ranges"             // DownloadFile 按偏移量和长度读取，用于续传和多段并发下载
+	featureChecksum          = "checksum"           // Checksum
+	featureCopy              = "copy"               // CopyFrom，需要本节点启用服务发现
+	featureLimits            = "limits"             // Limits
+	featureWatch             = "watch"              // WatchDirectory
+	featureFind              = "find"               // Find
+	featureUsage             = "usage"              // Usage
+	featureCapacity          = "capacity"           // Capacity
+	featureFollow            = "follow"             // DownloadFile 的 follow 模式，用于 tail -f
+)
+
+// nodeInfoTimeout 建立连接时查询节点信息的超时时间
+const nodeInfoTimeout = 3 * time.Second
+
+// nodeInfoTTL 节点信息的缓存时间，在此期间重新进入同一节点不再查询（查询时对方需要统计存储容量）
+const nodeInfoTTL = 5 * time.Minute
+
+// cachedNodeInfo 缓存的节点信息，节点地址变化时失效
+type cachedNodeInfo struct {
+	addr    string
+	info    *pb.GetNodeInfoResponse
+	fetched time.Time
+}
+
+// features 本节点启用的功能
+func (s *FileServer) features() []string {
+	features := []string{featureUpload, featureUploadCompression, featureCompression, featureRanges, featureChecksum, featureLimits, featureWatch, featureFind, featureUsage, featureCapacity, featureFollow}
+	if s.nodes != nil {
+		features = append(features, featureCopy)
+	}
+	return features
+}
+
+// GetNodeInfo 返回本节点的版本、存储和启用的功能。
+// 该请求不受访问控制，存储根路径（服务器上的绝对路径或存储桶）和容量与 Capacity 一样，
+// 只返回给有权查看存储根目录的调用方
+func (s *FileServer) GetNodeInfo(ctx context.Context, req *pb.GetNodeInfoRequest) (*pb.GetNodeInfoResponse, error) {
+	resp := &pb.GetNodeInfoResponse{
+		Version:         Version,
+		ProtocolVersion: protocolVersion,
+		NodeName:        s.nodeName,
+		StorageType:     s.storage.Type(),
+		Features:        s.features(),
+	}
+	if !s.acl.allows(ctx, "", utils.ACLList) {
+		return s.withUptime(resp), nil
+	}
+	resp.Root = s.storage.GetRoot()
+	// 容量只是参考信息，查询失败时按未知返回
+	if capacity, err := s.storage.Capacity(ctx); err == nil {
+		resp.Capacity = capacity.Total
+		resp.Free = capacity.Free
+	}
+	return s.withUptime(resp), nil
+}
+
+func (s *FileServer) withUptime(resp *pb.GetNodeInfoResponse) *pb.GetNodeInfoResponse {
+	if !s.started.IsZero() {
+		resp.Uptime = int64(time.Since(s.started).Seconds())
+	}
+	return resp
+}
+
+// fetchNodeInfo 查询对方节点的信息，对方节点不支持 GetNodeInfo 时返回 nil
+func fetchNodeInfo(ctx context.Context, client pb.FileServiceClient) (*pb.GetNodeInfoResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, nodeInfoTimeout)
+	defer cancel()
+	info, err := client.GetNodeInfo(ctx, &pb.GetNodeInfoRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil, nil
+	}
+	return info, err
+}
+
+// nodeInfo 返回地址为 addr 的节点 node 的信息，nodeInfoTTL 内使用缓存；对方节点不支持 GetNodeInfo 时返回 nil。
+// 查询失败时不缓存，下次进入节点时重试
+func (m *Manager) nodeInfo(node, addr string, client pb.FileServiceClient) (*pb.GetNodeInfoResponse, error) {
+	if cached, ok := m.nodeInfos[node]; ok && cached.addr == addr && time.Since(cached.fetched) < nodeInfoTTL {
+		return cached.info, nil
+	}
+	info, err := fetchNodeInfo(context.Background(), client)
+	if err != nil {
+		return nil, err
+	}
+	m.cacheNodeInfo(node, addr, info)
+	return info, nil
+}
+
+// cacheNodeInfo 记录节点信息，供之后进入同一节点时使用
+func (m *Manager) cacheNodeInfo(node, addr string, info *pb.GetNodeInfoResponse) {
+	if m.nodeInfos == nil {
+		m.nodeInfos = make(map[string]cachedNodeInfo)
+	}
+	m.nodeInfos[node] = cachedNodeInfo{addr: addr, info: info, fetched: time.Now()}
+}
+
+// supports 当前节点是否支持feature；对方节点版本过旧、没有提供节点信息时假定支持，
+// 由服务端返回的 Unimplemented 提示用户
+func (m *Manager) supports(feature string) bool {
+	return m.peer == nil || slices.Contains(m.peer.Features, feature)
+}
+
+// requireFeature 当前节点不支持feature时返回错误信息，否则返回空字符串
+func (m *Manager) requireFeature(feature string) string {
+	if m.supports(feature) {
+		return ""
+	}
+	return ErrorMsg(fmt.Sprintf("对方节点版本过旧（%s），不支持该操作", m.peer.Version))
+}
+
+// info 显示当前节点的版本、存储类型、容量和启用的功能
+func info(m *Manager, args []string) string {
+	if len(args) != 0 {
+		return ErrorMsg("info 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	resp, err := fetchNodeInfo(context.Background(), pb.NewFileServiceClient(m.currentConn))
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("远程调用出错：%s", describeError(err)))
+	}
+	if resp == nil {
+		return ErrorMsg("对方节点版本过旧，不支持查询节点信息")
+	}
+	m.peer = resp
+	if addr, ok := m.nodes.Load(m.currentNode); ok {
+		m.cacheNodeInfo(m.currentNode, addr.(string), resp)
+	}
+	return formatNodeInfo(resp)
+}
+
+func formatNodeInfo(resp *pb.GetNodeInfoResponse) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("节点：%s\n", resp.NodeName))
+	sb.WriteString(fmt.Sprintf("版本：%s（协议版本 %d）\n", resp.Version, resp.ProtocolVersion))
+	if resp.Root != "" {
+		sb.WriteString(fmt.Sprintf("存储：%s %s\n", resp.StorageType, resp.Root))
+	} else {
+		sb.WriteString(fmt.Sprintf("存储：%s\n", resp.StorageType))
+	}
+	if resp.Capacity > 0 {
+		sb.WriteString(fmt.Sprintf("容量：%s，可用 %s\n", utils.FormatFileSize(resp.Capacity), utils.FormatFileSize(resp.Free)))
+	} else {
+		sb.WriteString("容量：未知\n")
+	}
+	sb.WriteString(fmt.Sprintf("已运行：%s\n", time.Duration(resp.Uptime)*time.Second))
+	sb.WriteString(fmt.Sprintf("功能：%s", strings.Join(resp.Features, " ")))
+	return sb.String()
+}
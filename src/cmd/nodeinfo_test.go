@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"ZFS/config"
+	"ZFS/utils"
+	"google.golang.org/grpc"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "ZFS/grpc"
+)
+
+// legacyFileServer 模拟不支持任何新RPC的旧版本节点
+type legacyFileServer struct {
+	pb.UnimplementedFileServiceServer
+}
+
+func TestGetNodeInfo(t *testing.T) {
+	root := t.TempDir()
+	s := newTestFileServer(t, root)
+	s.nodeName = "node1"
+	s.started = time.Now().Add(-time.Minute)
+	_, addr := serveTestFileServer(t, s)
+
+	var nodes sync.Map
+	nodes.Store("node1", addr)
+	m := NewManager("root", &nodes, t.TempDir(), config.TransferConfig{})
+	if msg := cd(m, []string{"node1"}); msg != "" {
+		t.Fatalf("cd 失败: %s", msg)
+	}
+	peer := m.peer
+	if peer == nil {
+		t.Fatal("进入节点时应当查询节点信息")
+	}
+	if peer.NodeName != "node1" || peer.StorageType != "local" || peer.Root != root || peer.ProtocolVersion != protocolVersion {
+		t.Errorf("节点信息不正确: %+v", peer)
+	}
+	if peer.Uptime < 60 {
+		t.Errorf("运行时间为 %d 秒", peer.Uptime)
+	}
+	if peer.Capacity <= 0 || peer.Free <= 0 || peer.Free > peer.Capacity {
+		t.Errorf("本地存储的容量不正确: %d/%d", peer.Free, peer.Capacity)
+	}
+	// 没有启用服务发现的节点不支持节点间复制
+	if !m.supports(featureFind) || m.supports(featureCopy) {
+		t.Errorf("功能列表不正确: %v", peer.Features)
+	}
+	if out := info(m, nil); !strings.Contains(out, "节点：node1") || !strings.Contains(out, "存储：local "+root) {
+		t.Errorf("info 的输出不正确:\n%s", out)
+	}
+
+	// 无权查看存储根目录的调用方看不到服务器上的路径和容量
+	s.acl = newAccessControl(filepath.Join(t.TempDir(), "acl.yaml"), &utils.ZFSNode{
+		Name:  "root",
+		Rules: []utils.ACLRule{{Peers: []string{"node2"}, Allow: []string{utils.ACLList}}},
+	}, nil)
+	if resp, err := s.GetNodeInfo(identityContext("node3"), &pb.GetNodeInfoRequest{}); err != nil || resp.Root != "" || resp.Capacity != 0 || resp.StorageType != "local" {
+		t.Errorf("无权的调用方得到的节点信息: %+v, %v", resp, err)
+	}
+	if resp, err := s.GetNodeInfo(identityContext("node2"), &pb.GetNodeInfoRequest{}); err != nil || resp.Root != root {
+		t.Errorf("有权的调用方应当得到存储根路径: %+v, %v", resp, err)
+	}
+	if out := formatNodeInfo(&pb.GetNodeInfoResponse{StorageType: "local"}); !strings.Contains(out, "存储：local\n") {
+		t.Errorf("没有存储根路径时的输出不正确:\n%s", out)
+	}
+
+	// 对方节点没有列出的功能在调用前直接报告
+	m.peer.Features = []string{featureUpload}
+	m.peer.Version = "v0.9.0"
+	if out := find(m, nil); out != ErrorMsg("对方节点版本过旧（v0.9.0），不支持该操作") {
+		t.Errorf("find 的输出为 %q", out)
+	}
+
+	// 返回上一级时断开连接并清除节点信息
+	cd(m, []string{".."})
+	if m.peer != nil || m.currentConn != nil {
+		t.Error("离开节点后应当清除节点信息")
+	}
+}
+
+func TestGetNodeInfoLegacyPeer(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听端口失败: %v", err)
+	}
+	grpcServer := grpc.NewServer(serverOptions()...)
+	pb.RegisterFileServiceServer(grpcServer, &legacyFileServer{})
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	var nodes sync.Map
+	nodes.Store("old", lis.Addr().String())
+	m := NewManager("root", &nodes, t.TempDir(), config.TransferConfig{})
+	if msg := cd(m, []string{"old"}); msg != "" {
+		t.Fatalf("进入旧版本节点失败: %s", msg)
+	}
+	if m.peer != nil {
+		t.Fatal("旧版本节点不应有节点信息")
+	}
+	if out := info(m, nil); out != ErrorMsg("对方节点版本过旧，不支持查询节点信息") {
+		t.Errorf("info 的输出为 %q", out)
+	}
+	// 没有节点信息时照常调用，由 Unimplemented 给出提示
+	if out := find(m, nil); out != ErrorMsg("查找失败：对方节点版本过旧，不支持该操作") {
+		t.Errorf("find 的输出为 %q", out)
+	}
+}
+
+func TestNodeInfoCache(t *testing.T) {
+	_, addr := serveTestFileServer(t, newTestFileServer(t, t.TempDir()))
+	var nodes sync.Map
+	nodes.Store("node1", addr)
+	m := NewManager("root", &nodes, t.TempDir(), config.TransferConfig{})
+	if msg := cd(m, []string{"node1"}); msg != "" || m.peer == nil {
+		t.Fatalf("cd 失败: %s", msg)
+	}
+
+	// 重新进入同一节点时使用缓存的信息
+	m.peer.Version = "cached"
+	cd(m, []string{".."})
+	cd(m, []string{"node1"})
+	if m.peer == nil || m.peer.Version != "cached" {
+		t.Errorf("重新进入节点时应当使用缓存: %+v", m.peer)
+	}
+
+	// 缓存过期后重新查询
+	cached := m.nodeInfos["node1"]
+	cached.fetched = time.Now().Add(-2 * nodeInfoTTL)
+	m.nodeInfos["node1"] = cached
+	cd(m, []string{".."})
+	cd(m, []string{"node1"})
+	if m.peer == nil || m.peer.Version != Version {
+		t.Errorf("缓存过期后应当重新查询: %+v", m.peer)
+	}
+}
+
+func TestCopyRequiresFeature(t *testing.T) {
+	// 没有启用服务发现的节点不能作为复制的目标
+	_, addr := serveTestFileServer(t, newTestFileServer(t, t.TempDir()))
+	var nodes sync.Map
+	nodes.Store("node1", addr)
+	nodes.Store("node2", addr)
+	m := NewManager("root", &nodes, t.TempDir(), config.TransferConfig{})
+	if out := cp(m, []string{"node1/a.txt", "node2/a.txt"}); out != ErrorMsg("目标节点 node2 不支持复制（版本过旧或未启用服务发现）") {
+		t.Errorf("cp 的输出为 %q", out)
+	}
+}
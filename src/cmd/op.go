@@ -1,15 +1,22 @@
 package cmd
 
 import (
+	"ZFS/config"
 	pb "ZFS/grpc"
 	"ZFS/utils"
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"google.golang.org/grpc"
 	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -21,7 +28,10 @@ type Manager struct {
 	nodes        *sync.Map
 	currentNode  string
 	currentConn  *grpc.ClientConn
-	dataRoot     string // 下载文件保存目录
+	dataRoot     string                    // 下载文件保存目录
+	transfer     config.TransferConfig     // 传输配置，决定 get -z 使用的压缩算法
+	peer         *pb.GetNodeInfoResponse   // 当前节点的信息，对方节点版本过旧或查询失败时为nil
+	nodeInfos    map[string]cachedNodeInfo // 各节点信息的缓存，避免每次进入节点都重新查询
 }
 
 func ErrorMsg(msg string) string {
@@ -30,7 +40,7 @@ func ErrorMsg(msg string) string {
 
 type Command func(manager *Manager, args []string) string
 
-func NewManager(nodeName string, nodes *sync.Map, dataRoot string) *Manager {
+func NewManager(nodeName string, nodes *sync.Map, dataRoot string, transfer config.TransferConfig) *Manager {
 	if dataRoot == "" {
 		dataRoot = "./data"
 	}
@@ -39,9 +49,18 @@ func NewManager(nodeName string, nodes *sync.Map, dataRoot string) *Manager {
 		nodes:        nodes,
 		relativePath: []string{},
 		dataRoot:     dataRoot,
+		transfer:     transfer,
 	}
 }
 
+// compression 返回 get -z 向服务端请求的压缩算法
+func (m *Manager) compression() string {
+	if m.transfer.Compression == "" {
+		return compressionZstd
+	}
+	return strings.ToLower(m.transfer.Compression)
+}
+
 func (m *Manager) updateConnection() string {
 	if len(m.relativePath) == 0 {
 		if m.currentConn != nil {
@@ -51,6 +70,7 @@ func (m *Manager) updateConnection() string {
 			}
 			m.currentConn = nil
 			m.currentNode = ""
+			m.peer = nil
 		}
 		return ""
 	}
@@ -62,18 +82,21 @@ func (m *Manager) updateConnection() string {
 				log.Fatal("关闭grpc连接出错")
 			}
 			m.currentConn = nil
+			m.peer = nil
 		}
 		addrVal, ok := m.nodes.Load(newNode)
 		if !ok {
 			return ErrorMsg("指定节点不存在")
 		}
 		addr := addrVal.(string)
-		conn, err := GetConn(addr)
+		conn, err := GetConn(newNode, addr)
 		if err != nil {
 			log.Fatal("建立grpc连接出错")
 		}
 		m.currentConn = conn
 		m.currentNode = newNode
+		// 节点信息只用于判断对方支持的功能，查询失败时不影响进入节点，由之后的命令报告错误
+		m.peer, _ = m.nodeInfo(newNode, addr, pb.NewFileServiceClient(conn))
 	}
 	return ""
 }
@@ -87,6 +110,14 @@ func (m *Manager) prefix() string {
 	return ret
 }
 
+// remotePath 将文件名拼接为相对于当前远程节点存储根目录的路径
+func (m *Manager) remotePath(name string) string {
+	if len(m.relativePath) > 1 {
+		return fmt.Sprintf("%s/%s", strings.Join(m.relativePath[1:], "/"), name)
+	}
+	return name
+}
+
 func (m *Manager) interpret(command string) string {
 	parts := strings.Split(command, " ")
 	fn, ok := CommandMap[parts[0]]
@@ -145,64 +176,345 @@ func cd(m *Manager, args []string) string {
 	return ""
 }
 
+// getOptions get 命令的选项
+type getOptions struct {
+	resume       bool // -c 必须从上次中断的位置续传
+	recursive    bool // -r 递归下载目录
+	skipExisting bool // -s 跳过本地已存在且大小相同的文件
+	parallel     int  // -p N 递归下载时的并发数
+	compress     bool // -z 请求服务端压缩传输
+	jobs         int  // -j N 将单个文件拆分为 N 段并发下载
+}
+
+func parseGetOptions(args []string) (getOptions, string, bool) {
+	opts := getOptions{parallel: defaultParallel}
+	var target string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-c":
+			opts.resume = true
+		case "-r":
+			opts.recursive = true
+		case "-s":
+			opts.skipExisting = true
+		case "-z":
+			opts.compress = true
+		case "-p":
+			if i+1 >= len(args) {
+				return opts, "", false
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return opts, "", false
+			}
+			opts.parallel = n
+			i++
+		case "-j":
+			if i+1 >= len(args) {
+				return opts, "", false
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return opts, "", false
+			}
+			opts.jobs = n
+			i++
+		default:
+			if target != "" || strings.HasPrefix(args[i], "-") {
+				return opts, "", false
+			}
+			target = args[i]
+		}
+	}
+	return opts, target, target != ""
+}
+
+// get 下载远程文件，-c 表示必须从上次中断的位置续传；-r 递归下载目录，可配合 -s 和 -p N 使用；
+// -z 请求服务端压缩传输，服务端认为压缩没有收益时按原样发送；-j N 将大文件拆分为 N 段并发下载
 func get(m *Manager, args []string) string {
-	if len(args) != 1 {
+	opts, target, ok := parseGetOptions(args)
+	if !ok || (opts.recursive && opts.resume) || (opts.jobs > 1 && opts.resume) {
 		return ErrorMsg("get 输入不合法")
 	}
 	if len(m.relativePath) == 0 || m.currentConn == nil {
 		return ErrorMsg("未指定节点或未建立 RPC 连接")
 	}
-	var remoteDir string
-	if len(m.relativePath) > 1 {
-		remoteDir = strings.Join(m.relativePath[1:], "/")
+	if opts.resume {
+		if msg := m.requireFeature(featureRanges); msg != "" {
+			return msg
+		}
 	}
-	remotePath := args[0]
-	if remoteDir != "" {
-		remotePath = fmt.Sprintf("%s/%s", remoteDir, args[0])
+	remotePath := m.remotePath(target)
+	localFilePath := filepath.Join(m.dataRoot, m.currentNode, target)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if opts.recursive {
+		return m.downloadDirectory(ctx, remotePath, localFilePath, opts).String()
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// 确保目录存在
+	if err := os.MkdirAll(filepath.Dir(localFilePath), os.ModePerm); err != nil {
+		return ErrorMsg(fmt.Sprintf("创建目录失败：%v", err))
+	}
+	// 服务端并发已满时按建议的间隔重试，多段下载的各段已分别重试
+	var offset int64
+	err := retryAdmission(ctx, func() error {
+		var err error
+		offset, err = m.downloadFile(ctx, remotePath, localFilePath, opts)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errNothingToResume) || errors.Is(err, errRemoteChanged) || errors.Is(err, errIntegrity) {
+			return ErrorMsg(err.Error())
+		}
+		return ErrorMsg(fmt.Sprintf("%s（重新执行 get 可从断点继续）", describeError(err)))
+	}
+	if offset > 0 {
+		return fmt.Sprintf("文件下载成功（从 %s 处续传）", utils.FormatFileSize(offset))
+	}
+	return fmt.Sprintf("文件下载成功")
+}
+
+func put(m *Manager, args []string) string {
+	compress := len(args) > 0 && args[0] == "-z"
+	if compress {
+		args = args[1:]
+	}
+	if len(args) != 1 && len(args) != 2 {
+		return ErrorMsg("put 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	if msg := m.requireFeature(featureUpload); msg != "" {
+		return msg
+	}
+	localFilePath := args[0]
+	remoteName := filepath.Base(localFilePath)
+	if len(args) == 2 {
+		remoteName = args[1]
+	}
+	file, err := os.Open(localFilePath)
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("打开本地文件失败：%v", err))
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("读取本地文件信息失败：%v", err))
+	}
+	if info.IsDir() {
+		return ErrorMsg("put 不支持上传目录")
+	}
+	// 不提供节点信息的旧节点不认识压缩字段，会将压缩后的数据原样保存，因此要求对方明确支持
+	var compression string
+	if compress && m.peer != nil && m.supports(featureUploadCompression) {
+		worth, err := worthCompressingFile(file, m.compression(), compressionMaxRatio(m.transfer))
+		if err != nil {
+			return ErrorMsg(fmt.Sprintf("读取本地文件失败：%v", err))
+		}
+		if worth {
+			compression = m.compression()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	client := pb.NewFileServiceClient(m.currentConn)
-	req := &pb.DownloadFileRequest{
-		FilePath: remotePath,
+	stream, err := client.UploadFile(ctx)
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("远程调用出错：%s", describeError(err)))
 	}
-	stream, err := client.DownloadFile(ctx, req)
+	err = stream.Send(&pb.UploadFileRequest{
+		Data: &pb.UploadFileRequest_Info{Info: &pb.UploadFileInfo{
+			FilePath:    m.remotePath(remoteName),
+			Size:        info.Size(),
+			Compression: compression,
+		}},
+	})
 	if err != nil {
-		return ErrorMsg(fmt.Sprintf("远程调用出错：%v", err))
+		return ErrorMsg(fmt.Sprintf("发送文件信息失败：%s", describeError(err)))
 	}
-	localDir := filepath.Join(m.dataRoot, m.currentNode)
-	// 确保目录存在
-	if err := os.MkdirAll(localDir, os.ModePerm); err != nil {
-		return ErrorMsg(fmt.Sprintf("创建目录失败：%v", err))
+	// 数据（压缩时为压缩后的数据）按分块大小缓冲后逐块发送
+	sender := &uploadChunkWriter{stream: stream}
+	chunks := bufio.NewWriterSize(sender, normalizeChunkSize(m.transfer.ChunkSize))
+	var w io.Writer = chunks
+	var compressor io.WriteCloser
+	if compression != "" {
+		if compressor, err = newCompressor(compression, chunks); err != nil {
+			return ErrorMsg(err.Error())
+		}
+		w = compressor
+	}
+	_, err = io.Copy(w, file)
+	if err == nil && compressor != nil {
+		err = compressor.Close()
+	}
+	if err == nil {
+		err = chunks.Flush()
 	}
-	localFilePath := filepath.Join(localDir, args[0])
-	file, err := os.Create(localFilePath)
 	if err != nil {
-		return ErrorMsg(fmt.Sprintf("创建本地文件失败：%v", err))
+		if sender.err == nil {
+			return ErrorMsg(fmt.Sprintf("读取本地文件失败：%v", err))
+		}
+		// 服务端提前结束时，真实错误需要通过CloseAndRecv获取
+		if _, recvErr := stream.CloseAndRecv(); recvErr != nil {
+			err = recvErr
+		}
+		return ErrorMsg(fmt.Sprintf("发送文件数据失败：%s", describeError(err)))
 	}
-	defer file.Close()
-	for {
-		chunk, err := stream.Recv()
-		if err == io.EOF {
-			break
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("上传文件失败：%s", describeError(err)))
+	}
+	return fmt.Sprintf("文件上传成功，共 %s", utils.FormatFileSize(resp.Size))
+}
+
+// uploadChunkWriter 将写入的数据作为分块消息发送到 UploadFile 的客户端流，并记录发送时的错误
+type uploadChunkWriter struct {
+	stream pb.FileService_UploadFileClient
+	err    error
+}
+
+func (w *uploadChunkWriter) Write(p []byte) (int, error) {
+	err := w.stream.Send(&pb.UploadFileRequest{
+		Data: &pb.UploadFileRequest_Chunk{Chunk: &pb.FileChunk{Content: p}},
+	})
+	if err != nil {
+		w.err = err
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// lsOptions ls 命令的显示与排序选项
+type lsOptions struct {
+	long    bool // -l 长格式
+	byTime  bool // -t 按修改时间排序，最新的在前
+	bySize  bool // -S 按大小排序，最大的在前
+	reverse bool // -r 逆序
+}
+
+func parseLsOptions(args []string) (lsOptions, bool) {
+	var opts lsOptions
+	for _, arg := range args {
+		if len(arg) < 2 || arg[0] != '-' {
+			return opts, false
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'l':
+				opts.long = true
+			case 't':
+				opts.byTime = true
+			case 'S':
+				opts.bySize = true
+			case 'r':
+				opts.reverse = true
+			default:
+				return opts, false
+			}
+		}
+	}
+	return opts, true
+}
+
+// sortEntries 默认按名称排序，-t/-S 分别按修改时间和大小排序
+func sortEntries(entries []*pb.FileEntry, opts lsOptions) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if opts.reverse {
+			a, b = b, a
+		}
+		switch {
+		case opts.bySize && a.Size != b.Size:
+			return a.Size > b.Size
+		case opts.byTime && a.ModTime != b.ModTime:
+			return a.ModTime > b.ModTime
+		}
+		return a.Name < b.Name
+	})
+}
+
+// formatMode 以 ls -l 的形式显示权限，后端不提供权限时显示为 ?
+func formatMode(e *pb.FileEntry) string {
+	if e.Mode != 0 {
+		return os.FileMode(e.Mode).String()
+	}
+	if e.IsDirectory {
+		return "d?????????"
+	}
+	if e.IsSymlink {
+		return "L?????????"
+	}
+	return "-?????????"
+}
+
+func formatModTime(e *pb.FileEntry) string {
+	if e.ModTime == 0 {
+		return "-"
+	}
+	return time.Unix(e.ModTime, 0).Format("2006-01-02 15:04")
+}
+
+// formatName 显示条目名称，符号链接同时显示链接的目标
+func formatName(e *pb.FileEntry) string {
+	if e.IsSymlink {
+		return fmt.Sprintf("%s -> %s", e.Name, e.LinkTarget)
+	}
+	return e.Name
+}
+
+func formatEntry(e *pb.FileEntry, long bool) string {
+	if !long {
+		filetype := '-'
+		switch {
+		case e.IsDirectory:
+			filetype = 'd'
+		case e.IsSymlink:
+			filetype = 'l'
+		}
+		return fmt.Sprintf("%c  %v %v", filetype, formatName(e), utils.FormatFileSize(e.Size))
+	}
+	size := utils.FormatFileSize(e.Size)
+	if e.IsDirectory {
+		size = "-"
+		if e.ChildCount >= 0 {
+			size = fmt.Sprintf("%d项", e.ChildCount)
 		}
+	}
+	return fmt.Sprintf("%s %10s %16s  %v", formatMode(e), size, formatModTime(e), formatName(e))
+}
+
+// listPageSize ls 每次请求的条目数
+const listPageSize = 500
+
+// listDirectory 逐页读取远程目录的全部条目
+func (m *Manager) listDirectory(path string) ([]*pb.FileEntry, error) {
+	client := pb.NewFileServiceClient(m.currentConn)
+	var entries []*pb.FileEntry
+	req := &pb.ListDirectoryRequest{
+		DirectoryPath: path,
+		PageSize:      listPageSize,
+	}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		resp, err := client.ListDirectory(ctx, req)
+		cancel()
 		if err != nil {
-			file.Close()
-			os.Remove(localFilePath)
-			return ErrorMsg(fmt.Sprintf("接收文件数据失败：%v", err))
+			return nil, err
 		}
-		if _, err := file.Write(chunk.Content); err != nil {
-			file.Close()
-			os.Remove(localFilePath)
-			return ErrorMsg(fmt.Sprintf("写入本地文件失败：%v", err))
+		entries = append(entries, resp.Entries...)
+		if resp.NextPageToken == "" {
+			return entries, nil
 		}
+		req.PageToken = resp.NextPageToken
 	}
-	return fmt.Sprintf("文件下载成功")
 }
 
 func ls(m *Manager, args []string) string {
 	var sb strings.Builder
-	if len(args) != 0 {
+	opts, ok := parseLsOptions(args)
+	if !ok {
 		return ErrorMsg("ls 输入不合法")
 	}
 	index := len(m.relativePath)
@@ -210,44 +522,415 @@ func ls(m *Manager, args []string) string {
 		return ErrorMsg("未指定节点")
 	}
 	//调用远程rpc
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	client := pb.NewFileServiceClient(m.currentConn)
 	var path string
 	for i := 1; i < len(m.relativePath); i++ {
 		path += fmt.Sprintf("/%s", m.relativePath[i])
 	}
-	req := &pb.ListDirectoryRequest{
-		DirectoryPath: path,
-	}
-	resp, err := client.ListDirectory(ctx, req)
+	entries, err := m.listDirectory(path)
 	if err != nil {
-		ErrorMsg(fmt.Sprintf("远程调用出错：%s", err))
+		return ErrorMsg(fmt.Sprintf("远程调用出错：%s", describeError(err)))
 	}
-	flag := true
-	for _, entry := range resp.Entries {
-		e := entry
-		var filetype rune
-		isDir := e.IsDirectory
-		if isDir {
-			filetype = 'd'
-		} else {
-			filetype = '-'
+	sortEntries(entries, opts)
+	for i, entry := range entries {
+		if i > 0 {
+			sb.WriteString("\n")
 		}
-		if flag {
-			flag = false
-			sb.WriteString(fmt.Sprintf("%c  %v %v", filetype, e.Name, utils.FormatFileSize(e.Size)))
-		} else {
-			sb.WriteString(fmt.Sprintf("\n%c  %v %v", filetype, e.Name, utils.FormatFileSize(e.Size)))
+		sb.WriteString(formatEntry(entry, opts.long))
+	}
+	return sb.String()
+}
+
+func stat(m *Manager, args []string) string {
+	if len(args) != 1 {
+		return ErrorMsg("stat 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := pb.NewFileServiceClient(m.currentConn)
+	resp, err := client.Stat(ctx, &pb.StatRequest{Path: m.remotePath(args[0])})
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("远程调用出错：%s", describeError(err)))
+	}
+	e := resp.Entry
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("名称：%s\n", e.Name))
+	if e.IsDirectory {
+		sb.WriteString("类型：目录\n")
+		if e.ChildCount >= 0 {
+			sb.WriteString(fmt.Sprintf("子项数：%d\n", e.ChildCount))
 		}
+	} else if e.IsSymlink {
+		sb.WriteString("类型：符号链接\n")
+		sb.WriteString(fmt.Sprintf("目标：%s\n", e.LinkTarget))
+	} else {
+		sb.WriteString("类型：文件\n")
+		sb.WriteString(fmt.Sprintf("大小：%s（%d 字节）\n", utils.FormatFileSize(e.Size), e.Size))
+		sb.WriteString(fmt.Sprintf("MIME类型：%s\n", e.ContentType))
+	}
+	sb.WriteString(fmt.Sprintf("权限：%s\n", formatMode(e)))
+	sb.WriteString(fmt.Sprintf("修改时间：%s", formatModTime(e)))
+	if e.Etag != "" {
+		sb.WriteString(fmt.Sprintf("\nETag：%s", e.Etag))
+	}
+	return sb.String()
+}
+
+func rm(m *Manager, args []string) string {
+	recursive := len(args) == 2 && args[0] == "-r"
+	if len(args) != 1 && !recursive {
+		return ErrorMsg("rm 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client := pb.NewFileServiceClient(m.currentConn)
+	req := &pb.DeleteFileRequest{
+		FilePath:  m.remotePath(args[len(args)-1]),
+		Recursive: recursive,
+	}
+	if _, err := client.DeleteFile(ctx, req); err != nil {
+		return ErrorMsg(fmt.Sprintf("删除失败：%s", describeError(err)))
+	}
+	return ""
+}
+
+func mkdir(m *Manager, args []string) string {
+	if len(args) != 1 {
+		return ErrorMsg("mkdir 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := pb.NewFileServiceClient(m.currentConn)
+	req := &pb.MakeDirectoryRequest{
+		DirectoryPath: m.remotePath(args[0]),
+	}
+	if _, err := client.MakeDirectory(ctx, req); err != nil {
+		return ErrorMsg(fmt.Sprintf("创建目录失败：%s", describeError(err)))
+	}
+	return ""
+}
+
+// mv 目标不含路径分隔符时在当前目录内重命名，否则移动到目标路径
+func mv(m *Manager, args []string) string {
+	if len(args) != 2 {
+		return ErrorMsg("mv 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client := pb.NewFileServiceClient(m.currentConn)
+	var err error
+	if !strings.Contains(args[1], "/") && args[1] != ".." {
+		_, err = client.Rename(ctx, &pb.RenameRequest{
+			FilePath: m.remotePath(args[0]),
+			NewName:  args[1],
+		})
+	} else {
+		_, err = client.Move(ctx, &pb.MoveRequest{
+			SourcePath:      m.remotePath(args[0]),
+			DestinationPath: m.remotePath(args[1]),
+		})
+	}
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("移动失败：%s", describeError(err)))
+	}
+	return ""
+}
+
+// sum 查询远程文件的校验值，-a 指定算法（sha256、sha1、sha512、md5）
+func sum(m *Manager, args []string) string {
+	var algorithm string
+	if len(args) == 3 && args[0] == "-a" {
+		algorithm = args[1]
+		args = args[2:]
+	}
+	if len(args) != 1 {
+		return ErrorMsg("sum 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	if msg := m.requireFeature(featureChecksum); msg != "" {
+		return msg
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	client := pb.NewFileServiceClient(m.currentConn)
+	resp, err := client.Checksum(ctx, &pb.ChecksumRequest{
+		FilePath:  m.remotePath(args[0]),
+		Algorithm: algorithm,
+	})
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("计算校验值失败：%s", describeError(err)))
+	}
+	return fmt.Sprintf("%s (%s, %s) = %s", strings.ToUpper(resp.Algorithm), args[0], utils.FormatFileSize(resp.Size), resp.Checksum)
+}
+
+// splitNodePath 将 <节点>/<路径> 拆分为节点名和节点内的路径
+func splitNodePath(arg string) (string, string, bool) {
+	node, p, _ := strings.Cut(strings.TrimPrefix(arg, "/"), "/")
+	return node, p, node != ""
+}
+
+// cp 在节点之间直接复制文件：cp [-z] <源节点>/<路径> <目标节点>/<路径>，由目标节点从源节点拉取数据，-z 时请求压缩传输
+func cp(m *Manager, args []string) string {
+	compress := len(args) > 0 && args[0] == "-z"
+	if compress {
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		return ErrorMsg("cp 输入不合法")
+	}
+	srcNode, srcPath, ok := splitNodePath(args[0])
+	if !ok || srcPath == "" {
+		return ErrorMsg("cp 输入不合法")
+	}
+	dstNode, dstPath, ok := splitNodePath(args[1])
+	if !ok {
+		return ErrorMsg("cp 输入不合法")
+	}
+	if _, ok := m.nodes.Load(srcNode); !ok {
+		return ErrorMsg(fmt.Sprintf("源节点不存在：%s", srcNode))
+	}
+	addrVal, ok := m.nodes.Load(dstNode)
+	if !ok {
+		return ErrorMsg(fmt.Sprintf("目标节点不存在：%s", dstNode))
+	}
+	conn, err := GetConn(dstNode, addrVal.(string))
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("建立grpc连接出错：%v", err))
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := pb.NewFileServiceClient(conn)
+	// 复制由目标节点执行，需要目标节点支持；查询失败时照常调用，由服务端报告错误
+	if peer, err := m.nodeInfo(dstNode, addrVal.(string), client); err == nil && peer != nil && !slices.Contains(peer.Features, featureCopy) {
+		return ErrorMsg(fmt.Sprintf("目标节点 %s 不支持复制（版本过旧或未启用服务发现）", dstNode))
+	}
+	req := &pb.CopyFromRequest{
+		SourceNode:      srcNode,
+		SourcePath:      srcPath,
+		DestinationPath: dstPath,
+	}
+	if compress {
+		req.Compression = m.compression()
+	}
+	resp, err := client.CopyFrom(ctx, req)
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("复制失败：%s", describeError(err)))
+	}
+	return fmt.Sprintf("复制成功，共 %s", utils.FormatFileSize(resp.Size))
+}
+
+// limits 显示当前节点的下载限速配置和各调用方的使用情况
+func limits(m *Manager, args []string) string {
+	if len(args) != 0 {
+		return ErrorMsg("limits 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	if msg := m.requireFeature(featureLimits); msg != "" {
+		return msg
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := pb.NewFileServiceClient(m.currentConn)
+	resp, err := client.Limits(ctx, &pb.LimitsRequest{})
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("远程调用出错：%s", describeError(err)))
+	}
+	return formatLimits(resp)
+}
 
+func formatLimits(resp *pb.LimitsResponse) string {
+	bandwidth := func(v int64) string {
+		if v <= 0 {
+			return "不限"
+		}
+		return utils.FormatFileSize(v) + "/s"
+	}
+	streams := func(v int32) string {
+		if v <= 0 {
+			return "不限"
+		}
+		return strconv.Itoa(int(v))
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("下载带宽上限：总计 %s，每个调用方 %s\n", bandwidth(resp.MaxBandwidth), bandwidth(resp.MaxPeerBandwidth)))
+	sb.WriteString(fmt.Sprintf("下载流上限：总计 %s，每个调用方 %s\n", streams(resp.MaxStreams), streams(resp.MaxPeerStreams)))
+	sb.WriteString(fmt.Sprintf("监视上限：总计 %s，每个调用方 %s\n", streams(resp.MaxWatches), streams(resp.MaxPeerWatches)))
+	sb.WriteString(fmt.Sprintf("当前下载流：%d，当前监视：%d，累计发送：%s", resp.ActiveStreams, resp.ActiveWatches, utils.FormatFileSize(resp.BytesSent)))
+	for _, p := range resp.Peers {
+		sb.WriteString(fmt.Sprintf("\n  %-24s 下载流 %-3d 监视 %-3d 已发送 %s", p.Identity, p.ActiveStreams, p.ActiveWatches, utils.FormatFileSize(p.BytesSent)))
 	}
 	return sb.String()
 }
 
+// watch 持续显示远程目录中的新建、修改和删除，-r 同时监视子目录，按 Ctrl+C 结束
+func watch(m *Manager, args []string) string {
+	recursive := len(args) > 0 && args[0] == "-r"
+	if recursive {
+		args = args[1:]
+	}
+	if len(args) > 1 || (len(args) == 1 && strings.HasPrefix(args[0], "-")) {
+		return ErrorMsg("watch 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	if msg := m.requireFeature(featureWatch); msg != "" {
+		return msg
+	}
+	dir := strings.Join(m.relativePath[1:], "/")
+	if len(args) == 1 {
+		dir = m.remotePath(args[0])
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := m.watchDirectory(ctx, dir, recursive, os.Stdout)
+	if ctx.Err() != nil {
+		return "监视已结束"
+	}
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("监视失败：%s", describeError(err)))
+	}
+	return "监视的目录已被删除，监视结束"
+}
+
+// watchDirectory 将远程目录的变化逐行写入out，直到ctx取消或服务端结束监视
+func (m *Manager) watchDirectory(ctx context.Context, dir string, recursive bool, out io.Writer) error {
+	client := pb.NewFileServiceClient(m.currentConn)
+	stream, err := client.WatchDirectory(ctx, &pb.WatchDirectoryRequest{
+		DirectoryPath: dir,
+		Recursive:     recursive,
+	})
+	if err != nil {
+		return err
+	}
+	// 服务端建立监视后才发送header；没有header时说明服务端直接返回了错误，由Recv取得
+	md, err := stream.Header()
+	if err != nil {
+		return err
+	}
+	if md != nil {
+		fmt.Fprintf(out, "正在监视 /%s，按 Ctrl+C 结束\n", dir)
+	}
+	for {
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, formatWatchEvent(ev, time.Now()))
+	}
+}
+
+func formatWatchEvent(ev *pb.WatchEvent, now time.Time) string {
+	var op string
+	switch ev.Type {
+	case pb.WatchEvent_CREATED:
+		op = "新建"
+	case pb.WatchEvent_MODIFIED:
+		op = "修改"
+	case pb.WatchEvent_DELETED:
+		op = "删除"
+	default:
+		op = "未知"
+	}
+	name := ev.Path
+	if ev.Entry.GetIsDirectory() {
+		return fmt.Sprintf("%s  %s  %s/", now.Format("15:04:05"), op, name)
+	}
+	if ev.Type == pb.WatchEvent_DELETED {
+		return fmt.Sprintf("%s  %s  %s", now.Format("15:04:05"), op, name)
+	}
+	return fmt.Sprintf("%s  %s  %s  %s", now.Format("15:04:05"), op, name, utils.FormatFileSize(ev.Entry.GetSize()))
+}
+
+// find 在当前节点上递归查找文件：find [目录] [-name 模式] [-regex 表达式] [-size [+-]N[ckMG]] [-mtime [+-]N[mhd]] [-type f|d]
+func find(m *Manager, args []string) string {
+	req, dir, ok := parseFindOptions(args, time.Now())
+	if !ok {
+		return ErrorMsg("find 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	if msg := m.requireFeature(featureFind); msg != "" {
+		return msg
+	}
+	req.DirectoryPath = strings.Join(m.relativePath[1:], "/")
+	if dir != "" {
+		req.DirectoryPath = m.remotePath(dir)
+	}
+	// 遍历大目录树可能很久，可以按 Ctrl+C 提前结束
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	client := pb.NewFileServiceClient(m.currentConn)
+	count, err := findFiles(ctx, client, req, func(r *pb.FindResult) {
+		fmt.Println(formatFindResult(r))
+	})
+	if ctx.Err() != nil {
+		return fmt.Sprintf("查找已取消，已找到 %d 项", count)
+	}
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("查找失败：%s", describeError(err)))
+	}
+	return fmt.Sprintf("共找到 %d 项", count)
+}
+
+// search 在所有已发现的节点上按名称查找：search [-t 秒] <模式>，模式为 glob，-t 指定等待每个节点的秒数
+func search(m *Manager, args []string) string {
+	pattern, timeout, ok := parseSearchOptions(args)
+	if !ok {
+		return ErrorMsg("search 输入不合法")
+	}
+	req := &pb.FindRequest{Name: pattern, Limit: searchLimit}
+	if _, err := newFindMatcher(req); err != nil {
+		return ErrorMsg(fmt.Sprintf("模式不合法：%s", pattern))
+	}
+	searches := searchNodes(context.Background(), m.nodes, req, timeout)
+	if len(searches) == 0 {
+		return ErrorMsg("没有发现任何节点")
+	}
+	return formatSearch(searches)
+}
+
 var CommandMap = map[string]Command{
-	"show": show,
-	"cd":   cd,
-	"ls":   ls,
-	"get":  get,
+	"show":   show,
+	"cd":     cd,
+	"ls":     ls,
+	"get":    get,
+	"put":    put,
+	"rm":     rm,
+	"mkdir":  mkdir,
+	"mv":     mv,
+	"sum":    sum,
+	"stat":   stat,
+	"cp":     cp,
+	"limits": limits,
+	"watch":  watch,
+	"find":   find,
+	"search": search,
+	"info":   info,
+	"du":     du,
+	"df":     df,
+	"cat":    cat,
+	"head":   head,
+	"tail":   tail,
 }
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	pb "ZFS/grpc"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"io"
+	"os"
+	"sync"
+)
+
+// minRangeSize 多段并发下载时每段的最小字节数，文件太小时拆分没有收益
+const minRangeSize = 4 * 1024 * 1024
+
+// byteRange 文件中的一段连续字节
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+// splitRanges 将 size 字节的文件拆分为至多 jobs 段，每段不小于 minRangeSize
+func splitRanges(size int64, jobs int) []byteRange {
+	n := int64(jobs)
+	if limit := (size + minRangeSize - 1) / minRangeSize; n > limit {
+		n = limit
+	}
+	if n < 1 {
+		n = 1
+	}
+	ranges := make([]byteRange, 0, n)
+	step := size / n
+	for i := int64(0); i < n; i++ {
+		r := byteRange{offset: i * step, length: step}
+		if i == n-1 {
+			r.length = size - r.offset
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// downloadRanges 将远程文件拆分为 opts.jobs 段，通过各自独立的连接并发下载，
+// 按偏移量写入预先分配好大小的 .part 文件，每段都根据服务端trailer校验。
+// 由于 .part 中可能存在未写入的空洞，并发下载不支持断点续传，失败时会删除 .part 文件
+func (m *Manager) downloadRanges(ctx context.Context, remotePath, localFilePath string, opts getOptions) error {
+	client := pb.NewFileServiceClient(m.currentConn)
+	before, err := client.Stat(ctx, &pb.StatRequest{Path: remotePath})
+	if err != nil {
+		return fmt.Errorf("远程调用出错：%w", err)
+	}
+	if before.Entry.IsDirectory {
+		return fmt.Errorf("%s 是目录，请使用 get -r", remotePath)
+	}
+	ranges := splitRanges(before.Entry.Size, opts.jobs)
+	if len(ranges) == 1 {
+		opts.jobs = 1
+		_, err := m.downloadFile(ctx, remotePath, localFilePath, opts)
+		return err
+	}
+
+	partPath := localFilePath + partSuffix
+	os.Remove(partMetaPath(partPath))
+	file, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("创建本地文件失败：%w", err)
+	}
+	defer file.Close()
+	if err := file.Truncate(before.Entry.Size); err != nil {
+		file.Close()
+		os.Remove(partPath)
+		return fmt.Errorf("预分配本地文件失败：%w", err)
+	}
+
+	// 每段使用独立的连接，避免多个流复用同一条TCP连接
+	conns := make([]*grpc.ClientConn, len(ranges))
+	for i := range conns {
+		conn, err := GetConn(m.currentNode, m.currentConn.Target())
+		if err != nil {
+			conn = m.currentConn
+		}
+		conns[i] = conn
+	}
+	defer func() {
+		for _, conn := range conns {
+			if conn != m.currentConn {
+				conn.Close()
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, len(ranges))
+	for i, r := range ranges {
+		wg.Add(1)
+		go func(i int, r byteRange) {
+			defer wg.Done()
+			err := retryAdmission(ctx, func() error {
+				return m.downloadRange(ctx, conns[i], remotePath, file, r, opts)
+			})
+			if err != nil {
+				errs[i] = fmt.Errorf("第 %d 段（偏移 %d）：%w", i+1, r.offset, err)
+				cancel()
+			}
+		}(i, r)
+	}
+	wg.Wait()
+	if err := firstError(errs); err != nil {
+		file.Close()
+		os.Remove(partPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("写入本地文件失败：%w", err)
+	}
+
+	// 各段已分别校验，再确认下载期间远程文件没有被修改
+	after, err := client.Stat(ctx, &pb.StatRequest{Path: remotePath})
+	if err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("远程调用出错：%w", err)
+	}
+	if after.Entry.Size != before.Entry.Size || after.Entry.ModTime != before.Entry.ModTime || after.Entry.Etag != before.Entry.Etag {
+		return quarantine(partPath, localFilePath, errors.New("下载期间远程文件发生了变化"))
+	}
+	if err := os.Rename(partPath, localFilePath); err != nil {
+		return fmt.Errorf("重命名本地文件失败：%w", err)
+	}
+	return nil
+}
+
+// downloadRange 下载文件中的一段并写入 file 的对应位置
+func (m *Manager) downloadRange(ctx context.Context, conn *grpc.ClientConn, remotePath string, file *os.File, r byteRange, opts getOptions) error {
+	req := &pb.DownloadFileRequest{
+		FilePath: remotePath,
+		Offset:   r.offset,
+		Length:   r.length,
+	}
+	if opts.compress {
+		req.Compression = m.compression()
+	}
+	stream, err := pb.NewFileServiceClient(conn).DownloadFile(ctx, req)
+	if err != nil {
+		return fmt.Errorf("远程调用出错：%w", err)
+	}
+	reader, err := newStreamReader(stream)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	buf := getBuffer(normalizeChunkSize(m.transfer.ChunkSize))
+	defer putBuffer(buf)
+	// 最多写入 r.length 字节，防止服务端多发的数据覆盖相邻的段
+	writer := io.NewOffsetWriter(file, r.offset)
+	n, err := io.CopyBuffer(writer, io.LimitReader(reader, r.length), *buf)
+	if err != nil {
+		return fmt.Errorf("接收文件数据失败：%w", err)
+	}
+	if n != r.length {
+		return fmt.Errorf("%w：预期 %d 字节，实际接收 %d 字节", errIntegrity, r.length, n)
+	}
+	// 读到流结束后才能获取trailer
+	if _, err := reader.Read(*buf); err != io.EOF {
+		if err == nil {
+			err = errors.New("服务端发送的数据多于请求的范围")
+		}
+		return fmt.Errorf("接收文件数据失败：%w", err)
+	}
+	if reader.hasher != nil {
+		if err := reader.verify(); err != nil {
+			return fmt.Errorf("%w：%v", errIntegrity, err)
+		}
+	}
+	return nil
+}
+
+// firstError 返回第一个非 context.Canceled 的错误，都被取消时返回第一个错误
+func firstError(errs []error) error {
+	var first error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.Canceled) {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -1,37 +1,100 @@
 package cmd
 
 import (
+	"ZFS/config"
 	pb "ZFS/grpc"
 	"ZFS/storage"
+	"ZFS/utils"
+	"bytes"
 	"context"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 	"io"
 	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListDirectory 每页的条目数：请求未指定时使用 defaultPageSize，超过 maxPageSize 时按 maxPageSize 返回
+const (
+	defaultPageSize = 500
+	maxPageSize     = 1000
+)
+
+// DownloadFile 在header和trailer中返回的元数据
+const (
+	algorithmMetadataKey   = "x-zfs-checksum-algorithm" // header：校验算法
+	compressionMetadataKey = "x-zfs-compression"        // header：数据流实际使用的压缩算法
+	sizeMetadataKey        = "x-zfs-size"               // trailer：本次传输的字节数（压缩前）
+	checksumMetadataKey    = "x-zfs-checksum"           // trailer：本次传输内容（压缩前）的校验值，格式为 算法:十六进制哈希
 )
 
 type FileServer struct {
 	pb.UnimplementedFileServiceServer
-	storage storage.Storage
+	storage  storage.Storage
+	transfer config.TransferConfig // 校验与压缩配置
+	nodes    *sync.Map             // 服务发现得到的节点名到地址的映射，用于节点间直接复制
+	limits   *limiter              // 下载限速与并发控制，nil表示不限制
+	acl      *accessControl        // 访问控制，用于过滤 Find 和 WatchDirectory 逐项返回的结果，nil表示不限制
+	nodeName string                // 本节点名，由 GetNodeInfo 返回
+	started  time.Time             // 服务启动时间，用于计算运行时间
 }
 
 type FileService struct{}
 
-func StartServer(addr string, stor storage.Storage) {
+func StartServer(addr string, stor storage.Storage, conf *config.Config, acl *accessControl, monitor *healthMonitor) {
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		panic(err)
 	}
-	grpcServer := grpc.NewServer()
+	opts := serverOptions()
+	if serverCredentials != nil {
+		opts = append(opts, grpc.Creds(serverCredentials))
+	}
+	if acl != nil {
+		opts = append(opts, grpc.ChainUnaryInterceptor(acl.unaryInterceptor), grpc.ChainStreamInterceptor(acl.streamInterceptor))
+	}
+	grpcServer := grpc.NewServer(opts...)
 
-	pb.RegisterFileServiceServer(grpcServer, &FileServer{storage: stor})
+	pb.RegisterFileServiceServer(grpcServer, &FileServer{
+		storage:  stor,
+		transfer: conf.Transfer,
+		nodes:    &nodes,
+		limits:   newLimiter(conf.Limits),
+		acl:      acl,
+		nodeName: conf.Node.Name,
+		started:  time.Now(),
+	})
+	if monitor != nil {
+		healthpb.RegisterHealthServer(grpcServer, monitor.server)
+	}
+	if conf.GRPC.Reflection {
+		reflection.Register(grpcServer)
+	}
 	if err := grpcServer.Serve(lis); err != nil {
 		panic(err)
 	}
 }
 
-func GetConn(addr string) (*grpc.ClientConn, error) {
-	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// GetConn 建立到节点 node（地址为 addr）的连接，启用 tls 时验证对端证书属于该节点
+func GetConn(node, addr string) (*grpc.ClientConn, error) {
+	creds := clientCredentials(node)
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
+	opts := append(dialOptions(), grpc.WithTransportCredentials(creds))
+	conn, err := grpc.NewClient(addr, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -42,8 +105,19 @@ func GetConn(addr string) (*grpc.ClientConn, error) {
 func (s *FileServer) ListDirectory(ctx context.Context, req *pb.ListDirectoryRequest) (*pb.ListDirectoryResponse, error) {
 	dirPath := req.GetDirectoryPath()
 	
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	
 	// 使用storage层列出目录
-	files, err := s.storage.ListDirectory(ctx, dirPath)
+	files, nextPageToken, err := s.storage.ListDirectory(ctx, dirPath, storage.ListOptions{
+		PageSize:  pageSize,
+		PageToken: req.GetPageToken(),
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -51,43 +125,492 @@ func (s *FileServer) ListDirectory(ctx context.Context, req *pb.ListDirectoryReq
 	// 转换为protobuf格式
 	var entries []*pb.FileEntry
 	for _, file := range files {
-		entry := &pb.FileEntry{
-			Name:        file.Name,
-			IsDirectory: file.IsDirectory,
-			Size:        file.Size,
-		}
-		entries = append(entries, entry)
+		entries = append(entries, toFileEntry(file))
 	}
 	
-	return &pb.ListDirectoryResponse{Entries: entries}, nil
+	return &pb.ListDirectoryResponse{Entries: entries, NextPageToken: nextPageToken}, nil
+}
+
+// 实现 Stat 方法
+func (s *FileServer) Stat(ctx context.Context, req *pb.StatRequest) (*pb.StatResponse, error) {
+	info, err := s.storage.Stat(ctx, req.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.StatResponse{Entry: toFileEntry(info)}, nil
+}
+
+// toFileEntry 将storage层的文件信息转换为protobuf格式
+func toFileEntry(file storage.FileInfo) *pb.FileEntry {
+	entry := &pb.FileEntry{
+		Name:        file.Name,
+		IsDirectory: file.IsDirectory,
+		Size:        file.Size,
+		Mode:        uint32(file.Mode),
+		ContentType: file.ContentType,
+		Etag:        file.ETag,
+		ChildCount:  file.ChildCount,
+		IsSymlink:   file.IsSymlink,
+		LinkTarget:  file.LinkTarget,
+	}
+	if !file.ModTime.IsZero() {
+		entry.ModTime = file.ModTime.Unix()
+	}
+	return entry
 }
 
 func (s *FileServer) DownloadFile(req *pb.DownloadFileRequest, stream pb.FileService_DownloadFileServer) error {
 	filePath := req.GetFilePath()
-	
+	if req.GetOffset() < 0 || req.GetLength() < 0 {
+		return status.Errorf(codes.InvalidArgument, "读取范围不合法: offset=%d, length=%d", req.GetOffset(), req.GetLength())
+	}
+	if req.GetFollow() && req.GetLength() > 0 {
+		return status.Error(codes.InvalidArgument, "follow 模式不能指定读取长度")
+	}
+	// follow 模式可能持续很久，与 watch 一样按监视计数，发送完已有内容后就归还下载流名额
+	if req.GetFollow() {
+		release, err := s.limits.admitWatch(callerKey(stream.Context()))
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	slot, err := s.limits.admit(callerKey(stream.Context()))
+	if err != nil {
+		return err
+	}
+	defer slot.release()
+
 	// 使用storage层下载文件
-	reader, err := s.storage.DownloadFile(stream.Context(), filePath)
+	reader, err := s.storage.DownloadFile(stream.Context(), filePath, req.GetOffset(), req.GetLength())
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
+	hasher, err := utils.NewHash(s.transfer.Checksum)
+	if err != nil {
+		return err
+	}
+
+	// 客户端请求压缩时，根据内容类型和采样结果决定是否真的压缩
+	var source io.Reader = reader
+	compression := compressionNone
+	if algorithm := strings.ToLower(req.GetCompression()); isSupportedCompression(algorithm) && !req.GetFollow() {
+		var compress bool
+		source, compress, err = s.shouldCompress(stream.Context(), filePath, algorithm, reader)
+		if err != nil {
+			return err
+		}
+		if compress {
+			compression = algorithm
+		}
+	}
+
+	// 先发送header，客户端据此在接收数据的同时解压并计算校验值
+	header := metadata.Pairs(
+		algorithmMetadataKey, s.checksumAlgorithm(),
+		compressionMetadataKey, compression,
+	)
+	if err := stream.SendHeader(header); err != nil {
+		return err
+	}
 
-	// 流式传输文件内容
-	buf := make([]byte, 1024)
-	for {
-		n, err := reader.Read(buf)
+	// 流式传输文件内容，校验值基于压缩前的数据计算
+	chunkSize := normalizeChunkSize(s.transfer.ChunkSize)
+	out := newChunkWriter(stream, chunkSize)
+	out.slot = slot
+	defer out.Release()
+	var writer io.Writer = out
+	var compressor io.WriteCloser
+	if compression != compressionNone {
+		compressor, err = newCompressor(compression, out)
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
 			return err
 		}
-		chunk := &pb.FileChunk{
-			Content: buf[:n],
+		writer = compressor
+	}
+	buf := getBuffer(chunkSize)
+	defer putBuffer(buf)
+	size, err := io.CopyBuffer(io.MultiWriter(writer, hasher), readerOnly{source}, *buf)
+	if err != nil {
+		return err
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if req.GetFollow() {
+		slot.release()
+		return s.follow(stream.Context(), filePath, req.GetOffset()+size, out)
+	}
+	stream.SetTrailer(metadata.Pairs(
+		sizeMetadataKey, strconv.FormatInt(size, 10),
+		checksumMetadataKey, s.checksumAlgorithm()+":"+hex.EncodeToString(hasher.Sum(nil)),
+	))
+	return nil
+}
+
+// checksumAlgorithm 返回服务端使用的校验算法名称
+func (s *FileServer) checksumAlgorithm() string {
+	if s.transfer.Checksum == "" {
+		return "sha256"
+	}
+	return strings.ToLower(s.transfer.Checksum)
+}
+
+// shouldCompress 判断文件是否值得压缩：已压缩的内容类型直接跳过，
+// 否则压缩开头的一段样本，压缩率不够好时也不压缩。返回的reader包含已读取的样本
+func (s *FileServer) shouldCompress(ctx context.Context, filePath, algorithm string, reader io.Reader) (io.Reader, bool, error) {
+	if info, err := s.storage.Stat(ctx, filePath); err == nil && isCompressedContentType(info.ContentType) {
+		return reader, false, nil
+	}
+	sample := make([]byte, compressionSampleSize)
+	n, err := io.ReadFull(reader, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false, err
+	}
+	sample = sample[:n]
+	return io.MultiReader(bytes.NewReader(sample), reader), worthCompressing(algorithm, sample, compressionMaxRatio(s.transfer)), nil
+}
+
+// uploadChunkReader 将UploadFile的客户端流适配为io.Reader，读出的是线路上的原始（可能已压缩）数据
+type uploadChunkReader struct {
+	stream pb.FileService_UploadFileServer
+	buf    []byte
+}
+
+func (r *uploadChunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		chunk := req.GetChunk()
+		if chunk == nil {
+			return 0, status.Error(codes.InvalidArgument, "上传流中出现非数据分块消息")
+		}
+		r.buf = chunk.Content
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// uploadReader 读取UploadFile的客户端流，按客户端声明的压缩算法解压，
+// 并检查解压后的大小与声明一致，供storage层读取
+type uploadReader struct {
+	reader       io.Reader
+	decompressor io.ReadCloser
+	received     int64 // 已接收的字节数（解压后）
+	expected     int64 // 客户端声明的文件大小
+}
+
+func newUploadReader(stream pb.FileService_UploadFileServer, info *pb.UploadFileInfo) (*uploadReader, error) {
+	r := &uploadReader{reader: &uploadChunkReader{stream: stream}, expected: info.GetSize()}
+	algorithm := strings.ToLower(info.GetCompression())
+	if algorithm == "" || algorithm == compressionNone {
+		return r, nil
+	}
+	if !isSupportedCompression(algorithm) {
+		return nil, status.Errorf(codes.InvalidArgument, "不支持的压缩算法: %s", info.GetCompression())
+	}
+	decompressor, err := newDecompressor(algorithm, r.reader)
+	if err != nil {
+		if _, ok := status.FromError(err); !ok {
+			err = status.Errorf(codes.InvalidArgument, "解压上传数据失败: %v", err)
+		}
+		return nil, err
+	}
+	// 解压后最多读取声明大小多一个字节，足以发现超出声明的数据，压缩炸弹不会被解压到底
+	r.reader, r.decompressor = io.LimitReader(decompressor, r.expected+1), decompressor
+	return r, nil
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.received += int64(n)
+	// 超出声明的大小时立即拒绝，不必等到客户端发完全部数据
+	if r.received > r.expected {
+		return n, status.Errorf(codes.InvalidArgument, "文件大小不匹配：预期 %d 字节，已接收超过 %d 字节", r.expected, r.expected)
+	}
+	if err == io.EOF && r.received != r.expected {
+		return n, status.Errorf(codes.InvalidArgument, "文件大小不匹配：预期 %d 字节，实际接收 %d 字节", r.expected, r.received)
+	}
+	return n, err
+}
+
+// Close 释放解压器占用的资源
+func (r *uploadReader) Close() error {
+	if r.decompressor != nil {
+		return r.decompressor.Close()
+	}
+	return nil
+}
+
+// 实现 UploadFile 方法
+func (s *FileServer) UploadFile(stream pb.FileService_UploadFileServer) error {
+	// 第一条消息必须携带文件元信息
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	info := req.GetInfo()
+	if info == nil || info.GetFilePath() == "" {
+		return status.Error(codes.InvalidArgument, "上传流的第一条消息必须包含目标文件路径")
+	}
+
+	reader, err := newUploadReader(stream, info)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if err := s.storage.UploadFile(stream.Context(), info.GetFilePath(), reader); err != nil {
+		return err
+	}
+	return stream.SendAndClose(&pb.UploadFileResponse{Size: reader.received})
+}
+
+// 实现 DeleteFile 方法
+func (s *FileServer) DeleteFile(ctx context.Context, req *pb.DeleteFileRequest) (*pb.DeleteFileResponse, error) {
+	if err := s.storage.DeleteFile(ctx, req.GetFilePath(), req.GetRecursive()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteFileResponse{}, nil
+}
+
+// 实现 MakeDirectory 方法
+func (s *FileServer) MakeDirectory(ctx context.Context, req *pb.MakeDirectoryRequest) (*pb.MakeDirectoryResponse, error) {
+	if err := s.storage.MakeDirectory(ctx, req.GetDirectoryPath()); err != nil {
+		return nil, err
+	}
+	return &pb.MakeDirectoryResponse{}, nil
+}
+
+// 实现 Rename 方法
+func (s *FileServer) Rename(ctx context.Context, req *pb.RenameRequest) (*pb.RenameResponse, error) {
+	if err := s.storage.Rename(ctx, req.GetFilePath(), req.GetNewName()); err != nil {
+		return nil, err
+	}
+	return &pb.RenameResponse{}, nil
+}
+
+// 实现 Move 方法
+func (s *FileServer) Move(ctx context.Context, req *pb.MoveRequest) (*pb.MoveResponse, error) {
+	if err := s.storage.Move(ctx, req.GetSourcePath(), req.GetDestinationPath()); err != nil {
+		return nil, err
+	}
+	return &pb.MoveResponse{}, nil
+}
+
+// 实现 Checksum 方法
+func (s *FileServer) Checksum(ctx context.Context, req *pb.ChecksumRequest) (*pb.ChecksumResponse, error) {
+	algorithm := req.GetAlgorithm()
+	if algorithm == "" {
+		algorithm = s.checksumAlgorithm()
+	}
+	hasher, err := utils.NewHash(algorithm)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	reader, err := s.storage.DownloadFile(ctx, req.GetFilePath(), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	size, err := io.Copy(hasher, reader)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ChecksumResponse{
+		Algorithm: strings.ToLower(algorithm),
+		Checksum:  hex.EncodeToString(hasher.Sum(nil)),
+		Size:      size,
+	}, nil
+}
+
+// 实现 CopyFrom 方法：从源节点的 FileService 拉取文件并写入本节点的存储
+func (s *FileServer) CopyFrom(ctx context.Context, req *pb.CopyFromRequest) (*pb.CopyFromResponse, error) {
+	if s.nodes == nil {
+		return nil, status.Error(codes.FailedPrecondition, "本节点未启用服务发现，无法从其他节点复制")
+	}
+	addrVal, ok := s.nodes.Load(req.GetSourceNode())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "源节点不存在: %s", req.GetSourceNode())
+	}
+	conn, err := GetConn(req.GetSourceNode(), addrVal.(string))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	client := pb.NewFileServiceClient(conn)
+	// 源节点不支持压缩或认为不值得压缩时按原样发送，header中会说明实际使用的算法
+	stream, err := client.DownloadFile(onBehalfOf(ctx), &pb.DownloadFileRequest{FilePath: req.GetSourcePath(), Compression: req.GetCompression()})
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newStreamReader(stream)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// 目标为已存在的目录时保存到该目录下
+	dst := req.GetDestinationPath()
+	if info, err := s.storage.Stat(ctx, dst); err == nil && info.IsDirectory {
+		dst = path.Join(dst, path.Base(req.GetSourcePath()))
+	}
+	// 校验在写入完成之前进行，校验失败时不会覆盖目标位置已有的文件
+	if err := s.storage.UploadFile(ctx, dst, verifiedReader{reader}); err != nil {
+		return nil, err
+	}
+	return &pb.CopyFromResponse{Size: reader.received}, nil
+}
+
+// verifiedReader 在读到 io.EOF 时将接收到的内容与服务端trailer中的记录比较，
+// 不一致时以校验错误代替 io.EOF，使存储层放弃本次写入
+type verifiedReader struct {
+	*streamReader
+}
+
+func (r verifiedReader) Read(p []byte) (int, error) {
+	n, err := r.streamReader.Read(p)
+	if err == io.EOF {
+		if verr := r.verify(); verr != nil {
+			return n, verr
+		}
+	}
+	return n, err
+}
+
+// 实现 Limits 方法
+func (s *FileServer) Limits(ctx context.Context, req *pb.LimitsRequest) (*pb.LimitsResponse, error) {
+	return s.limits.snapshot(), nil
+}
+
+// WatchDirectory 持续推送目录变化事件，客户端取消或目录本身被删除时结束
+func (s *FileServer) WatchDirectory(req *pb.WatchDirectoryRequest, stream pb.FileService_WatchDirectoryServer) error {
+	release, err := s.limits.admitWatch(callerKey(stream.Context()))
+	if err != nil {
+		return err
+	}
+	defer release()
+	events, err := s.storage.Watch(stream.Context(), req.GetDirectoryPath(), req.GetRecursive())
+	if err != nil {
+		return err
+	}
+	// 监视建立后立即发送header，客户端据此确认之后的变化都会被通知
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	for ev := range events {
+		if !s.acl.allows(stream.Context(), ev.Path, utils.ACLList) {
+			continue
 		}
-		if err := stream.Send(chunk); err != nil {
+		if err := stream.Send(toWatchEvent(ev)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// Find 遍历目录树，以流方式返回满足条件且调用方有权查看的文件和目录。
+// 深度超过 maxFindDepth 的条目不会被匹配，检查的条目超过 maxFindEntries 时返回 OutOfRange
+func (s *FileServer) Find(req *pb.FindRequest, stream pb.FileService_FindServer) error {
+	matcher, err := newFindMatcher(req)
+	if err != nil {
+		return err
+	}
+	base, err := storage.CleanPath(req.GetDirectoryPath())
+	if err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	var count int32
+	var visited int
+	err = s.storage.Walk(ctx, req.GetDirectoryPath(), func(p string, info storage.FileInfo) error {
+		if visited++; visited > maxFindEntries {
+			return status.Errorf(codes.OutOfRange, "检查的条目数超过上限 %d，请缩小查找范围", maxFindEntries)
+		}
+		if findDepth(base, p) > maxFindDepth || !matcher.match(info) || !s.acl.allows(ctx, p, utils.ACLList) {
+			return nil
+		}
+		if err := stream.Send(&pb.FindResult{Path: p, Entry: toFileEntry(info)}); err != nil {
+			return err
+		}
+		count++
+		if req.GetLimit() > 0 && count >= req.GetLimit() {
+			return errFindLimit
+		}
+		return nil
+	})
+	if errors.Is(err, errFindLimit) {
+		return nil
+	}
+	return err
+}
+
+// toWatchEvent 将storage层的目录变化事件转换为protobuf格式
+func toWatchEvent(ev storage.WatchEvent) *pb.WatchEvent {
+	event := &pb.WatchEvent{Path: ev.Path, Entry: toFileEntry(ev.Info)}
+	switch ev.Op {
+	case storage.WatchCreated:
+		event.Type = pb.WatchEvent_CREATED
+	case storage.WatchModified:
+		event.Type = pb.WatchEvent_MODIFIED
+	case storage.WatchDeleted:
+		event.Type = pb.WatchEvent_DELETED
+	}
+	return event
+}
+
+// toStatusError 将handler返回的错误转换为gRPC状态码，已经是状态错误的原样返回，
+// 存储层错误按类别转换。其余错误作为 Internal 返回，原始信息可能包含服务端的绝对路径，只记录在日志中
+func toStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var code codes.Code
+	switch {
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, storage.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, storage.ErrPermissionDenied):
+		code = codes.PermissionDenied
+	case errors.Is(err, storage.ErrAlreadyExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, storage.ErrIsDirectory), errors.Is(err, storage.ErrNotDirectory), errors.Is(err, storage.ErrNotEmpty):
+		code = codes.FailedPrecondition
+	case errors.Is(err, storage.ErrInvalidArgument):
+		code = codes.InvalidArgument
+	case errors.Is(err, storage.ErrUnavailable):
+		code = codes.Unavailable
+	case errors.Is(err, storage.ErrNoSpace):
+		code = codes.ResourceExhausted
+	default:
+		zap.L().Error("请求处理失败", zap.Error(err))
+		return status.Error(codes.Internal, "服务端内部错误，详情请查看节点日志")
+	}
+	return status.Error(code, err.Error())
+}
+
+// statusUnaryInterceptor 将一元调用返回的错误转换为gRPC状态码
+func statusUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	return resp, toStatusError(err)
+}
+
+// statusStreamInterceptor 将流式调用返回的错误转换为gRPC状态码
+func statusStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return toStatusError(handler(srv, ss))
+}
@@ -1,18 +1,67 @@
 package cmd
 
 import (
+	"ZFS/config"
+	"ZFS/storage"
 	"ZFS/utils"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"math/rand"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	pb "ZFS/grpc"
 )
 
+// newTestFileServer 创建使用本地存储的 FileServer
+func newTestFileServer(t testing.TB, root string) *FileServer {
+	t.Helper()
+	stor, err := storage.NewLocalStorage(root, storage.SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	return &FileServer{storage: stor}
+}
+
+// startTestServer 在随机端口上启动使用 stor 的 FileServer，返回连接到该服务的客户端
+func startTestServer(t testing.TB, stor storage.Storage) *grpc.ClientConn {
+	t.Helper()
+	conn, _ := serveTestFileServer(t, &FileServer{storage: stor})
+	return conn
+}
+
+// serveTestFileServer 在随机端口上启动 FileServer，返回客户端连接和监听地址
+func serveTestFileServer(t testing.TB, s *FileServer) (*grpc.ClientConn, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听端口失败: %v", err)
+	}
+	grpcServer := grpc.NewServer(serverOptions()...)
+	pb.RegisterFileServiceServer(grpcServer, s)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := GetConn("node1", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("建立grpc连接失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, lis.Addr().String()
+}
+
 func TestListDirectory(t *testing.T) {
 	// 设置测试用 storage 目录
 	storagePath := "./storage"
@@ -47,7 +96,7 @@ func TestListDirectory(t *testing.T) {
 	file2.Close()
 
 	// 实例化 fileServer
-	s := &FileServer{}
+	s := newTestFileServer(t, storagePath)
 
 	// 构造 ListDirectory 请求，传入相对路径 "testdir"
 	req := &pb.ListDirectoryRequest{
@@ -66,9 +115,15 @@ func TestListDirectory(t *testing.T) {
 
 		if entry.Name == "file1.txt" && !entry.IsDirectory {
 			fileFound = true
+			if entry.ModTime == 0 || entry.Mode == 0 || entry.ContentType != "text/plain; charset=utf-8" {
+				t.Errorf("file1.txt 的元数据不完整: %+v", entry)
+			}
 		}
 		if entry.Name == "subdir" && entry.IsDirectory {
 			dirFound = true
+			if entry.ChildCount != 1 {
+				t.Errorf("subdir 的子项数量应为 1，实际为 %d", entry.ChildCount)
+			}
 		}
 	}
 
@@ -82,13 +137,15 @@ func TestListDirectory(t *testing.T) {
 
 // dummyDownloadFileServer 用于模拟 gRPC 的 server stream
 type dummyDownloadFileServer struct {
-	chunks []*pb.FileChunk
-	ctx    context.Context
+	chunks  []*pb.FileChunk
+	ctx     context.Context
+	header  metadata.MD
+	trailer metadata.MD
 }
 
-// Send 将接收到的文件块存入切片中
+// Send 将接收到的文件块复制后存入切片中，服务端会复用发送缓冲区
 func (d *dummyDownloadFileServer) Send(chunk *pb.FileChunk) error {
-	d.chunks = append(d.chunks, chunk)
+	d.chunks = append(d.chunks, &pb.FileChunk{Content: bytes.Clone(chunk.Content)})
 	return nil
 }
 
@@ -96,12 +153,16 @@ func (d *dummyDownloadFileServer) Context() context.Context {
 	return d.ctx
 }
 func (d *dummyDownloadFileServer) SetHeader(md metadata.MD) error {
+	d.header = metadata.Join(d.header, md)
 	return nil
 }
 func (d *dummyDownloadFileServer) SendHeader(md metadata.MD) error {
+	d.header = metadata.Join(d.header, md)
 	return nil
 }
-func (d *dummyDownloadFileServer) SetTrailer(md metadata.MD) {}
+func (d *dummyDownloadFileServer) SetTrailer(md metadata.MD) {
+	d.trailer = metadata.Join(d.trailer, md)
+}
 func (d *dummyDownloadFileServer) SendMsg(m interface{}) error {
 	return nil
 }
@@ -121,7 +182,7 @@ func TestDownloadFile(t *testing.T) {
 		t.Fatalf("写入测试文件失败: %v", err)
 	}
 
-	s := &FileServer{}
+	s := newTestFileServer(t, storageRoot)
 
 	dummyStream := &dummyDownloadFileServer{ctx: context.Background()}
 
@@ -138,4 +199,857 @@ func TestDownloadFile(t *testing.T) {
 	if !bytes.Equal(result.Bytes(), content) {
 		t.Errorf("下载的文件内容不匹配, got: %s, expected: %s", result.Bytes(), content)
 	}
+	// trailer 中应当包含传输的字节数和 sha256 校验值
+	digest := sha256.Sum256(content)
+	if got := dummyStream.trailer.Get(checksumMetadataKey); len(got) != 1 || got[0] != "sha256:"+hex.EncodeToString(digest[:]) {
+		t.Errorf("trailer 中的校验值不正确: %v", got)
+	}
+	if got := dummyStream.trailer.Get(sizeMetadataKey); len(got) != 1 || got[0] != fmt.Sprint(len(content)) {
+		t.Errorf("trailer 中的文件大小不正确: %v", got)
+	}
+
+	// 指定范围时只返回请求的部分
+	dummyStream = &dummyDownloadFileServer{ctx: context.Background()}
+	req = &pb.DownloadFileRequest{FilePath: testFileName, Offset: 5, Length: 10}
+	if err := s.DownloadFile(req, dummyStream); err != nil {
+		t.Fatalf("DownloadFile 返回错误: %v", err)
+	}
+	result.Reset()
+	for _, chunk := range dummyStream.chunks {
+		result.Write(chunk.Content)
+	}
+	if !bytes.Equal(result.Bytes(), content[5:15]) {
+		t.Errorf("范围下载的内容不匹配, got: %s, expected: %s", result.Bytes(), content[5:15])
+	}
+
+	req = &pb.DownloadFileRequest{FilePath: testFileName, Offset: int64(len(content)) + 1}
+	if err := s.DownloadFile(req, &dummyDownloadFileServer{ctx: context.Background()}); err == nil {
+		t.Error("offset 超出文件大小时应当返回错误")
+	}
+}
+
+// dummyUploadFileServer 用于模拟 gRPC 的 client stream
+type dummyUploadFileServer struct {
+	dummyDownloadFileServer
+	reqs []*pb.UploadFileRequest
+	resp *pb.UploadFileResponse
+	err  error // 请求消息用完后返回的错误，nil表示 io.EOF
+}
+
+// Recv 依次返回预先准备好的请求消息
+func (d *dummyUploadFileServer) Recv() (*pb.UploadFileRequest, error) {
+	if len(d.reqs) == 0 {
+		if d.err != nil {
+			return nil, d.err
+		}
+		return nil, io.EOF
+	}
+	req := d.reqs[0]
+	d.reqs = d.reqs[1:]
+	return req, nil
+}
+
+func (d *dummyUploadFileServer) SendAndClose(resp *pb.UploadFileResponse) error {
+	d.resp = resp
+	return nil
+}
+
+func uploadRequests(path string, size int64, parts ...string) []*pb.UploadFileRequest {
+	reqs := []*pb.UploadFileRequest{{
+		Data: &pb.UploadFileRequest_Info{Info: &pb.UploadFileInfo{FilePath: path, Size: size}},
+	}}
+	for _, part := range parts {
+		reqs = append(reqs, &pb.UploadFileRequest{
+			Data: &pb.UploadFileRequest_Chunk{Chunk: &pb.FileChunk{Content: []byte(part)}},
+		})
+	}
+	return reqs
+}
+
+func TestDownloadFileCompression(t *testing.T) {
+	storageRoot := t.TempDir()
+	text := bytes.Repeat([]byte("hello compression "), 10000)
+	random := make([]byte, 200*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	files := map[string][]byte{
+		"text.txt":   text,
+		"random.bin": random,
+		"photo.jpg":  text, // 内容可压缩，但内容类型表明已经压缩过
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(storageRoot, name), content, 0644); err != nil {
+			t.Fatalf("写入测试文件失败: %v", err)
+		}
+	}
+	s := newTestFileServer(t, storageRoot)
+
+	tests := []struct {
+		file        string
+		request     string
+		compression string
+	}{
+		{"text.txt", compressionGzip, compressionGzip},
+		{"text.txt", compressionZstd, compressionZstd},
+		{"text.txt", "", compressionNone},
+		{"text.txt", "brotli", compressionNone},
+		{"random.bin", compressionZstd, compressionNone},
+		{"photo.jpg", compressionGzip, compressionNone},
+	}
+	for _, tt := range tests {
+		stream := &dummyDownloadFileServer{ctx: context.Background()}
+		req := &pb.DownloadFileRequest{FilePath: tt.file, Compression: tt.request}
+		if err := s.DownloadFile(req, stream); err != nil {
+			t.Fatalf("%s(%s) DownloadFile 返回错误: %v", tt.file, tt.request, err)
+		}
+		if got := stream.header.Get(compressionMetadataKey); len(got) != 1 || got[0] != tt.compression {
+			t.Errorf("%s(%s) 压缩算法为 %v，预期 %s", tt.file, tt.request, got, tt.compression)
+			continue
+		}
+
+		var wire bytes.Buffer
+		for _, chunk := range stream.chunks {
+			wire.Write(chunk.Content)
+		}
+		data := wire.Bytes()
+		if tt.compression != compressionNone {
+			if wire.Len() >= len(files[tt.file]) {
+				t.Errorf("%s(%s) 压缩后大小 %d 未减小", tt.file, tt.request, wire.Len())
+			}
+			reader, err := newDecompressor(tt.compression, &wire)
+			if err != nil {
+				t.Fatalf("创建解压器失败: %v", err)
+			}
+			if data, err = io.ReadAll(reader); err != nil {
+				t.Fatalf("解压失败: %v", err)
+			}
+			reader.Close()
+		}
+		if !bytes.Equal(data, files[tt.file]) {
+			t.Errorf("%s(%s) 内容不匹配", tt.file, tt.request)
+		}
+		// trailer 中的大小和校验值基于压缩前的内容
+		if got := stream.trailer.Get(sizeMetadataKey); len(got) != 1 || got[0] != fmt.Sprint(len(files[tt.file])) {
+			t.Errorf("%s(%s) trailer 大小为 %v", tt.file, tt.request, got)
+		}
+	}
+}
+
+func TestDownloadFileChunkSize(t *testing.T) {
+	storageRoot := t.TempDir()
+	content := make([]byte, 3*defaultChunkSize+100)
+	rand.New(rand.NewSource(2)).Read(content)
+	if err := os.WriteFile(filepath.Join(storageRoot, "big.bin"), content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	s := newTestFileServer(t, storageRoot)
+
+	tests := []struct {
+		configured int
+		expected   int
+	}{
+		{0, defaultChunkSize},
+		{64 * 1024, 64 * 1024},
+		{100, minChunkSize},
+		{16 * 1024 * 1024, maxChunkSize},
+	}
+	for _, tt := range tests {
+		s.transfer.ChunkSize = tt.configured
+		stream := &dummyDownloadFileServer{ctx: context.Background()}
+		if err := s.DownloadFile(&pb.DownloadFileRequest{FilePath: "big.bin"}, stream); err != nil {
+			t.Fatalf("DownloadFile 返回错误: %v", err)
+		}
+		var result bytes.Buffer
+		for i, chunk := range stream.chunks {
+			// 除最后一块外，每块都应当是完整的分块大小
+			if i < len(stream.chunks)-1 && len(chunk.Content) != tt.expected {
+				t.Fatalf("chunkSize=%d 时第 %d 块大小为 %d，预期 %d", tt.configured, i, len(chunk.Content), tt.expected)
+			}
+			result.Write(chunk.Content)
+		}
+		if !bytes.Equal(result.Bytes(), content) {
+			t.Errorf("chunkSize=%d 时下载内容不匹配", tt.configured)
+		}
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	storageRoot := "./storage"
+	defer os.RemoveAll(storageRoot)
+	s := newTestFileServer(t, storageRoot)
+
+	content := "This is a test content for UploadFile testing."
+	stream := &dummyUploadFileServer{
+		dummyDownloadFileServer: dummyDownloadFileServer{ctx: context.Background()},
+		reqs:                    uploadRequests("upload/upload_test.txt", int64(len(content)), content[:10], content[10:]),
+	}
+	if err := s.UploadFile(stream); err != nil {
+		t.Fatalf("UploadFile 返回错误: %v", err)
+	}
+	if stream.resp == nil || stream.resp.Size != int64(len(content)) {
+		t.Fatalf("UploadFile 响应不正确: %+v", stream.resp)
+	}
+	data, err := os.ReadFile(filepath.Join(storageRoot, "upload", "upload_test.txt"))
+	if err != nil {
+		t.Fatalf("读取上传文件失败: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("上传的文件内容不匹配, got: %s, expected: %s", data, content)
+	}
+
+	// 声明的大小与实际数据不符时应当失败，且不留下不完整的文件
+	stream = &dummyUploadFileServer{
+		dummyDownloadFileServer: dummyDownloadFileServer{ctx: context.Background()},
+		reqs:                    uploadRequests("short.txt", 100, "too short"),
+	}
+	if err := s.UploadFile(stream); err == nil {
+		t.Fatal("文件大小不匹配时 UploadFile 应当返回错误")
+	}
+	if _, err := os.Stat(filepath.Join(storageRoot, "short.txt")); !os.IsNotExist(err) {
+		t.Error("上传失败后不应保留不完整的文件")
+	}
+
+	// 超出声明的大小时立即拒绝，不等待客户端发完；压缩数据同样按解压后的大小检查。
+	// 请求用完后流返回 Canceled，只有在此之前拒绝才会得到 InvalidArgument
+	var bomb bytes.Buffer
+	compressor, _ := newCompressor(compressionGzip, &bomb)
+	compressor.Write(make([]byte, 1<<20))
+	compressor.Close()
+	long := uploadRequests("long.txt", 4, "too long")
+	zipped := uploadRequests("long.txt", 4, bomb.String())
+	zipped[0].GetInfo().Compression = compressionGzip
+	for _, reqs := range [][]*pb.UploadFileRequest{long, zipped} {
+		stream = &dummyUploadFileServer{
+			dummyDownloadFileServer: dummyDownloadFileServer{ctx: context.Background()},
+			reqs:                    reqs,
+			err:                     status.Error(codes.Canceled, "context canceled"),
+		}
+		if err := s.UploadFile(stream); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("超出声明大小的上传应当返回 InvalidArgument，实际: %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(storageRoot, "long.txt")); !os.IsNotExist(err) {
+		t.Error("上传失败后不应保留不完整的文件")
+	}
+
+	// 覆盖已有文件时中途失败，原有内容保持不变，也不留下临时文件
+	stream = &dummyUploadFileServer{
+		dummyDownloadFileServer: dummyDownloadFileServer{ctx: context.Background()},
+		reqs:                    uploadRequests("upload/upload_test.txt", 100, "partial "),
+		err:                     status.Error(codes.Canceled, "context canceled"),
+	}
+	if err := s.UploadFile(stream); err == nil {
+		t.Fatal("上传流中断时 UploadFile 应当返回错误")
+	}
+	data, err = os.ReadFile(filepath.Join(storageRoot, "upload", "upload_test.txt"))
+	if err != nil || string(data) != content {
+		t.Errorf("上传失败后原有文件被修改: %q, %v", data, err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(storageRoot, "upload", ".upload-*")); len(leftovers) > 0 {
+		t.Errorf("上传失败后留下了临时文件: %v", leftovers)
+	}
+}
+
+// uploadRecorder 记录服务端收到的 UploadFile 请求声明的压缩算法和线路上的数据量
+type uploadRecorder struct {
+	grpc.ServerStream
+	compression string
+	wireBytes   int
+}
+
+func (r *uploadRecorder) RecvMsg(m any) error {
+	if err := r.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if req, ok := m.(*pb.UploadFileRequest); ok {
+		if info := req.GetInfo(); info != nil {
+			r.compression = info.GetCompression()
+		}
+		r.wireBytes += len(req.GetChunk().GetContent())
+	}
+	return nil
+}
+
+func TestUploadFileCompressed(t *testing.T) {
+	stor, err := storage.NewMemoryStorage("", 0)
+	if err != nil {
+		t.Fatalf("创建内存存储失败: %v", err)
+	}
+	var recorder *uploadRecorder
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听端口失败: %v", err)
+	}
+	record := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		recorder = &uploadRecorder{ServerStream: ss}
+		return handler(srv, recorder)
+	}
+	grpcServer := grpc.NewServer(append(serverOptions(), grpc.ChainStreamInterceptor(record))...)
+	pb.RegisterFileServiceServer(grpcServer, &FileServer{storage: stor})
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	conn, err := GetConn("node1", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("建立grpc连接失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	m := NewManager("root", &sync.Map{}, t.TempDir(), config.TransferConfig{})
+	m.relativePath, m.currentNode, m.currentConn = []string{"node1"}, "node1", conn
+	m.peer = &pb.GetNodeInfoResponse{Features: []string{featureUpload, featureUploadCompression}}
+	content := bytes.Repeat([]byte("compressible upload "), 20000)
+	localFile := filepath.Join(t.TempDir(), "report.log")
+	if err := os.WriteFile(localFile, content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	download := func(p string) []byte {
+		r, err := stor.DownloadFile(context.Background(), p, 0, 0)
+		if err != nil {
+			t.Fatalf("读取上传的文件失败: %v", err)
+		}
+		defer r.Close()
+		data, _ := io.ReadAll(r)
+		return data
+	}
+
+	if ret := put(m, []string{"-z", localFile}); ret != "文件上传成功，共 "+utils.FormatFileSize(int64(len(content))) {
+		t.Fatalf("put -z 返回: %s", ret)
+	}
+	if recorder.compression != compressionZstd || recorder.wireBytes >= len(content)/10 {
+		t.Errorf("put -z 没有压缩传输: 算法 %q，传输 %d 字节", recorder.compression, recorder.wireBytes)
+	}
+	if !bytes.Equal(download("report.log"), content) {
+		t.Error("压缩上传后的文件内容不匹配")
+	}
+
+	// 对方节点没有声明支持压缩上传时按原样发送
+	m.peer = &pb.GetNodeInfoResponse{Features: []string{featureUpload}}
+	if ret := put(m, []string{"-z", localFile, "plain.log"}); ret[:6] == "Error:" {
+		t.Fatalf("put -z 返回: %s", ret)
+	}
+	if recorder.compression != "" || recorder.wireBytes != len(content) {
+		t.Errorf("对方不支持时不应压缩: 算法 %q，传输 %d 字节", recorder.compression, recorder.wireBytes)
+	}
+	if !bytes.Equal(download("plain.log"), content) {
+		t.Error("未压缩上传后的文件内容不匹配")
+	}
+
+	// 服务端拒绝不支持的算法和损坏的压缩数据
+	s := &FileServer{storage: stor}
+	for _, reqs := range [][]*pb.UploadFileRequest{
+		{{Data: &pb.UploadFileRequest_Info{Info: &pb.UploadFileInfo{FilePath: "bad.txt", Size: 4, Compression: "brotli"}}}},
+		append([]*pb.UploadFileRequest{{Data: &pb.UploadFileRequest_Info{Info: &pb.UploadFileInfo{FilePath: "bad.txt", Size: 4, Compression: compressionGzip}}}},
+			uploadRequests("", 0, "not gzip data")[1:]...),
+	} {
+		stream := &dummyUploadFileServer{dummyDownloadFileServer: dummyDownloadFileServer{ctx: context.Background()}, reqs: reqs}
+		if err := s.UploadFile(stream); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("应当返回 InvalidArgument，实际: %v", err)
+		}
+	}
+	if _, err := stor.Stat(context.Background(), "bad.txt"); err == nil {
+		t.Error("上传失败时不应创建文件")
+	}
+}
+
+func TestMakeDirectoryAndDeleteFile(t *testing.T) {
+	storageRoot := "./storage"
+	defer os.RemoveAll(storageRoot)
+	s := newTestFileServer(t, storageRoot)
+	ctx := context.Background()
+
+	if _, err := s.MakeDirectory(ctx, &pb.MakeDirectoryRequest{DirectoryPath: "a/b"}); err != nil {
+		t.Fatalf("MakeDirectory 调用失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(storageRoot, "a", "b", "file.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+
+	// 非空目录不指定 recursive 时应当失败
+	if _, err := s.DeleteFile(ctx, &pb.DeleteFileRequest{FilePath: "a"}); err == nil {
+		t.Fatal("删除非空目录时应当返回错误")
+	}
+	if _, err := s.DeleteFile(ctx, &pb.DeleteFileRequest{FilePath: "a/b/file.txt"}); err != nil {
+		t.Fatalf("DeleteFile 调用失败: %v", err)
+	}
+	if _, err := s.DeleteFile(ctx, &pb.DeleteFileRequest{FilePath: "a", Recursive: true}); err != nil {
+		t.Fatalf("递归删除目录失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(storageRoot, "a")); !os.IsNotExist(err) {
+		t.Error("目录 a 应当已被删除")
+	}
+
+	// 不允许删除根目录或越界路径
+	if _, err := s.DeleteFile(ctx, &pb.DeleteFileRequest{FilePath: "", Recursive: true}); err == nil {
+		t.Error("删除存储根目录时应当返回错误")
+	}
+	if _, err := s.DeleteFile(ctx, &pb.DeleteFileRequest{FilePath: "../rpc.go"}); err == nil {
+		t.Error("删除存储目录之外的文件时应当返回错误")
+	}
+}
+
+func TestRenameAndMove(t *testing.T) {
+	storageRoot := "./storage"
+	defer os.RemoveAll(storageRoot)
+	s := newTestFileServer(t, storageRoot)
+	ctx := context.Background()
+
+	if err := os.MkdirAll(filepath.Join(storageRoot, "dir"), 0755); err != nil {
+		t.Fatalf("创建测试目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(storageRoot, "old.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+
+	if _, err := s.Rename(ctx, &pb.RenameRequest{FilePath: "old.txt", NewName: "new.txt"}); err != nil {
+		t.Fatalf("Rename 调用失败: %v", err)
+	}
+	if _, err := s.Rename(ctx, &pb.RenameRequest{FilePath: "new.txt", NewName: "../escape.txt"}); err == nil {
+		t.Error("新名称包含路径分隔符时应当返回错误")
+	}
+	// 反斜杠分隔的路径按规范化后的位置重命名，留在原目录中
+	if err := os.WriteFile(filepath.Join(storageRoot, "dir", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	if _, err := s.Rename(ctx, &pb.RenameRequest{FilePath: `dir\a.txt`, NewName: "b.txt"}); err != nil {
+		t.Fatalf("Rename 调用失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(storageRoot, "dir", "b.txt")); err != nil {
+		t.Errorf("文件应当被重命名为 dir/b.txt: %v", err)
+	}
+
+	// 目标为已存在的目录时移动到该目录下
+	if _, err := s.Move(ctx, &pb.MoveRequest{SourcePath: "new.txt", DestinationPath: "dir"}); err != nil {
+		t.Fatalf("Move 调用失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(storageRoot, "dir", "new.txt")); err != nil {
+		t.Errorf("文件应当被移动到 dir/new.txt: %v", err)
+	}
+	if _, err := s.Move(ctx, &pb.MoveRequest{SourcePath: "dir", DestinationPath: "dir/sub"}); err == nil {
+		t.Error("将目录移动到其自身之下时应当返回错误")
+	}
+	if _, err := s.Move(ctx, &pb.MoveRequest{SourcePath: "dir/new.txt", DestinationPath: "../new.txt"}); err == nil {
+		t.Error("移动到存储目录之外时应当返回错误")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	storageRoot := "./storage"
+	defer os.RemoveAll(storageRoot)
+	s := newTestFileServer(t, storageRoot)
+	content := []byte("checksum me")
+	if err := os.WriteFile(filepath.Join(storageRoot, "sum.txt"), content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+
+	resp, err := s.Checksum(context.Background(), &pb.ChecksumRequest{FilePath: "sum.txt"})
+	if err != nil {
+		t.Fatalf("Checksum 调用失败: %v", err)
+	}
+	digest := sha256.Sum256(content)
+	if resp.Algorithm != "sha256" || resp.Checksum != hex.EncodeToString(digest[:]) || resp.Size != int64(len(content)) {
+		t.Errorf("Checksum 响应不正确: %+v", resp)
+	}
+	if _, err := s.Checksum(context.Background(), &pb.ChecksumRequest{FilePath: "sum.txt", Algorithm: "crc32"}); err == nil {
+		t.Error("不支持的算法应当返回错误")
+	}
+}
+
+func TestStat(t *testing.T) {
+	storageRoot := "./storage"
+	defer os.RemoveAll(storageRoot)
+	s := newTestFileServer(t, storageRoot)
+	if err := os.MkdirAll(filepath.Join(storageRoot, "dir"), 0755); err != nil {
+		t.Fatalf("创建测试目录失败: %v", err)
+	}
+	content := []byte("hello")
+	if err := os.WriteFile(filepath.Join(storageRoot, "dir", "a.json"), content, 0640); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+
+	resp, err := s.Stat(context.Background(), &pb.StatRequest{Path: "dir/a.json"})
+	if err != nil {
+		t.Fatalf("Stat 调用失败: %v", err)
+	}
+	e := resp.Entry
+	if e.Name != "a.json" || e.IsDirectory || e.Size != int64(len(content)) || e.ContentType != "application/json" {
+		t.Errorf("文件信息不正确: %+v", e)
+	}
+	if os.FileMode(e.Mode).Perm() != 0640 {
+		t.Errorf("权限不正确: %v", os.FileMode(e.Mode))
+	}
+
+	resp, err = s.Stat(context.Background(), &pb.StatRequest{Path: "dir"})
+	if err != nil {
+		t.Fatalf("Stat 调用失败: %v", err)
+	}
+	if !resp.Entry.IsDirectory || resp.Entry.ChildCount != 1 {
+		t.Errorf("目录信息不正确: %+v", resp.Entry)
+	}
+
+	if _, err := s.Stat(context.Background(), &pb.StatRequest{Path: "missing"}); err == nil {
+		t.Error("查询不存在的文件时应当返回错误")
+	}
+}
+
+func TestStatSymlink(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink("../outside", filepath.Join(root, "link")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+	stor, err := storage.NewLocalStorage(root, storage.SymlinkLink)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	s := &FileServer{storage: stor}
+	resp, err := s.Stat(context.Background(), &pb.StatRequest{Path: "link"})
+	if err != nil {
+		t.Fatalf("Stat 调用失败: %v", err)
+	}
+	e := resp.Entry
+	if !e.IsSymlink || e.LinkTarget != "../outside" || e.IsDirectory {
+		t.Errorf("链接信息不正确: %+v", e)
+	}
+	if got := formatEntry(e, false); !strings.HasPrefix(got, "l  link -> ../outside ") {
+		t.Errorf("ls 应当显示链接及其目标: %q", got)
+	}
+	if got := formatEntry(e, true); !strings.HasSuffix(got, "  link -> ../outside") || !strings.HasPrefix(got, "L") {
+		t.Errorf("ls -l 应当显示链接及其目标: %q", got)
+	}
+}
+
+func TestListDirectoryPagination(t *testing.T) {
+	storageRoot := "./storage"
+	defer os.RemoveAll(storageRoot)
+	s := newTestFileServer(t, storageRoot)
+	for i := 0; i < 25; i++ {
+		name := filepath.Join(storageRoot, fmt.Sprintf("file%02d.txt", i))
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatalf("写入测试文件失败: %v", err)
+		}
+	}
+
+	var names []string
+	var pages int
+	req := &pb.ListDirectoryRequest{PageSize: 10}
+	for {
+		resp, err := s.ListDirectory(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ListDirectory 调用失败: %v", err)
+		}
+		if len(resp.Entries) > 10 {
+			t.Fatalf("单页条目数超过 page_size: %d", len(resp.Entries))
+		}
+		pages++
+		for _, e := range resp.Entries {
+			names = append(names, e.Name)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	if pages != 3 || len(names) != 25 {
+		t.Fatalf("分页结果不正确: %d 页, %d 个条目", pages, len(names))
+	}
+	for i, name := range names {
+		if expected := fmt.Sprintf("file%02d.txt", i); name != expected {
+			t.Fatalf("第 %d 个条目应为 %s，实际为 %s", i, expected, name)
+		}
+	}
+
+	// 不指定 page_size 时使用默认值，过大的 page_size 按上限返回
+	for i := 25; i < maxPageSize+1; i++ {
+		if err := os.WriteFile(filepath.Join(storageRoot, fmt.Sprintf("file%04d.txt", i)), nil, 0644); err != nil {
+			t.Fatalf("写入测试文件失败: %v", err)
+		}
+	}
+	for _, tt := range []struct {
+		pageSize int32
+		want     int
+	}{{0, defaultPageSize}, {maxPageSize * 10, maxPageSize}} {
+		resp, err := s.ListDirectory(context.Background(), &pb.ListDirectoryRequest{PageSize: tt.pageSize})
+		if err != nil {
+			t.Fatalf("ListDirectory 调用失败: %v", err)
+		}
+		if len(resp.Entries) != tt.want || resp.NextPageToken == "" {
+			t.Errorf("page_size 为 %d 时应返回 %d 个条目和下一页的游标，实际 %d 个", tt.pageSize, tt.want, len(resp.Entries))
+		}
+	}
+}
+
+func TestCopyFrom(t *testing.T) {
+	srcStor, err := storage.NewLocalStorage(t.TempDir(), storage.SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	dstStor, err := storage.NewLocalStorage(t.TempDir(), storage.SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	content := bytes.Repeat([]byte("node-to-node "), 500)
+	if err := os.WriteFile(filepath.Join(srcStor.GetRoot(), "src.bin"), content, 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(dstStor.GetRoot(), "inbox"), 0755); err != nil {
+		t.Fatalf("创建测试目录失败: %v", err)
+	}
+
+	var cluster sync.Map
+	_, srcAddr := serveTestFileServer(t, &FileServer{storage: srcStor, nodes: &cluster})
+	_, dstAddr := serveTestFileServer(t, &FileServer{storage: dstStor, nodes: &cluster})
+	cluster.Store("node1", srcAddr)
+	cluster.Store("node2", dstAddr)
+
+	m := NewManager("root", &cluster, t.TempDir(), config.TransferConfig{})
+	if ret := cp(m, []string{"node1/src.bin", "node2/inbox"}); ret != "复制成功，共 "+utils.FormatFileSize(int64(len(content))) {
+		t.Fatalf("cp 返回: %s", ret)
+	}
+	data, err := os.ReadFile(filepath.Join(dstStor.GetRoot(), "inbox", "src.bin"))
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("复制后的文件内容不匹配: %v", err)
+	}
+
+	// -z 时由目标节点请求源节点压缩传输
+	if ret := cp(m, []string{"-z", "node1/src.bin", "node2/inbox/compressed.bin"}); ret != "复制成功，共 "+utils.FormatFileSize(int64(len(content))) {
+		t.Fatalf("cp -z 返回: %s", ret)
+	}
+	data, err = os.ReadFile(filepath.Join(dstStor.GetRoot(), "inbox", "compressed.bin"))
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("压缩复制后的文件内容不匹配: %v", err)
+	}
+
+	if ret := cp(m, []string{"node3/src.bin", "node2/inbox"}); ret != ErrorMsg("源节点不存在：node3") {
+		t.Errorf("源节点不存在时返回: %s", ret)
+	}
+	if ret := cp(m, []string{"node1/missing.bin", "node2/missing.bin"}); ret[:6] != "Error:" {
+		t.Errorf("源文件不存在时应当返回错误: %s", ret)
+	}
+	if _, err := os.Stat(filepath.Join(dstStor.GetRoot(), "missing.bin")); !os.IsNotExist(err) {
+		t.Error("复制失败时不应在目标节点留下文件")
+	}
+}
+
+func TestCopyFromMemoryStorage(t *testing.T) {
+	srcStor, err := storage.NewMemoryStorage("", 0)
+	if err != nil {
+		t.Fatalf("创建内存存储失败: %v", err)
+	}
+	dstStor, err := storage.NewMemoryStorage("", 0)
+	if err != nil {
+		t.Fatalf("创建内存存储失败: %v", err)
+	}
+	content := bytes.Repeat([]byte("in-memory "), 50000)
+	ctx := context.Background()
+	if err := srcStor.UploadFile(ctx, "data/src.bin", bytes.NewReader(content)); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+
+	var cluster sync.Map
+	_, srcAddr := serveTestFileServer(t, &FileServer{storage: srcStor, nodes: &cluster})
+	dstConn, dstAddr := serveTestFileServer(t, &FileServer{storage: dstStor, nodes: &cluster})
+	cluster.Store("node1", srcAddr)
+	cluster.Store("node2", dstAddr)
+
+	m := NewManager("root", &cluster, t.TempDir(), config.TransferConfig{})
+	if ret := cp(m, []string{"node1/data/src.bin", "node2/copy.bin"}); ret != "复制成功，共 "+utils.FormatFileSize(int64(len(content))) {
+		t.Fatalf("cp 返回: %s", ret)
+	}
+	client := pb.NewFileServiceClient(dstConn)
+	stat, err := client.Stat(ctx, &pb.StatRequest{Path: "copy.bin"})
+	if err != nil || stat.GetEntry().GetSize() != int64(len(content)) {
+		t.Fatalf("复制后的文件信息不正确: %v, %v", stat, err)
+	}
+	sum, err := client.Checksum(ctx, &pb.ChecksumRequest{FilePath: "copy.bin", Algorithm: "sha256"})
+	want := sha256.Sum256(content)
+	if err != nil || sum.Checksum != hex.EncodeToString(want[:]) {
+		t.Errorf("复制后的文件校验和不匹配: %v, %v", sum, err)
+	}
+	if _, err := client.Stat(ctx, &pb.StatRequest{Path: "data"}); status.Code(err) != codes.NotFound {
+		t.Errorf("目标节点不应出现源节点的目录，实际: %v", err)
+	}
+}
+
+// benchmarkFileSize 吞吐量基准测试使用的文件大小
+const benchmarkFileSize = 64 * 1024 * 1024
+
+// writeBenchmarkFile 在 root 下写入 benchmarkFileSize 字节的随机文件
+func writeBenchmarkFile(b *testing.B, root, name string) {
+	b.Helper()
+	content := make([]byte, benchmarkFileSize)
+	rand.New(rand.NewSource(3)).Read(content)
+	if err := os.WriteFile(filepath.Join(root, name), content, 0644); err != nil {
+		b.Fatalf("写入测试文件失败: %v", err)
+	}
+}
+
+// BenchmarkDownloadFile 测量通过本机回环连接下载文件的吞吐量（MB/s），覆盖不同分块大小
+func BenchmarkDownloadFile(b *testing.B) {
+	storageRoot := b.TempDir()
+	writeBenchmarkFile(b, storageRoot, "bench.bin")
+	for _, size := range []int{32 * 1024, defaultChunkSize, maxChunkSize} {
+		b.Run(utils.FormatFileSize(int64(size)), func(b *testing.B) {
+			s := newTestFileServer(b, storageRoot)
+			s.transfer.ChunkSize = size
+			conn, _ := serveTestFileServer(b, s)
+			client := pb.NewFileServiceClient(conn)
+			b.SetBytes(benchmarkFileSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				stream, err := client.DownloadFile(context.Background(), &pb.DownloadFileRequest{FilePath: "bench.bin"})
+				if err != nil {
+					b.Fatalf("DownloadFile 调用失败: %v", err)
+				}
+				reader, err := newStreamReader(stream)
+				if err != nil {
+					b.Fatalf("创建流读取器失败: %v", err)
+				}
+				if _, err := io.Copy(io.Discard, reader); err != nil {
+					b.Fatalf("接收文件失败: %v", err)
+				}
+				if err := reader.verify(); err != nil {
+					b.Fatalf("校验失败: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCopyFrom 测量两个进程内节点之间直接复制文件的吞吐量（MB/s）
+func BenchmarkCopyFrom(b *testing.B) {
+	srcRoot := b.TempDir()
+	writeBenchmarkFile(b, srcRoot, "bench.bin")
+	srcStor, err := storage.NewLocalStorage(srcRoot, storage.SymlinkFollow)
+	if err != nil {
+		b.Fatalf("创建本地存储失败: %v", err)
+	}
+	dstStor, err := storage.NewLocalStorage(b.TempDir(), storage.SymlinkFollow)
+	if err != nil {
+		b.Fatalf("创建本地存储失败: %v", err)
+	}
+	var cluster sync.Map
+	_, srcAddr := serveTestFileServer(b, &FileServer{storage: srcStor, nodes: &cluster})
+	dstConn, _ := serveTestFileServer(b, &FileServer{storage: dstStor, nodes: &cluster})
+	cluster.Store("node1", srcAddr)
+	client := pb.NewFileServiceClient(dstConn)
+
+	b.SetBytes(benchmarkFileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := client.CopyFrom(context.Background(), &pb.CopyFromRequest{
+			SourceNode:      "node1",
+			SourcePath:      "bench.bin",
+			DestinationPath: "bench.bin",
+		})
+		if err != nil {
+			b.Fatalf("CopyFrom 调用失败: %v", err)
+		}
+	}
+}
+
+func TestStatusCodes(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir", "sub"), 0755); err != nil {
+		t.Fatalf("创建测试目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "file.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	client := pb.NewFileServiceClient(startTestServer(t, newTestFileServer(t, root).storage))
+	ctx := context.Background()
+	download := func(p string) error {
+		stream, err := client.DownloadFile(ctx, &pb.DownloadFileRequest{FilePath: p})
+		if err != nil {
+			return err
+		}
+		for {
+			if _, err := stream.Recv(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"查看不存在的文件", func() error {
+			_, err := client.Stat(ctx, &pb.StatRequest{Path: "missing.txt"})
+			return err
+		}, codes.NotFound},
+		{"列出不存在的目录", func() error {
+			_, err := client.ListDirectory(ctx, &pb.ListDirectoryRequest{DirectoryPath: "missing"})
+			return err
+		}, codes.NotFound},
+		{"列出文件", func() error {
+			_, err := client.ListDirectory(ctx, &pb.ListDirectoryRequest{DirectoryPath: "file.txt"})
+			return err
+		}, codes.FailedPrecondition},
+		{"下载不存在的文件", func() error { return download("missing.txt") }, codes.NotFound},
+		{"下载目录", func() error { return download("dir") }, codes.FailedPrecondition},
+		{"下载存储根目录之外的文件", func() error { return download("../rpc.go") }, codes.PermissionDenied},
+		{"删除非空目录", func() error {
+			_, err := client.DeleteFile(ctx, &pb.DeleteFileRequest{FilePath: "dir"})
+			return err
+		}, codes.FailedPrecondition},
+		{"删除存储根目录", func() error {
+			_, err := client.DeleteFile(ctx, &pb.DeleteFileRequest{FilePath: "", Recursive: true})
+			return err
+		}, codes.PermissionDenied},
+		{"移动到已存在的文件", func() error {
+			if err := os.WriteFile(filepath.Join(root, "dir", "file.txt"), nil, 0644); err != nil {
+				t.Fatalf("写入测试文件失败: %v", err)
+			}
+			_, err := client.Move(ctx, &pb.MoveRequest{SourcePath: "file.txt", DestinationPath: "dir"})
+			return err
+		}, codes.AlreadyExists},
+		{"非法的新名称", func() error {
+			_, err := client.Rename(ctx, &pb.RenameRequest{FilePath: "file.txt", NewName: "a/b"})
+			return err
+		}, codes.InvalidArgument},
+		{"不支持的校验算法", func() error {
+			_, err := client.Checksum(ctx, &pb.ChecksumRequest{FilePath: "file.txt", Algorithm: "crc32"})
+			return err
+		}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		if got := status.Code(tt.call()); got != tt.want {
+			t.Errorf("%s: 状态码为 %v，期望 %v", tt.name, got, tt.want)
+		}
+	}
+
+	// 未分类的错误不把原始信息（可能包含服务端的绝对路径）返回给调用方
+	err := toStatusError(fmt.Errorf("open %s: too many open files", filepath.Join(root, "file.txt")))
+	if status.Code(err) != codes.Internal || strings.Contains(err.Error(), root) {
+		t.Errorf("未分类的错误应当返回不含细节的 Internal，实际: %v", err)
+	}
+
+	// 存储根目录被删除或卸载时返回 Unavailable，而不是文件不存在
+	if err := os.RemoveAll(root); err != nil {
+		t.Fatalf("删除存储根目录失败: %v", err)
+	}
+	if _, err := client.Stat(ctx, &pb.StatRequest{Path: "file.txt"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("存储根目录不存在时应当返回 Unavailable，实际: %v", err)
+	}
+}
+
+func TestDescribeError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{status.Error(codes.NotFound, "文件或目录不存在: a.txt"), "文件或目录不存在: a.txt"},
+		{status.Error(codes.Unimplemented, "unknown method Find"), "对方节点版本过旧，不支持该操作"},
+		{status.Error(codes.DeadlineExceeded, "context deadline exceeded"), "请求超时"},
+		{fmt.Errorf("远程调用出错：%w", status.Error(codes.ResourceExhausted, "下载流过多")), "远程调用出错：节点繁忙：下载流过多"},
+		{status.Error(codes.ResourceExhausted, "存储空间不足：内存存储已用 10 字节"), "存储空间不足：内存存储已用 10 字节"},
+		{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF.Error()},
+	}
+	for _, tt := range tests {
+		if got := describeError(tt.err); got != tt.want {
+			t.Errorf("describeError(%v) = %q，期望 %q", tt.err, got, tt.want)
+		}
+	}
 }
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	pb "ZFS/grpc"
+	"ZFS/utils"
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSearchTimeout search 等待每个节点的默认时间
+const defaultSearchTimeout = 10 * time.Second
+
+// searchLimit 每个节点最多返回的结果数
+const searchLimit = 1000
+
+// nodeSearch 一个节点的查找结果
+type nodeSearch struct {
+	node      string
+	results   []*pb.FindResult
+	truncated bool  // 结果数超过上限，只保留了前 searchLimit 项
+	err       error // 节点无法访问或查找失败，results 中是出错前收到的部分结果
+}
+
+// searchNodes 并发地在 nodes 中的每个节点上按名称查找，每个节点最多等待 timeout，按节点名排序返回
+func searchNodes(ctx context.Context, nodes *sync.Map, req *pb.FindRequest, timeout time.Duration) []nodeSearch {
+	var names, addrs []string
+	nodes.Range(func(key, value any) bool {
+		names = append(names, key.(string))
+		addrs = append(addrs, value.(string))
+		return true
+	})
+	searches := make([]nodeSearch, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			searches[i] = searchNode(ctx, names[i], addrs[i], req, timeout)
+		}(i)
+	}
+	wg.Wait()
+	sort.Slice(searches, func(i, j int) bool { return searches[i].node < searches[j].node })
+	return searches
+}
+
+func searchNode(ctx context.Context, node, addr string, req *pb.FindRequest, timeout time.Duration) nodeSearch {
+	s := nodeSearch{node: node}
+	conn, err := GetConn(node, addr)
+	if err != nil {
+		s.err = err
+		return s
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// 多取一项，据此判断是否确实还有更多匹配项
+	limit := int(req.GetLimit())
+	if limit > 0 {
+		req = proto.Clone(req).(*pb.FindRequest)
+		req.Limit++
+	}
+	_, s.err = findFiles(ctx, pb.NewFileServiceClient(conn), req, func(r *pb.FindResult) {
+		s.results = append(s.results, r)
+	})
+	if limit > 0 && len(s.results) > limit {
+		s.results = s.results[:limit]
+		s.truncated = true
+	}
+	return s
+}
+
+// parseSearchOptions 解析 search [-t 秒] <模式>
+func parseSearchOptions(args []string) (string, time.Duration, bool) {
+	timeout := defaultSearchTimeout
+	if len(args) == 3 && args[0] == "-t" {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return "", 0, false
+		}
+		timeout = time.Duration(n) * time.Second
+		args = args[2:]
+	}
+	if len(args) != 1 || args[0] == "" {
+		return "", 0, false
+	}
+	return args[0], timeout, true
+}
+
+// searchFailure 将节点的错误转换为简短的原因
+func searchFailure(err error) string {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded:
+		return "超时"
+	case codes.Unavailable:
+		return "无法连接"
+	default:
+		return describeError(err)
+	}
+}
+
+// formatSearch 按 <节点>/<路径> 列出结果，最后汇总匹配项数量和无法访问的节点
+func formatSearch(searches []nodeSearch) string {
+	var sb strings.Builder
+	var count, matched int
+	var failed []string
+	for _, s := range searches {
+		for _, r := range s.results {
+			if r.Entry.GetIsDirectory() {
+				sb.WriteString(fmt.Sprintf("%s/%s/\n", s.node, r.Path))
+			} else {
+				sb.WriteString(fmt.Sprintf("%s/%s  %s\n", s.node, r.Path, utils.FormatFileSize(r.Entry.GetSize())))
+			}
+		}
+		count += len(s.results)
+		if len(s.results) > 0 {
+			matched++
+		}
+		if s.err != nil {
+			failed = append(failed, fmt.Sprintf("%s（%s）", s.node, searchFailure(s.err)))
+		} else if s.truncated {
+			sb.WriteString(fmt.Sprintf("%s 的结果超过 %d 项，只显示前 %d 项\n", s.node, searchLimit, searchLimit))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("共找到 %d 项，分布在 %d 个节点上（查询了 %d 个节点）", count, matched, len(searches)))
+	if len(failed) > 0 {
+		sb.WriteString(fmt.Sprintf("\n无法访问的节点，结果可能不完整：%s", strings.Join(failed, "，")))
+	}
+	return sb.String()
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "ZFS/grpc"
+)
+
+func TestSearchNodes(t *testing.T) {
+	var nodes sync.Map
+	for i, files := range [][]string{
+		{"reports/report-2026-09.csv", "reports/report-2026-08.csv"},
+		{"inbox/report-2026-09.csv", "other.txt"},
+	} {
+		root := t.TempDir()
+		for _, name := range files {
+			p := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				t.Fatalf("创建目录失败: %v", err)
+			}
+			if err := os.WriteFile(p, []byte("data"), 0644); err != nil {
+				t.Fatalf("写入文件失败: %v", err)
+			}
+		}
+		_, addr := serveTestFileServer(t, newTestFileServer(t, root))
+		nodes.Store([]string{"node1", "node2"}[i], addr)
+	}
+
+	// 已经关闭的端口：连接被拒绝
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听端口失败: %v", err)
+	}
+	nodes.Store("node3", lis.Addr().String())
+	lis.Close()
+
+	// 接受连接但从不响应：等待超时
+	hang, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听端口失败: %v", err)
+	}
+	defer hang.Close()
+	go func() {
+		for {
+			conn, err := hang.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	nodes.Store("node4", hang.Addr().String())
+
+	start := time.Now()
+	searches := searchNodes(context.Background(), &nodes, &pb.FindRequest{Name: "report-2026-09.csv"}, time.Second)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("单个节点超时不应拖慢整个查询，耗时 %v", elapsed)
+	}
+	if len(searches) != 4 {
+		t.Fatalf("查询了 %d 个节点", len(searches))
+	}
+	want := map[string]string{"node1": "reports/report-2026-09.csv", "node2": "inbox/report-2026-09.csv"}
+	for _, s := range searches[:2] {
+		if s.err != nil || len(s.results) != 1 || s.results[0].Path != want[s.node] {
+			t.Errorf("%s 的结果不正确: %v, %v", s.node, s.results, s.err)
+		}
+	}
+	if s := searches[2]; s.node != "node3" || status.Code(s.err) != codes.Unavailable {
+		t.Errorf("node3 应当无法连接: %v", s.err)
+	}
+	if s := searches[3]; s.node != "node4" || status.Code(s.err) != codes.DeadlineExceeded {
+		t.Errorf("node4 应当超时: %v", s.err)
+	}
+
+	out := formatSearch(searches)
+	for _, line := range []string{
+		"node1/reports/report-2026-09.csv",
+		"node2/inbox/report-2026-09.csv",
+		"共找到 2 项，分布在 2 个节点上（查询了 4 个节点）",
+		"node3（无法连接），node4（超时）",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("输出中缺少 %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestSearchNodeTruncated(t *testing.T) {
+	_, addr := serveTestFileServer(t, newTestFileServer(t, writeFindTree(t)))
+	req := &pb.FindRequest{Type: "f", Limit: 5}
+
+	// 匹配项恰好等于上限时不算截断
+	if s := searchNode(context.Background(), "node1", addr, req, time.Second); s.err != nil || len(s.results) != 5 || s.truncated {
+		t.Errorf("结果为 %d 项，truncated=%v，err=%v", len(s.results), s.truncated, s.err)
+	}
+	req.Limit = 4
+	if s := searchNode(context.Background(), "node1", addr, req, time.Second); s.err != nil || len(s.results) != 4 || !s.truncated {
+		t.Errorf("结果为 %d 项，truncated=%v，err=%v", len(s.results), s.truncated, s.err)
+	}
+	if req.Limit != 4 {
+		t.Error("不应修改调用方的请求")
+	}
+}
+
+func TestParseSearchOptions(t *testing.T) {
+	tests := []struct {
+		args    []string
+		pattern string
+		timeout time.Duration
+		ok      bool
+	}{
+		{[]string{"*.csv"}, "*.csv", defaultSearchTimeout, true},
+		{[]string{"-t", "3", "report.csv"}, "report.csv", 3 * time.Second, true},
+		{[]string{}, "", 0, false},
+		{[]string{"-t", "0", "a"}, "", 0, false},
+		{[]string{"a", "b"}, "", 0, false},
+	}
+	for _, tt := range tests {
+		pattern, timeout, ok := parseSearchOptions(tt.args)
+		if ok != tt.ok || pattern != tt.pattern || timeout != tt.timeout {
+			t.Errorf("%v: 解析结果为 %q %v %v", tt.args, pattern, timeout, ok)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"ZFS/config"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"os"
+	"slices"
+)
+
+// 启用 tls 配置后节点间通信使用的凭证，未启用时为nil，StartServer 和 GetConn 使用明文连接。
+// 客户端每次拨号时按目标节点复制 clientTLS，见 nodeCredentials
+var (
+	serverCredentials credentials.TransportCredentials
+	clientTLS         *tls.Config
+)
+
+// setupTLS 根据配置加载证书，设置服务端与客户端使用的mTLS凭证
+func setupTLS(conf config.TLSConfig) error {
+	if !conf.Enable {
+		return nil
+	}
+	server, client, err := newTLSCredentials(conf)
+	if err != nil {
+		return err
+	}
+	serverCredentials, clientTLS = server, client
+	return nil
+}
+
+// clientCredentials 返回连接节点 node 使用的凭证，未启用 tls 时返回nil
+func clientCredentials(node string) credentials.TransportCredentials {
+	if clientTLS == nil {
+		return nil
+	}
+	return nodeCredentials(clientTLS, node)
+}
+
+// newTLSCredentials 创建mTLS凭证：双方都出示由同一CA签发的证书，并以证书CN作为节点身份。
+// 返回服务端凭证和客户端的基础配置，客户端需要经 nodeCredentials 指定目标节点后使用
+func newTLSCredentials(conf config.TLSConfig) (credentials.TransportCredentials, *tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("加载节点证书失败: %w", err)
+	}
+	caPEM, err := os.ReadFile(conf.CAFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取CA证书失败: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, nil, fmt.Errorf("CA证书格式不正确: %s", conf.CAFile)
+	}
+
+	clientAuth := tls.VerifyClientCertIfGiven
+	if conf.RequireClientAuth {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	server := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   clientAuth,
+		MinVersion:   tls.VersionTLS12,
+	}
+	// 节点地址来自服务发现，通常是IP，因此不按地址校验主机名，而是由 nodeCredentials 按节点名校验
+	client := &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return verifyPeerCertificate(state, pool, x509.ExtKeyUsageServerAuth)
+		},
+	}
+	return credentials.NewTLS(server), client, nil
+}
+
+// nodeCredentials 在 base 的证书链校验之外，要求对端证书属于节点 node，
+// 否则同一CA签发给其他节点的证书就能冒充任何节点
+func nodeCredentials(base *tls.Config, node string) credentials.TransportCredentials {
+	conf := base.Clone()
+	verifyChain := base.VerifyConnection
+	conf.VerifyConnection = func(state tls.ConnectionState) error {
+		if err := verifyChain(state); err != nil {
+			return err
+		}
+		return verifyPeerName(state.PeerCertificates[0], node)
+	}
+	return credentials.NewTLS(conf)
+}
+
+// verifyPeerName 检查证书的CN或SAN中的名称是否为节点名 node
+func verifyPeerName(cert *x509.Certificate, node string) error {
+	if node == "" {
+		return errors.New("没有指定对端节点名，无法验证对端证书")
+	}
+	if cert.Subject.CommonName == node || slices.Contains(cert.DNSNames, node) {
+		return nil
+	}
+	return fmt.Errorf("对端证书属于 %s，而不是节点 %s", cert.Subject.CommonName, node)
+}
+
+// verifyPeerCertificate 验证对端证书由配置的CA签发且可用于指定用途
+func verifyPeerCertificate(state tls.ConnectionState, roots *x509.CertPool, usage x509.ExtKeyUsage) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("对端没有提供证书")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+	return err
+}
+
+// peerIdentity 返回发起请求的节点身份，即其已验证证书的CN；明文连接或对端未出示证书时返回空字符串。
+// 证书是调用方身份的唯一来源，访问控制、限速等都按它区分调用方
+func peerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return info.State.VerifiedChains[0][0].Subject.CommonName
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"ZFS/config"
+	"ZFS/utils"
+	"context"
+	"crypto/tls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "ZFS/grpc"
+)
+
+// nodeTLSConfig 返回使用 GenCert 生成的证书的 TLS 配置
+func nodeTLSConfig(dir, name string) config.TLSConfig {
+	return config.TLSConfig{
+		Enable:            true,
+		CAFile:            filepath.Join(dir, "ca.crt"),
+		CertFile:          filepath.Join(dir, name+".crt"),
+		KeyFile:           filepath.Join(dir, name+".key"),
+		RequireClientAuth: true,
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	certDir := t.TempDir()
+	if err := GenCert([]string{"-out", certDir, "-nodes", "node1,node2"}); err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	// 另一个CA签发的证书不应被信任
+	rogueDir := t.TempDir()
+	if err := GenCert([]string{"-out", rogueDir, "-nodes", "intruder"}); err != nil {
+		t.Fatalf("生成证书失败: %v", err)
+	}
+	// 再次执行时复用已有的CA
+	caBefore, _ := os.ReadFile(filepath.Join(certDir, "ca.crt"))
+	if err := GenCert([]string{"-out", certDir, "-nodes", "node3"}); err != nil {
+		t.Fatalf("补发证书失败: %v", err)
+	}
+	if caAfter, _ := os.ReadFile(filepath.Join(certDir, "ca.crt")); string(caAfter) != string(caBefore) {
+		t.Error("补发证书时不应重新生成CA")
+	}
+
+	serverCreds, _, err := newTLSCredentials(nodeTLSConfig(certDir, "node1"))
+	if err != nil {
+		t.Fatalf("加载服务端证书失败: %v", err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听端口失败: %v", err)
+	}
+	identities := make(chan string, 1)
+	grpcServer := grpc.NewServer(grpc.Creds(serverCreds), grpc.UnaryInterceptor(
+		func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			identities <- peerIdentity(ctx)
+			return handler(ctx, req)
+		}))
+	pb.RegisterFileServiceServer(grpcServer, newTestFileServer(t, t.TempDir()))
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	call := func(creds credentials.TransportCredentials) error {
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = pb.NewFileServiceClient(conn).ListDirectory(ctx, &pb.ListDirectoryRequest{DirectoryPath: "."})
+		return err
+	}
+
+	_, node2TLS, err := newTLSCredentials(nodeTLSConfig(certDir, "node2"))
+	if err != nil {
+		t.Fatalf("加载客户端证书失败: %v", err)
+	}
+	if err := call(nodeCredentials(node2TLS, "node1")); err != nil {
+		t.Fatalf("使用有效证书调用失败: %v", err)
+	}
+	if identity := <-identities; identity != "node2" {
+		t.Errorf("节点身份为 %q，预期 node2", identity)
+	}
+
+	_, rogueTLS, err := newTLSCredentials(nodeTLSConfig(rogueDir, "intruder"))
+	if err != nil {
+		t.Fatalf("加载客户端证书失败: %v", err)
+	}
+	noCert := credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})
+	for name, creds := range map[string]credentials.TransportCredentials{
+		"明文连接":      insecure.NewCredentials(),
+		"未出示证书":     noCert,
+		"其他CA签发的证书": nodeCredentials(rogueTLS, "node1"),
+	} {
+		if err := call(creds); err == nil {
+			t.Errorf("%s 应当被拒绝", name)
+		}
+	}
+
+	// 同一CA签发给 node1 的证书不能冒充其他节点：连接 node3 时遇到 node1 的证书应当失败
+	if err := call(nodeCredentials(node2TLS, "node3")); err == nil || !strings.Contains(err.Error(), "node3") {
+		t.Errorf("对端证书与目标节点不符时应当拒绝连接，实际: %v", err)
+	}
+}
+
+func TestNewTLSCredentialsErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, err := newTLSCredentials(nodeTLSConfig(dir, "node1")); err == nil {
+		t.Error("证书文件不存在时应当失败")
+	}
+	caCert, caKey, err := utils.GenerateCA("test", time.Hour)
+	if err != nil {
+		t.Fatalf("生成CA失败: %v", err)
+	}
+	certPEM, keyPEM, err := utils.IssueCertificate(caCert, caKey, "node1", nil, time.Hour)
+	if err != nil {
+		t.Fatalf("签发证书失败: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "node1.crt"), certPEM, 0644)
+	os.WriteFile(filepath.Join(dir, "node1.key"), keyPEM, 0600)
+	os.WriteFile(filepath.Join(dir, "ca.crt"), []byte("not a certificate"), 0644)
+	if _, _, err := newTLSCredentials(nodeTLSConfig(dir, "node1")); err == nil {
+		t.Error("CA证书格式不正确时应当失败")
+	}
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	pb "ZFS/grpc"
+	"google.golang.org/grpc"
+	"io"
+	"sync"
+)
+
+// 文件流式传输的分块大小，可通过 transfer.chunkSize 配置
+const (
+	defaultChunkSize = 256 * 1024
+	minChunkSize     = 4 * 1024
+	maxChunkSize     = 1024 * 1024
+)
+
+// gRPC 传输参数：消息大小上限为最大分块留出余量，流控窗口足够容纳多个在途分块
+const (
+	maxMessageSize        = 4 * maxChunkSize
+	initialWindowSize     = 4 * 1024 * 1024
+	initialConnWindowSize = 16 * 1024 * 1024
+	transportBufferSize   = 256 * 1024
+)
+
+// normalizeChunkSize 未配置时使用默认分块大小，超出范围时截断到 [minChunkSize, maxChunkSize]
+func normalizeChunkSize(size int) int {
+	switch {
+	case size <= 0:
+		return defaultChunkSize
+	case size < minChunkSize:
+		return minChunkSize
+	case size > maxChunkSize:
+		return maxChunkSize
+	}
+	return size
+}
+
+// serverOptions 文件服务使用的gRPC服务端参数；错误转换拦截器最先注册，
+// 因此认证和访问控制拦截器返回的状态错误也会经过它并原样保留
+func serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(statusUnaryInterceptor),
+		grpc.ChainStreamInterceptor(statusStreamInterceptor),
+		grpc.MaxRecvMsgSize(maxMessageSize),
+		grpc.MaxSendMsgSize(maxMessageSize),
+		grpc.InitialWindowSize(initialWindowSize),
+		grpc.InitialConnWindowSize(initialConnWindowSize),
+		grpc.ReadBufferSize(transportBufferSize),
+		grpc.WriteBufferSize(transportBufferSize),
+	}
+}
+
+// dialOptions 连接文件服务使用的gRPC客户端参数，与 serverOptions 对应
+func dialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(maxMessageSize),
+			grpc.MaxCallSendMsgSize(maxMessageSize),
+		),
+		grpc.WithInitialWindowSize(initialWindowSize),
+		grpc.WithInitialConnWindowSize(initialConnWindowSize),
+		grpc.WithReadBufferSize(transportBufferSize),
+		grpc.WithWriteBufferSize(transportBufferSize),
+	}
+}
+
+// bufferPools 按分块大小复用传输缓冲区，避免每次传输都重新分配
+var bufferPools sync.Map // int -> *sync.Pool
+
+// getBuffer 从对应大小的缓冲池中取出一个缓冲区，用完后需调用 putBuffer 归还
+func getBuffer(size int) *[]byte {
+	pool, ok := bufferPools.Load(size)
+	if !ok {
+		pool, _ = bufferPools.LoadOrStore(size, &sync.Pool{
+			New: func() any {
+				buf := make([]byte, size)
+				return &buf
+			},
+		})
+	}
+	return pool.(*sync.Pool).Get().(*[]byte)
+}
+
+func putBuffer(buf *[]byte) {
+	if pool, ok := bufferPools.Load(cap(*buf)); ok {
+		*buf = (*buf)[:cap(*buf)]
+		pool.(*sync.Pool).Put(buf)
+	}
+}
+
+// readerOnly 隐藏底层reader的 WriterTo 实现，使 io.CopyBuffer 使用调用方提供的缓冲区
+type readerOnly struct {
+	io.Reader
+}
+
+// chunkWriter 将写入的数据按分块大小发送。gRPC 在 Send 返回前已完成序列化，缓冲区可以立即复用
+type chunkWriter struct {
+	stream pb.FileService_DownloadFileServer
+	slot   *downloadSlot // 发送前申请带宽，nil表示不限速
+	pooled *[]byte
+	buf    []byte
+}
+
+func newChunkWriter(stream pb.FileService_DownloadFileServer, size int) *chunkWriter {
+	pooled := getBuffer(size)
+	return &chunkWriter{stream: stream, pooled: pooled, buf: (*pooled)[:0]}
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// 缓冲区为空且数据足够一个分块时直接发送，省去一次复制
+		if len(w.buf) == 0 && len(p) >= cap(w.buf) {
+			if err := w.send(p[:cap(w.buf)]); err != nil {
+				return written, err
+			}
+			written += cap(w.buf)
+			p = p[cap(w.buf):]
+			continue
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+		if len(w.buf) == cap(w.buf) {
+			if err := w.Flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Flush 发送缓冲区中剩余的数据
+func (w *chunkWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.send(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+func (w *chunkWriter) send(p []byte) error {
+	if err := w.slot.wait(w.stream.Context(), len(p)); err != nil {
+		return err
+	}
+	return w.stream.Send(&pb.FileChunk{Content: p})
+}
+
+// Release 将缓冲区归还到缓冲池，之后不能再使用该chunkWriter
+func (w *chunkWriter) Release() {
+	putBuffer(w.pooled)
+	w.pooled, w.buf = nil, nil
+}
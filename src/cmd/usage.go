@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	pb "ZFS/grpc"
+	"ZFS/storage"
+	"ZFS/utils"
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxUsageEntries Usage 最多分别列出的目录数，避免深度过大时响应过大
+const maxUsageEntries = 10000
+
+// defaultDfTimeout df -a 等待每个节点的时间
+const defaultDfTimeout = 10 * time.Second
+
+var errUsageEntries = status.Errorf(codes.InvalidArgument, "子目录超过 %d 个，请减小深度", maxUsageEntries)
+
+// Usage 统计目录下调用方有权查看的文件总大小和数量，并分别统计相对深度不超过 depth 的子目录
+func (s *FileServer) Usage(ctx context.Context, req *pb.UsageRequest) (*pb.UsageResponse, error) {
+	depth := int(req.GetDepth())
+	if depth < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "深度不合法: %d", depth)
+	}
+	info, err := s.storage.Stat(ctx, req.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	root := strings.Trim(path.Clean("/"+req.GetPath()), "/")
+	if !info.IsDirectory {
+		return &pb.UsageResponse{Entries: []*pb.UsageEntry{{Path: root, Size: info.Size, Files: 1}}}, nil
+	}
+
+	entries := map[string]*pb.UsageEntry{root: {Path: root}}
+	err = s.storage.Walk(ctx, root, func(p string, info storage.FileInfo) error {
+		// 与 Find 一致，调用方无权查看的条目不计入统计
+		if !s.acl.allows(ctx, p, utils.ACLList) {
+			return nil
+		}
+		parts := strings.Split(strings.TrimPrefix(p, root+"/"), "/")
+		if root == "" {
+			parts = strings.Split(p, "/")
+		}
+		// 计入深度以内的每一级上级目录
+		for i := 0; i < len(parts) && i <= depth; i++ {
+			dir := path.Join(root, strings.Join(parts[:i], "/"))
+			e, ok := entries[dir]
+			if !ok {
+				if len(entries) >= maxUsageEntries {
+					return errUsageEntries
+				}
+				e = &pb.UsageEntry{Path: dir}
+				entries[dir] = e
+			}
+			if info.IsDirectory {
+				e.Directories++
+			} else {
+				e.Size += info.Size
+				e.Files++
+			}
+		}
+		// 深度以内的空目录也要列出
+		if info.IsDirectory && len(parts) <= depth {
+			if _, ok := entries[p]; !ok {
+				if len(entries) >= maxUsageEntries {
+					return errUsageEntries
+				}
+				entries[p] = &pb.UsageEntry{Path: p}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.UsageResponse{}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, e)
+	}
+	sort.Slice(resp.Entries, func(i, j int) bool { return resp.Entries[i].Path < resp.Entries[j].Path })
+	return resp, nil
+}
+
+// Capacity 返回存储的总容量、已用空间和可用空间
+func (s *FileServer) Capacity(ctx context.Context, req *pb.CapacityRequest) (*pb.CapacityResponse, error) {
+	capacity, err := s.storage.Capacity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CapacityResponse{
+		StorageType: s.storage.Type(),
+		Total:       capacity.Total,
+		Used:        capacity.Used,
+		Free:        capacity.Free,
+	}, nil
+}
+
+// parseDuOptions 解析 du [-d N] [路径]
+func parseDuOptions(args []string) (int, string, bool) {
+	var depth int
+	if len(args) >= 2 && args[0] == "-d" {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return 0, "", false
+		}
+		depth = n
+		args = args[2:]
+	}
+	if len(args) > 1 || (len(args) == 1 && strings.HasPrefix(args[0], "-")) {
+		return 0, "", false
+	}
+	if len(args) == 1 {
+		return depth, args[0], true
+	}
+	return depth, "", true
+}
+
+// formatUsage 按 du 的习惯先列出子目录，最后是统计的目录本身
+func formatUsage(entries []*pb.UsageEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	line := func(e *pb.UsageEntry) string {
+		name := e.Path
+		if name == "" {
+			name = "."
+		}
+		return fmt.Sprintf("%10s  %8d 个文件  %s", utils.FormatFileSize(e.Size), e.Files, name)
+	}
+	var sb strings.Builder
+	for _, e := range entries[1:] {
+		sb.WriteString(line(e))
+		sb.WriteString("\n")
+	}
+	sb.WriteString(line(entries[0]))
+	return sb.String()
+}
+
+// nodeCapacity 一个节点的容量查询结果
+type nodeCapacity struct {
+	node     string
+	capacity *pb.CapacityResponse
+	err      error
+}
+
+// capacityNodes 并发查询 nodes 中每个节点的容量，每个节点最多等待 timeout，按节点名排序返回
+func capacityNodes(ctx context.Context, nodes *sync.Map, timeout time.Duration) []nodeCapacity {
+	var names, addrs []string
+	nodes.Range(func(key, value any) bool {
+		names = append(names, key.(string))
+		addrs = append(addrs, value.(string))
+		return true
+	})
+	results := make([]nodeCapacity, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = nodeCapacity{node: names[i]}
+			conn, err := GetConn(names[i], addrs[i])
+			if err != nil {
+				results[i].err = err
+				return
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			results[i].capacity, results[i].err = pb.NewFileServiceClient(conn).Capacity(ctx, &pb.CapacityRequest{})
+		}(i)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].node < results[j].node })
+	return results
+}
+
+// formatCapacity 以表格显示各节点的容量，多个节点时追加合计行；容量未知的节点只计入已用空间
+func formatCapacity(results []nodeCapacity) string {
+	size := func(v int64, known bool) string {
+		if !known {
+			return "-"
+		}
+		return utils.FormatFileSize(v)
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%-12s %-6s %10s %10s %10s %6s", "节点", "类型", "容量", "已用", "可用", "使用率"))
+	var total, used, free int64
+	var failed []string
+	for _, r := range results {
+		if r.err != nil {
+			failed = append(failed, fmt.Sprintf("%s（%s）", r.node, searchFailure(r.err)))
+			continue
+		}
+		c := r.capacity
+		known := c.Total > 0
+		// 与 df 一样按已用空间占（已用+可用）的比例向上取整，不计入保留给特权用户的空间
+		percent := "-"
+		if avail := c.Used + c.Free; known && avail > 0 {
+			percent = fmt.Sprintf("%d%%", (c.Used*100+avail-1)/avail)
+		}
+		sb.WriteString(fmt.Sprintf("\n%-12s %-6s %10s %10s %10s %6s", r.node, c.StorageType,
+			size(c.Total, known), utils.FormatFileSize(c.Used), size(c.Free, known), percent))
+		used += c.Used
+		if known {
+			total += c.Total
+			free += c.Free
+		}
+	}
+	if len(results) > 1 {
+		sb.WriteString(fmt.Sprintf("\n%-12s %-6s %10s %10s %10s", "合计", "", size(total, total > 0), utils.FormatFileSize(used), size(free, total > 0)))
+	}
+	if len(failed) > 0 {
+		sb.WriteString(fmt.Sprintf("\n无法访问的节点，合计可能不完整：%s", strings.Join(failed, "，")))
+	}
+	return sb.String()
+}
+
+// du 统计远程目录的总大小和文件数：du [-d N] [路径]，-d N 同时列出 N 层以内的子目录
+func du(m *Manager, args []string) string {
+	depth, target, ok := parseDuOptions(args)
+	if !ok {
+		return ErrorMsg("du 输入不合法")
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点或未建立 RPC 连接")
+	}
+	if msg := m.requireFeature(featureUsage); msg != "" {
+		return msg
+	}
+	p := strings.Join(m.relativePath[1:], "/")
+	if target != "" {
+		p = m.remotePath(target)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	client := pb.NewFileServiceClient(m.currentConn)
+	resp, err := client.Usage(ctx, &pb.UsageRequest{Path: p, Depth: int32(depth)})
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("统计失败：%s", describeError(err)))
+	}
+	return formatUsage(resp.Entries)
+}
+
+// df 显示当前节点存储的容量、已用空间和可用空间，-a 汇总所有已发现的节点
+func df(m *Manager, args []string) string {
+	all := len(args) == 1 && args[0] == "-a"
+	if len(args) != 0 && !all {
+		return ErrorMsg("df 输入不合法")
+	}
+	if all {
+		results := capacityNodes(context.Background(), m.nodes, defaultDfTimeout)
+		if len(results) == 0 {
+			return ErrorMsg("没有发现任何节点")
+		}
+		return formatCapacity(results)
+	}
+	if len(m.relativePath) == 0 || m.currentConn == nil {
+		return ErrorMsg("未指定节点，使用 df -a 查看所有节点")
+	}
+	if msg := m.requireFeature(featureCapacity); msg != "" {
+		return msg
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDfTimeout)
+	defer cancel()
+	client := pb.NewFileServiceClient(m.currentConn)
+	resp, err := client.Capacity(ctx, &pb.CapacityRequest{})
+	if err != nil {
+		return ErrorMsg(fmt.Sprintf("查询容量失败：%s", describeError(err)))
+	}
+	return formatCapacity([]nodeCapacity{{node: m.currentNode, capacity: resp}})
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"ZFS/utils"
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "ZFS/grpc"
+)
+
+func TestUsage(t *testing.T) {
+	root := writeFindTree(t)
+	if err := os.Mkdir(filepath.Join(root, "empty"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	client := pb.NewFileServiceClient(startTestServer(t, newTestFileServer(t, root).storage))
+	ctx := context.Background()
+	usage := func(p string, depth int32) map[string]*pb.UsageEntry {
+		t.Helper()
+		resp, err := client.Usage(ctx, &pb.UsageRequest{Path: p, Depth: depth})
+		if err != nil {
+			t.Fatalf("Usage 调用失败: %v", err)
+		}
+		entries := make(map[string]*pb.UsageEntry)
+		for _, e := range resp.Entries {
+			entries[e.Path] = e
+		}
+		if resp.Entries[0].Path != strings.Trim(p, "/") {
+			t.Errorf("第一项应当是统计的目录本身，实际为 %q", resp.Entries[0].Path)
+		}
+		return entries
+	}
+	check := func(e *pb.UsageEntry, size, files, dirs int64) {
+		t.Helper()
+		if e == nil {
+			t.Fatal("缺少统计结果")
+		}
+		if e.Size != size || e.Files != files || e.Directories != dirs {
+			t.Errorf("%q 的统计结果为 %d 字节 %d 个文件 %d 个目录，期望 %d %d %d", e.Path, e.Size, e.Files, e.Directories, size, files, dirs)
+		}
+	}
+
+	total := int64(2048 + 100 + 10 + 3<<20)
+	entries := usage("", 0)
+	if len(entries) != 1 {
+		t.Errorf("深度为0时只应返回目录本身: %v", entries)
+	}
+	check(entries[""], total, 5, 3)
+
+	entries = usage("", 1)
+	if len(entries) != 3 {
+		t.Errorf("深度为1时应当返回根目录、docs 和 empty: %v", entries)
+	}
+	check(entries["docs"], total-2048, 4, 1)
+	check(entries["empty"], 0, 0, 0)
+
+	entries = usage("/docs/", 5)
+	check(entries["docs"], total-2048, 4, 1)
+	check(entries["docs/archive"], 3<<20, 2, 0)
+
+	check(usage("report-2026-09.csv", 1)["report-2026-09.csv"], 2048, 1, 0)
+
+	for _, req := range []*pb.UsageRequest{{Path: "missing"}, {Depth: -1}, {Path: "../"}} {
+		if _, err := client.Usage(ctx, req); err == nil {
+			t.Errorf("%v 应当失败", req)
+		}
+	}
+	if _, err := client.Usage(ctx, &pb.UsageRequest{Path: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("统计不存在的目录应当返回 NotFound，实际: %v", err)
+	}
+}
+
+func TestUsageAccessControl(t *testing.T) {
+	s := newTestFileServer(t, writeFindTree(t))
+	s.acl = newAccessControl(filepath.Join(t.TempDir(), "acl.yaml"), &utils.ZFSNode{
+		Name:  "root",
+		Rules: []utils.ACLRule{{Peers: []string{"*"}, Allow: []string{utils.ACLList}}},
+		Children: []*utils.ZFSNode{{Name: "docs", Children: []*utils.ZFSNode{
+			{Name: "archive", Rules: []utils.ACLRule{{Peers: []string{"*"}, Deny: []string{utils.ACLList}}}},
+		}}},
+	}, s.storage)
+
+	// 无权查看的 docs/archive 既不单独列出，也不计入上级目录
+	resp, err := s.Usage(context.Background(), &pb.UsageRequest{Path: "docs", Depth: 1})
+	if err != nil {
+		t.Fatalf("Usage 失败: %v", err)
+	}
+	if len(resp.Entries) != 1 {
+		t.Fatalf("不应列出无权查看的目录: %v", resp.Entries)
+	}
+	if e := resp.Entries[0]; e.Size != 110 || e.Files != 2 || e.Directories != 0 {
+		t.Errorf("docs 的统计结果为 %d 字节 %d 个文件 %d 个目录", e.Size, e.Files, e.Directories)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	client := pb.NewFileServiceClient(startTestServer(t, newTestFileServer(t, t.TempDir()).storage))
+	resp, err := client.Capacity(context.Background(), &pb.CapacityRequest{})
+	if err != nil {
+		t.Fatalf("Capacity 调用失败: %v", err)
+	}
+	if resp.StorageType != "local" || resp.Total <= 0 || resp.Used <= 0 || resp.Free <= 0 || resp.Used+resp.Free > resp.Total {
+		t.Errorf("本地存储的容量不正确: %+v", resp)
+	}
+}
+
+func TestDfAll(t *testing.T) {
+	var nodes sync.Map
+	for _, name := range []string{"node1", "node2"} {
+		_, addr := serveTestFileServer(t, newTestFileServer(t, t.TempDir()))
+		nodes.Store(name, addr)
+	}
+	results := capacityNodes(context.Background(), &nodes, defaultDfTimeout)
+	if len(results) != 2 || results[0].node != "node1" || results[0].err != nil || results[1].err != nil {
+		t.Fatalf("查询结果不正确: %+v", results)
+	}
+
+	results = append(results, nodeCapacity{node: "node3", capacity: &pb.CapacityResponse{StorageType: "s3", Used: 5 << 30}})
+	results = append(results, nodeCapacity{node: "node4", err: status.Error(codes.Unavailable, "connection refused")})
+	out := formatCapacity(results)
+	for _, want := range []string{"node1", "node2", "合计", "node3        s3", "无法访问的节点，合计可能不完整：node4（无法连接）"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出中缺少 %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestFormatCapacity(t *testing.T) {
+	out := formatCapacity([]nodeCapacity{{node: "node1", capacity: &pb.CapacityResponse{
+		StorageType: "s3", Total: 100 << 30, Used: 25 << 30, Free: 75 << 30,
+	}}})
+	lines := strings.Split(out, "\n")
+	if len(lines) != 2 {
+		t.Fatalf("单个节点不应有合计行:\n%s", out)
+	}
+	for _, want := range []string{"100.00GB", "25.00GB", "75.00GB", "25%"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("输出中缺少 %q: %s", want, lines[1])
+		}
+	}
+}
+
+func TestParseDuOptions(t *testing.T) {
+	tests := []struct {
+		args   []string
+		depth  int
+		target string
+		ok     bool
+	}{
+		{nil, 0, "", true},
+		{[]string{"docs"}, 0, "docs", true},
+		{[]string{"-d", "2"}, 2, "", true},
+		{[]string{"-d", "1", "docs"}, 1, "docs", true},
+		{[]string{"-d"}, 0, "", false},
+		{[]string{"-d", "-1", "docs"}, 0, "", false},
+		{[]string{"docs", "-d", "1"}, 0, "", false},
+		{[]string{"a", "b"}, 0, "", false},
+	}
+	for _, tt := range tests {
+		depth, target, ok := parseDuOptions(tt.args)
+		if ok != tt.ok || depth != tt.depth || target != tt.target {
+			t.Errorf("%v: 解析结果为 %d %q %v", tt.args, depth, target, ok)
+		}
+	}
+}
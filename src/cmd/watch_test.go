@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"ZFS/config"
+	"ZFS/utils"
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "ZFS/grpc"
+)
+
+// startWatch 开始监视dir，返回建立监视后的事件流
+func startWatch(t *testing.T, client pb.FileServiceClient, dir string, recursive bool) pb.FileService_WatchDirectoryClient {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	stream, err := client.WatchDirectory(ctx, &pb.WatchDirectoryRequest{DirectoryPath: dir, Recursive: recursive})
+	if err != nil {
+		t.Fatalf("WatchDirectory 调用失败: %v", err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("等待监视建立失败: %v", err)
+	}
+	return stream
+}
+
+// expectEvent 读取事件直到出现指定类型和路径的事件，写入文件时产生的多余修改事件会被跳过
+func expectEvent(t *testing.T, stream pb.FileService_WatchDirectoryClient, typ pb.WatchEvent_Type, path string) *pb.WatchEvent {
+	t.Helper()
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("等待 %v %s 时出错: %v", typ, path, err)
+		}
+		if ev.Type == typ && ev.Path == path {
+			return ev
+		}
+		if ev.Type != pb.WatchEvent_MODIFIED && ev.Type != pb.WatchEvent_CREATED {
+			t.Fatalf("等待 %v %s 时收到意外的事件: %v %s", typ, path, ev.Type, ev.Path)
+		}
+	}
+}
+
+func TestWatchDirectory(t *testing.T) {
+	root := t.TempDir()
+	docs := filepath.Join(root, "docs")
+	if err := os.MkdirAll(filepath.Join(docs, "old"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	client := pb.NewFileServiceClient(startTestServer(t, newTestFileServer(t, root).storage))
+	stream := startWatch(t, client, "docs", false)
+
+	file := filepath.Join(docs, "a.txt")
+	if err := os.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	ev := expectEvent(t, stream, pb.WatchEvent_CREATED, "docs/a.txt")
+	if ev.Entry.GetName() != "a.txt" || ev.Entry.GetIsDirectory() {
+		t.Fatalf("新建事件的文件信息不正确: %+v", ev.Entry)
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	f.WriteString(" world")
+	f.Close()
+	// 新建文件时写入内容也会产生修改事件，等待追加后的大小
+	for ev.Entry.GetSize() != int64(len("hello world")) {
+		ev = expectEvent(t, stream, pb.WatchEvent_MODIFIED, "docs/a.txt")
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	expectEvent(t, stream, pb.WatchEvent_DELETED, "docs/a.txt")
+
+	// 监视之前已存在的子目录被删除时也能识别为目录
+	if err := os.Remove(filepath.Join(docs, "old")); err != nil {
+		t.Fatalf("删除目录失败: %v", err)
+	}
+	ev = expectEvent(t, stream, pb.WatchEvent_DELETED, "docs/old")
+	if !ev.Entry.GetIsDirectory() {
+		t.Fatal("删除的目录没有标记为目录")
+	}
+
+	// 非递归监视不报告子目录中的变化
+	if err := os.MkdirAll(filepath.Join(docs, "sub"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	expectEvent(t, stream, pb.WatchEvent_CREATED, "docs/sub")
+	if err := os.WriteFile(filepath.Join(docs, "sub", "x.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(docs, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	expectEvent(t, stream, pb.WatchEvent_CREATED, "docs/b.txt")
+
+	// 被监视的目录本身被删除后结束
+	if err := os.RemoveAll(docs); err != nil {
+		t.Fatalf("删除目录失败: %v", err)
+	}
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("目录被删除后应正常结束，实际为: %v", err)
+		}
+	}
+}
+
+func TestWatchDirectoryRecursive(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs", "a"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	client := pb.NewFileServiceClient(startTestServer(t, newTestFileServer(t, root).storage))
+	stream := startWatch(t, client, "docs", true)
+
+	if err := os.WriteFile(filepath.Join(root, "docs", "a", "1.txt"), []byte("1"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	expectEvent(t, stream, pb.WatchEvent_CREATED, "docs/a/1.txt")
+
+	// 新建的子目录也会被监视
+	deep := filepath.Join(root, "docs", "b", "c")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	expectEvent(t, stream, pb.WatchEvent_CREATED, "docs/b")
+	expectEvent(t, stream, pb.WatchEvent_CREATED, "docs/b/c")
+	if err := os.WriteFile(filepath.Join(deep, "2.txt"), []byte("2"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	expectEvent(t, stream, pb.WatchEvent_CREATED, "docs/b/c/2.txt")
+
+	// 移走的子目录报告为删除
+	if err := os.Rename(filepath.Join(root, "docs", "a"), filepath.Join(root, "moved")); err != nil {
+		t.Fatalf("移动目录失败: %v", err)
+	}
+	ev := expectEvent(t, stream, pb.WatchEvent_DELETED, "docs/a")
+	if !ev.Entry.GetIsDirectory() {
+		t.Fatal("移走的目录没有标记为目录")
+	}
+}
+
+func TestWatchDirectoryACL(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs", "secret"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	s := newTestFileServer(t, root)
+	s.acl = newAccessControl(filepath.Join(t.TempDir(), "acl.yaml"), &utils.ZFSNode{
+		Name:  "root",
+		Rules: []utils.ACLRule{{Peers: []string{"*"}, Allow: []string{utils.ACLList}}},
+		Children: []*utils.ZFSNode{{Name: "docs", Children: []*utils.ZFSNode{
+			{Name: "secret", Rules: []utils.ACLRule{{Peers: []string{"*"}, Deny: []string{utils.ACLList}}}},
+		}}},
+	}, s.storage)
+	conn, _ := serveTestFileServer(t, s)
+	stream := startWatch(t, pb.NewFileServiceClient(conn), "docs", true)
+
+	// 调用方无权查看的子树中的变化不会被推送
+	if err := os.WriteFile(filepath.Join(root, "docs", "secret", "key.txt"), []byte("k"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(root, "docs", "public.txt"), []byte("p"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("等待 docs/public.txt 时出错: %v", err)
+		}
+		if strings.HasPrefix(ev.Path, "docs/secret/") {
+			t.Fatalf("收到了无权查看的事件: %v %s", ev.Type, ev.Path)
+		}
+		if ev.Path == "docs/public.txt" {
+			break
+		}
+	}
+}
+
+// 经由符号链接监视时事件相对于请求的路径报告，访问控制按链接的目标检查
+func TestWatchDirectoryThroughSymlink(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs", "secret"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := os.Symlink("docs", filepath.Join(root, "pub")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+	s := newTestFileServer(t, root)
+	s.acl = newAccessControl(filepath.Join(t.TempDir(), "acl.yaml"), &utils.ZFSNode{
+		Name:  "root",
+		Rules: []utils.ACLRule{{Peers: []string{"*"}, Allow: []string{utils.ACLList}}},
+		Children: []*utils.ZFSNode{{Name: "docs", Children: []*utils.ZFSNode{
+			{Name: "secret", Rules: []utils.ACLRule{{Peers: []string{"*"}, Deny: []string{utils.ACLList}}}},
+		}}},
+	}, s.storage)
+	conn, _ := serveTestFileServer(t, s)
+	stream := startWatch(t, pb.NewFileServiceClient(conn), "pub", true)
+
+	if err := os.WriteFile(filepath.Join(root, "docs", "secret", "key.txt"), []byte("k"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(root, "docs", "public.txt"), []byte("p"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("等待 pub/public.txt 时出错: %v", err)
+		}
+		if strings.Contains(ev.Path, "secret/") || strings.HasPrefix(ev.Path, "docs/") {
+			t.Fatalf("收到了不应推送的事件: %v %s", ev.Type, ev.Path)
+		}
+		if ev.Path == "pub/public.txt" {
+			break
+		}
+	}
+}
+
+func TestWatchDirectoryLimit(t *testing.T) {
+	root := t.TempDir()
+	s := newTestFileServer(t, root)
+	s.limits = newLimiter(config.LimitsConfig{MaxPeerWatches: 2})
+	conn, _ := serveTestFileServer(t, s)
+	client := pb.NewFileServiceClient(conn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	startWatch(t, client, ".", false)
+	first, err := client.WatchDirectory(ctx, &pb.WatchDirectoryRequest{DirectoryPath: "."})
+	if err != nil {
+		t.Fatalf("WatchDirectory 调用失败: %v", err)
+	}
+	if _, err := first.Header(); err != nil {
+		t.Fatalf("等待监视建立失败: %v", err)
+	}
+
+	// 超出每个调用方的上限时拒绝，不再为其创建新的监视
+	stream, err := client.WatchDirectory(context.Background(), &pb.WatchDirectoryRequest{DirectoryPath: "."})
+	if err != nil {
+		t.Fatalf("WatchDirectory 调用失败: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("超出监视上限时应当返回 ResourceExhausted，实际: %v", err)
+	}
+	if resp := s.limits.snapshot(); resp.ActiveWatches != 2 || resp.MaxWatches != 0 || resp.MaxPeerWatches != 2 ||
+		len(resp.Peers) != 1 || resp.Peers[0].ActiveWatches != 2 {
+		t.Errorf("监视的使用情况不正确: %+v", resp)
+	}
+
+	// 结束一个监视后名额被归还
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.limits.mu.Lock()
+		watches := s.limits.watches
+		s.limits.mu.Unlock()
+		if watches == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("监视结束后名额没有归还，当前 %d", watches)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	startWatch(t, client, ".", false)
+}
+
+func TestWatchDirectoryNotDirectory(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "file.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	client := pb.NewFileServiceClient(startTestServer(t, newTestFileServer(t, root).storage))
+	for _, dir := range []string{"file.txt", "missing"} {
+		stream, err := client.WatchDirectory(context.Background(), &pb.WatchDirectoryRequest{DirectoryPath: dir})
+		if err != nil {
+			t.Fatalf("WatchDirectory 调用失败: %v", err)
+		}
+		if _, err := stream.Recv(); err == nil || err == io.EOF {
+			t.Fatalf("监视 %s 应该失败，实际为 %v", dir, err)
+		}
+	}
+}
+
+func TestWatchCommandOutput(t *testing.T) {
+	root := t.TempDir()
+	conn := startTestServer(t, newTestFileServer(t, root).storage)
+	m := &Manager{relativePath: []string{"node"}, currentNode: "node", currentConn: conn}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- m.watchDirectory(ctx, "", false, w)
+		w.Close()
+	}()
+
+	buf := make([]byte, 4096)
+	n, err := r.Read(buf)
+	if err != nil || !strings.HasPrefix(string(buf[:n]), "正在监视 /") {
+		t.Fatalf("没有输出开始监视的提示: %q, %v", buf[:n], err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "reports"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	n, err = r.Read(buf)
+	if err != nil || !strings.HasSuffix(strings.TrimSpace(string(buf[:n])), "新建  reports/") {
+		t.Fatalf("事件输出不正确: %q, %v", buf[:n], err)
+	}
+	cancel()
+	go io.Copy(io.Discard, r)
+	<-done
+}
@@ -6,14 +6,23 @@ import (
 )
 
 type Config struct {
-	Node    NodeConfig                 `yaml:"node"`
-	Storage StorageConfig              `yaml:"storage"`
-	Etcd    EtcdConfig                 `yaml:"etcd"`
-	MySQL   MysqlConfig                `yaml:"mysql"`
-	Kafka   struct{ Brokers []string } `yaml:"kafka"`
-	GRPC    struct{ Port int }         `yaml:"grpc"`
-	Gateway struct{ Port int }         `yaml:"gateway"`
-	Log     LogConfig                  `yaml:"log"`
+	Node     NodeConfig                 `yaml:"node"`
+	Storage  StorageConfig              `yaml:"storage"`
+	Transfer TransferConfig             `yaml:"transfer"`
+	TLS      TLSConfig                  `yaml:"tls"`
+	Limits   LimitsConfig               `yaml:"limits"`
+	Etcd     EtcdConfig                 `yaml:"etcd"`
+	MySQL    MysqlConfig                `yaml:"mysql"`
+	Kafka    struct{ Brokers []string } `yaml:"kafka"`
+	GRPC     GRPCConfig                 `yaml:"grpc"`
+	Gateway  struct{ Port int }         `yaml:"gateway"`
+	Log      LogConfig                  `yaml:"log"`
+}
+
+type GRPCConfig struct {
+	Port                int  `yaml:"port"`
+	Reflection          bool `yaml:"reflection"`          // 是否启用gRPC反射，便于grpcurl等工具调试
+	HealthCheckInterval int  `yaml:"healthCheckInterval"` // 健康检查的间隔（秒），默认 10
 }
 
 type LogConfig struct {
@@ -44,28 +53,70 @@ type NodeConfig struct {
 }
 
 type StorageConfig struct {
-	Type      string      `yaml:"type"`      // 存储类型：local 或 s3
-	LocalRoot string      `yaml:"localRoot"` // 本地存储根目录
-	DataRoot  string      `yaml:"dataRoot"`  // 下载文件保存目录
-	S3        S3Config    `yaml:"s3"`        // S3配置
+	Type      string       `yaml:"type"`      // 存储类型：local、s3 或 memory
+	LocalRoot string       `yaml:"localRoot"` // 本地存储根目录
+	Symlinks  string       `yaml:"symlinks"`  // 本地存储中符号链接的处理方式：follow（默认）、deny 或 link
+	DataRoot  string       `yaml:"dataRoot"`  // 下载文件保存目录
+	S3        S3Config     `yaml:"s3"`        // S3配置
+	Memory    MemoryConfig `yaml:"memory"`    // 内存存储配置
+}
+
+type MemoryConfig struct {
+	Seed     string `yaml:"seed"`     // 启动时载入的目录或tar文件（可以是gzip压缩的），为空时从空存储开始
+	MaxBytes int64  `yaml:"maxBytes"` // 文件内容总大小的上限（字节），df 据此计算可用空间，0 表示不限
+}
+
+type TransferConfig struct {
+	Checksum            string  `yaml:"checksum"`            // 文件校验算法：sha256（默认）、sha1、sha512 或 md5
+	ChunkSize           int     `yaml:"chunkSize"`           // 流式传输的分块字节数，默认 262144（256KiB），范围 4KiB 到 1MiB
+	Compression         string  `yaml:"compression"`         // get -z 请求的压缩算法：zstd（默认）或 gzip
+	CompressionMaxRatio float64 `yaml:"compressionMaxRatio"` // 服务端采样压缩率高于该值时不压缩，默认 0.9
+}
+
+type TLSConfig struct {
+	Enable            bool   `yaml:"enable"`            // 是否对节点间的gRPC通信启用mTLS
+	CAFile            string `yaml:"caFile"`            // 用于验证对端证书的CA证书
+	CertFile          string `yaml:"certFile"`          // 本节点证书，CN即节点身份
+	KeyFile           string `yaml:"keyFile"`           // 本节点私钥
+	RequireClientAuth bool   `yaml:"requireClientAuth"` // 是否拒绝没有提供有效证书的客户端
+}
+
+type LimitsConfig struct {
+	MaxBandwidth     int64 `yaml:"maxBandwidth"`     // 全部下载合计的速率上限（字节/秒），0 表示不限制
+	MaxPeerBandwidth int64 `yaml:"maxPeerBandwidth"` // 每个调用方的下载速率上限（字节/秒），0 表示不限制
+	MaxStreams       int   `yaml:"maxStreams"`       // 同时进行的下载流上限，0 表示不限制
+	MaxPeerStreams   int   `yaml:"maxPeerStreams"`   // 每个调用方同时进行的下载流上限，0 表示不限制
+	RetryAfter       int   `yaml:"retryAfter"`       // 超出并发上限时建议客户端等待的秒数，默认 1
+	MaxWatches       int   `yaml:"maxWatches"`       // 同时进行的监视（watch、tail -f）上限，0 表示不限制，省略时为 DefaultMaxWatches
+	MaxPeerWatches   int   `yaml:"maxPeerWatches"`   // 每个调用方同时进行的监视（watch、tail -f）上限，0 表示不限制，省略时为 DefaultMaxPeerWatches
 }
 
 type S3Config struct {
-	Bucket           string `yaml:"bucket"`           // S3存储桶名称
-	Region           string `yaml:"region"`           // AWS区域
-	Prefix           string `yaml:"prefix"`           // 对象key前缀
-	AccessKeyId      string `yaml:"accessKeyId"`      // 访问密钥ID
-	SecretAccessKey  string `yaml:"secretAccessKey"`  // 访问密钥
-	Endpoint         string `yaml:"endpoint"`         // 自定义endpoint（用于MinIO等）
-	ForcePathStyle   bool   `yaml:"forcePathStyle"`   // 是否使用路径风格访问
+	Bucket          string `yaml:"bucket"`          // S3存储桶名称
+	Region          string `yaml:"region"`          // AWS区域
+	Prefix          string `yaml:"prefix"`          // 对象key前缀
+	AccessKeyId     string `yaml:"accessKeyId"`     // 访问密钥ID
+	SecretAccessKey string `yaml:"secretAccessKey"` // 访问密钥
+	Endpoint        string `yaml:"endpoint"`        // 自定义endpoint（用于MinIO等）
+	ForcePathStyle  bool   `yaml:"forcePathStyle"`  // 是否使用路径风格访问
+	WatchInterval   int    `yaml:"watchInterval"`   // watch 轮询对象列表的间隔（秒），默认 5
+	Quota           int64  `yaml:"quota"`           // 存储配额（字节），df 据此计算可用空间，0 表示不限
 }
 
+// 监视（watch、tail -f）的默认并发上限。每个目录监视都会占用一个文件系统通知实例，
+// 与其他限制不同，配置文件中省略时也不是不限制
+const (
+	DefaultMaxWatches     = 64
+	DefaultMaxPeerWatches = 8
+)
+
 func LoadConfig(filename string) (*Config, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	var config Config
+	// 先填入默认值，配置文件中没有出现的项保持默认值
+	config := Config{Limits: LimitsConfig{MaxWatches: DefaultMaxWatches, MaxPeerWatches: DefaultMaxPeerWatches}}
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigWatchDefaults(t *testing.T) {
+	load := func(content string) LimitsConfig {
+		t.Helper()
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("写入配置文件失败: %v", err)
+		}
+		conf, err := LoadConfig(file)
+		if err != nil {
+			t.Fatalf("加载配置失败: %v", err)
+		}
+		return conf.Limits
+	}
+
+	// 省略时监视上限使用默认值，其余限制为 0（不限制）
+	if limits := load("limits:\n  maxStreams: 4\n"); limits.MaxWatches != DefaultMaxWatches || limits.MaxPeerWatches != DefaultMaxPeerWatches || limits.MaxStreams != 4 || limits.MaxPeerStreams != 0 {
+		t.Errorf("省略监视上限时的配置不正确: %+v", limits)
+	}
+	if limits := load("node:\n  name: node1\n"); limits.MaxWatches != DefaultMaxWatches || limits.MaxPeerWatches != DefaultMaxPeerWatches {
+		t.Errorf("没有 limits 配置时应当使用默认的监视上限: %+v", limits)
+	}
+	// 与其他限制一样，显式配置为 0 表示不限制
+	if limits := load("limits:\n  maxWatches: 0\n  maxPeerWatches: 2\n"); limits.MaxWatches != 0 || limits.MaxPeerWatches != 2 {
+		t.Errorf("显式配置的监视上限不正确: %+v", limits)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -15,6 +16,44 @@ import (
 //--initial-advertise-peer-urls http://localhost:2380
 
 func RegisterService(ctx context.Context, etcdEndpoints, serviceAddr, nodeName string, ttl int64, dialTimeout int) (cleanup func(), err error) {
+	reg, err := Register(ctx, etcdEndpoints, serviceAddr, nodeName, ttl, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return reg.Cleanup, nil
+}
+
+// 租约失效后重新注册的退避间隔，从 reregisterMinDelay 开始每次失败翻倍，不超过 reregisterMaxDelay
+const (
+	reregisterMinDelay = time.Second
+	reregisterMaxDelay = 30 * time.Second
+)
+
+// Registration 节点在 etcd 中的注册。续租中断后会按退避间隔重新创建租约并写入注册信息，
+// 直到上下文取消时 Lost 返回的通道才会被关闭
+type Registration struct {
+	active  atomic.Bool
+	lost    chan struct{}
+	cleanup func()
+}
+
+// Lost 返回在注册停止（上下文取消）时关闭的通道
+func (r *Registration) Lost() <-chan struct{} {
+	return r.lost
+}
+
+// Active 注册当前是否有效，续租中断到重新注册成功之间返回 false
+func (r *Registration) Active() bool {
+	return r.active.Load()
+}
+
+// Cleanup 注销服务并关闭 etcd 连接
+func (r *Registration) Cleanup() {
+	r.cleanup()
+}
+
+// Register 在 etcd 中注册节点并自动续租
+func Register(ctx context.Context, etcdEndpoints, serviceAddr, nodeName string, ttl int64, dialTimeout int) (*Registration, error) {
 	cli, err := clientv3.New(clientv3.Config{
 		Endpoints:   []string{etcdEndpoints},
 		DialTimeout: time.Duration(dialTimeout) * time.Second,
@@ -23,45 +62,41 @@ func RegisterService(ctx context.Context, etcdEndpoints, serviceAddr, nodeName s
 		return nil, fmt.Errorf("连接到 etcd 失败: %w", err)
 	}
 
-	leaseResp, err := cli.Grant(ctx, ttl)
-	if err != nil {
-		cli.Close()
-		return nil, fmt.Errorf("创建租约失败: %w", err)
-	}
-
 	key := fmt.Sprintf("%s", nodeName)
-	_, err = cli.Put(ctx, key, serviceAddr, clientv3.WithLease(leaseResp.ID))
+	keepAliveChan, err := putWithLease(ctx, cli, key, serviceAddr, ttl)
 	if err != nil {
 		cli.Close()
-		return nil, fmt.Errorf("注册服务失败: %w", err)
-	}
-
-	keepAliveChan, err := cli.KeepAlive(ctx, leaseResp.ID)
-	if err != nil {
-		cli.Close()
-		return nil, fmt.Errorf("设置自动续租失败: %w", err)
+		return nil, err
 	}
 
 	log.Printf("服务 %s 已注册，地址: %s", nodeName, serviceAddr)
 
+	reg := &Registration{lost: make(chan struct{})}
+	reg.active.Store(true)
 	go func() {
+		defer close(reg.lost)
 		for {
 			select {
 			case <-ctx.Done():
 				log.Printf("上下文取消，停止节点 %s 的自动续租", nodeName)
 				return
 			case _, ok := <-keepAliveChan:
-				if !ok {
-					log.Printf("节点 %s 的 KeepAlive 频道已关闭", nodeName)
-					// 这里可以添加重注册逻辑或告警处理
+				if ok {
+					continue
+				}
+				reg.active.Store(false)
+				log.Printf("节点 %s 的 KeepAlive 频道已关闭，尝试重新注册", nodeName)
+				if keepAliveChan = reregister(ctx, cli, key, serviceAddr, ttl); keepAliveChan == nil {
+					log.Printf("上下文取消，停止节点 %s 的重新注册", nodeName)
 					return
 				}
-				//log.Printf("收到节点 %s 的续租响应，TTL: %d", nodeName, ka.TTL)
+				reg.active.Store(true)
+				log.Printf("服务 %s 已重新注册，地址: %s", nodeName, serviceAddr)
 			}
 		}
 	}()
 
-	cleanup = func() {
+	reg.cleanup = func() {
 		_, err := cli.Delete(context.Background(), key)
 		if err != nil {
 			log.Printf("删除键 %s 时出错: %v", key, err)
@@ -70,5 +105,39 @@ func RegisterService(ctx context.Context, etcdEndpoints, serviceAddr, nodeName s
 		log.Printf("服务 %s 已注销", nodeName)
 	}
 
-	return cleanup, nil
+	return reg, nil
+}
+
+// putWithLease 创建新的租约，将注册信息绑定到该租约写入 etcd 并开始自动续租
+func putWithLease(ctx context.Context, cli *clientv3.Client, key, serviceAddr string, ttl int64) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	leaseResp, err := cli.Grant(ctx, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("创建租约失败: %w", err)
+	}
+	if _, err := cli.Put(ctx, key, serviceAddr, clientv3.WithLease(leaseResp.ID)); err != nil {
+		return nil, fmt.Errorf("注册服务失败: %w", err)
+	}
+	keepAliveChan, err := cli.KeepAlive(ctx, leaseResp.ID)
+	if err != nil {
+		return nil, fmt.Errorf("设置自动续租失败: %w", err)
+	}
+	return keepAliveChan, nil
+}
+
+// reregister 按退避间隔重试 putWithLease 直到成功，上下文取消时返回nil
+func reregister(ctx context.Context, cli *clientv3.Client, key, serviceAddr string, ttl int64) <-chan *clientv3.LeaseKeepAliveResponse {
+	delay := reregisterMinDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		keepAliveChan, err := putWithLease(ctx, cli, key, serviceAddr, ttl)
+		if err == nil {
+			return keepAliveChan
+		}
+		delay = min(delay*2, reregisterMaxDelay)
+		log.Printf("重新注册 %s 失败: %v，%v 后重试", key, err, delay)
+	}
 }
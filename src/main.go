@@ -2,8 +2,16 @@ package main
 
 import (
 	"ZFS/cmd"
+	"log"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "gencert" {
+		if err := cmd.GenCert(os.Args[2:]); err != nil {
+			log.Fatalf("生成证书失败: %v", err)
+		}
+		return
+	}
 	cmd.Start()
 }
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package storage
+
+// diskCapacity 当前平台不支持查询文件系统容量，返回容量未知
+func diskCapacity(path string) (CapacityInfo, error) {
+	return CapacityInfo{}, nil
+}
@@ -0,0 +1,18 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import "syscall"
+
+// diskCapacity 返回path所在文件系统的总容量、已用空间和非特权用户可用的空间
+func diskCapacity(path string) (CapacityInfo, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return CapacityInfo{}, err
+	}
+	return CapacityInfo{
+		Total: int64(st.Blocks) * int64(st.Bsize),
+		Used:  int64(st.Blocks-st.Bfree) * int64(st.Bsize),
+		Free:  int64(st.Bavail) * int64(st.Bsize),
+	}, nil
+}
@@ -0,0 +1,302 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SymlinkPolicy 本地存储处理路径中符号链接的策略
+type SymlinkPolicy int
+
+const (
+	SymlinkFollow SymlinkPolicy = iota // 跟随符号链接，但解析后的目标必须仍在存储根目录内（默认）
+	SymlinkDeny                        // 拒绝访问经过符号链接的路径，列目录时不显示符号链接
+	SymlinkLink                        // 不跟随符号链接，将其作为链接本身展示，可以删除或移动但不能读写
+)
+
+// maxSymlinkHops 解析一个路径时最多跟随的符号链接数，超过时视为循环链接
+const maxSymlinkHops = 40
+
+// ParseSymlinkPolicy 解析配置中的 storage.symlinks：follow（默认）、deny 或 link
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "follow":
+		return SymlinkFollow, nil
+	case "deny":
+		return SymlinkDeny, nil
+	case "link":
+		return SymlinkLink, nil
+	default:
+		return 0, fmt.Errorf("不支持的符号链接策略: %s", s)
+	}
+}
+
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case SymlinkFollow:
+		return "follow"
+	case SymlinkDeny:
+		return "deny"
+	case SymlinkLink:
+		return "link"
+	default:
+		return "unknown"
+	}
+}
+
+// errEscape 路径超出了存储根目录
+var errEscape = fmt.Errorf("%w：只能访问storage目录下的内容", ErrPermissionDenied)
+
+// CleanPath 将请求中的路径规范为相对于存储根目录、以/分隔的路径，根目录为空字符串。
+// 开头的/表示存储根目录；\ 视为分隔符；.. 只能在根目录之内回退。
+// 包含NUL或不是合法的UTF-8时返回 ErrInvalidArgument，带有盘符或超出根目录时返回 ErrPermissionDenied。
+// 所有后端都先经过这里，同一个请求路径在任何后端上指向同一个位置。
+// 文件名的字节保持不变：磁盘上可能以分解形式（NFD）保存文件名，改写后就找不到原来的文件了，
+// 两种 Unicode 形式的对应由本地存储在查找目录条目时处理
+func CleanPath(p string) (string, error) {
+	if strings.IndexByte(p, 0) >= 0 {
+		return "", fmt.Errorf("%w: 路径中包含NUL字符", ErrInvalidArgument)
+	}
+	if !utf8.ValidString(p) {
+		return "", fmt.Errorf("%w: 路径不是合法的UTF-8", ErrInvalidArgument)
+	}
+	p = strings.ReplaceAll(p, "\\", "/")
+	var parts []string
+	for i, part := range strings.Split(p, "/") {
+		switch {
+		case part == "" || part == ".":
+		case part == "..":
+			if len(parts) == 0 {
+				return "", errEscape
+			}
+			parts = parts[:len(parts)-1]
+		case i == 0 && isVolumeName(part):
+			return "", errEscape
+		default:
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// isVolumeName 判断路径的第一部分是否为 Windows 盘符（如 C:），在 Windows 上会被当作绝对路径
+func isVolumeName(part string) bool {
+	if len(part) < 2 || part[1] != ':' {
+		return false
+	}
+	c := part[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+// pathAllowed 将 CleanPath 等检查的结果转换为 IsPathAllowed 的返回值
+func pathAllowed(err error) (bool, error) {
+	if errors.Is(err, ErrPermissionDenied) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// resolve 将请求中的路径解析为存储根目录下的绝对路径，按符号链接策略处理途经的每个符号链接，
+// 包括最后一部分；用于读写文件内容和列出目录。不存在的部分按字面拼接在已解析的路径之后
+func (ls *LocalStorage) resolve(p string) (string, error) {
+	rel, err := CleanPath(p)
+	if err != nil {
+		return "", err
+	}
+	return ls.confine(rel, true)
+}
+
+// resolveEntry 与 resolve 相同，但不解析最后一部分，得到的是条目本身（可能是符号链接）的路径；
+// 用于删除、移动和重命名，这些操作作用于链接本身而不是链接的目标
+func (ls *LocalStorage) resolveEntry(p string) (string, error) {
+	rel, err := CleanPath(p)
+	if err != nil {
+		return "", err
+	}
+	return ls.confine(rel, false)
+}
+
+// RealPath 返回展开符号链接之后的实际位置。只有跟随策略下的操作会经过符号链接，
+// 其他策略下实际位置就是规范后的路径
+func (ls *LocalStorage) RealPath(p string, followLast bool) (string, error) {
+	rel, err := CleanPath(p)
+	if err != nil || ls.symlinks != SymlinkFollow {
+		return rel, err
+	}
+	full, err := ls.confine(rel, followLast)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.Rel(ls.root, full)
+	if err != nil {
+		return "", errEscape
+	}
+	if real == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(real), nil
+}
+
+// confine 从存储根目录开始逐级解析已规范的相对路径 rel。每一步都只在根目录之内前进或回退，
+// 符号链接的目标展开后继续逐级解析，因此指向根目录之外（包括经由其他链接间接指向）的路径都会被拒绝。
+// 解析与随后的文件操作之间没有原子性，本地用户在两者之间替换目录仍可能绕过检查，
+// 但通过 ZFS 本身无法创建符号链接
+func (ls *LocalStorage) confine(rel string, followLast bool) (string, error) {
+	full := ls.root
+	pending := splitPath(rel)
+	last := len(pending) - 1 // rel 的最后一部分在 pending 中的位置，展开链接后随之移动
+	missing := 0             // full 末尾不存在的部分的层数
+	for hops := 0; len(pending) > 0; {
+		name := pending[0]
+		pending = pending[1:]
+		last--
+		if name == ".." {
+			if full == ls.root {
+				return "", errEscape
+			}
+			full = filepath.Dir(full)
+			if missing > 0 {
+				missing--
+			}
+			continue
+		}
+		next := filepath.Join(full, name)
+		if missing > 0 {
+			// 不存在的目录之下也不存在，不会是符号链接；链接目标中的 .. 回到已存在的目录后恢复逐级解析
+			full = next
+			missing++
+			continue
+		}
+		info, err := os.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) {
+			if alt, ok := matchUnicodeForm(full, name); ok {
+				next = filepath.Join(full, alt)
+				info, err = os.Lstat(next)
+			}
+		}
+		if last < 0 && !followLast {
+			return next, nil
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			full = next
+			missing++
+			continue
+		}
+		if err != nil {
+			return "", ls.localError(rel, err)
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			full = next
+			continue
+		}
+
+		switch ls.symlinks {
+		case SymlinkDeny:
+			return "", fmt.Errorf("%w：不允许访问符号链接 %s", ErrPermissionDenied, rel)
+		case SymlinkLink:
+			return "", fmt.Errorf("%w：不跟随符号链接 %s", ErrPermissionDenied, rel)
+		}
+		if hops++; hops > maxSymlinkHops {
+			return "", fmt.Errorf("%w: 符号链接层数过多: %s", ErrInvalidArgument, rel)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", ls.localError(rel, err)
+		}
+		if filepath.IsAbs(target) {
+			// 绝对路径的目标必须在根目录之内，再从根目录开始逐级解析
+			r, err := filepath.Rel(ls.root, filepath.Clean(target))
+			if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+				return "", errEscape
+			}
+			full, target = ls.root, r
+		}
+		expanded := splitPath(filepath.ToSlash(target))
+		pending = append(expanded, pending...)
+		last += len(expanded)
+	}
+	return full, nil
+}
+
+// matchUnicodeForm 在目录 dir 中查找与 name 只有 Unicode 形式不同的条目，
+// 例如请求中是预组形式而磁盘上是 macOS 保存的分解形式。只有唯一的条目匹配时才返回，
+// 同一目录中两种形式的文件同时存在时不做猜测
+func matchUnicodeForm(dir, name string) (string, bool) {
+	if norm.NFC.IsNormalString(name) && norm.NFD.IsNormalString(name) {
+		return "", false // 没有可以组合或分解的字符，不存在其他形式
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return "", false
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return "", false
+	}
+	want := norm.NFC.String(name)
+	match := ""
+	for _, entry := range names {
+		if entry != name && norm.NFC.String(entry) == want {
+			if match != "" {
+				return "", false
+			}
+			match = entry
+		}
+	}
+	return match, match != ""
+}
+
+// splitPath 按/拆分路径，忽略空的部分和 .
+func splitPath(p string) []string {
+	var parts []string
+	for _, part := range strings.Split(p, "/") {
+		if part != "" && part != "." {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// entryInfo 按符号链接策略转换目录中的条目，条目不应展示时返回 false。
+// 跟随策略下符号链接显示为目标的信息，目标在根目录之外或不存在的链接不显示
+func (ls *LocalStorage) entryInfo(full string, info os.FileInfo, countChildren bool) (FileInfo, bool) {
+	convert := func(full string, info os.FileInfo) FileInfo {
+		if countChildren {
+			return localFileInfo(full, info)
+		}
+		return localEntryInfo(info)
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return convert(full, info), true
+	}
+	switch ls.symlinks {
+	case SymlinkDeny:
+		return FileInfo{}, false
+	case SymlinkLink:
+		return localFileInfo(full, info), true
+	}
+	rel, err := filepath.Rel(ls.root, full)
+	if err != nil {
+		return FileInfo{}, false
+	}
+	target, err := ls.confine(filepath.ToSlash(rel), true)
+	if err != nil {
+		return FileInfo{}, false
+	}
+	targetInfo, err := os.Stat(target)
+	if err != nil {
+		return FileInfo{}, false
+	}
+	entry := convert(target, targetInfo)
+	entry.Name = info.Name()
+	entry.ContentType = contentTypeByName(info.Name(), entry.IsDirectory)
+	return entry, true
+}
@@ -0,0 +1,344 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		err  error
+	}{
+		{"", "", nil},
+		{"/", "", nil},
+		{"/docs/", "docs", nil},
+		{"./docs//a.txt", "docs/a.txt", nil},
+		{"a..b.txt", "a..b.txt", nil},
+		{"docs/../a..b/..c", "a..b/..c", nil},
+		{`docs\sub\a.txt`, "docs/sub/a.txt", nil},
+		{"caf\u0065\u0301.txt", "caf\u0065\u0301.txt", nil},
+		{"docs/c:/a.txt", "docs/c:/a.txt", nil},
+		{"..", "", ErrPermissionDenied},
+		{"/../etc/passwd", "", ErrPermissionDenied},
+		{"docs/../../etc", "", ErrPermissionDenied},
+		{`..\..\etc`, "", ErrPermissionDenied},
+		{`C:\Windows`, "", ErrPermissionDenied},
+		{"c:", "", ErrPermissionDenied},
+		{"docs/a\x00.txt", "", ErrInvalidArgument},
+		{"docs/\xff.txt", "", ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		got, err := CleanPath(tt.path)
+		if !errors.Is(err, tt.err) || (err == nil && got != tt.want) {
+			t.Errorf("CleanPath(%q) = %q, %v，期望 %q, %v", tt.path, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func FuzzCleanPath(f *testing.F) {
+	for _, seed := range []string{"", "/", "docs/a.txt", "a..b", "../x", `..\x`, "a/./../..", "C:x", "\u0065\u0301", "a\x00b", "\xff", "//server/share"} {
+		f.Add(seed)
+	}
+	root := filepath.FromSlash("/srv/storage")
+	f.Fuzz(func(t *testing.T, p string) {
+		clean, err := CleanPath(p)
+		if err != nil {
+			if !errors.Is(err, ErrPermissionDenied) && !errors.Is(err, ErrInvalidArgument) {
+				t.Fatalf("CleanPath(%q) 返回了未分类的错误: %v", p, err)
+			}
+			return
+		}
+		if !utf8.ValidString(clean) || strings.ContainsAny(clean, "\x00\\") {
+			t.Fatalf("CleanPath(%q) = %q 没有规范化", p, clean)
+		}
+		for i, part := range strings.Split(clean, "/") {
+			if clean != "" && (part == "" || part == "." || part == ".." || (i == 0 && isVolumeName(part))) {
+				t.Fatalf("CleanPath(%q) = %q 包含不合法的部分 %q", p, clean, part)
+			}
+		}
+		if again, err := CleanPath(clean); err != nil || again != clean {
+			t.Fatalf("CleanPath 不是幂等的: %q -> %q -> %q, %v", p, clean, again, err)
+		}
+		if !within(root, filepath.Join(root, clean)) {
+			t.Fatalf("CleanPath(%q) = %q 超出了根目录", p, clean)
+		}
+	})
+}
+
+// within 判断 p 是否为 root 或在 root 之下
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func TestUnicodeFormLookup(t *testing.T) {
+	root := t.TempDir()
+	nfd, nfc := "caf\u0065\u0301", "caf\u00e9"
+	if err := os.MkdirAll(filepath.Join(root, nfd), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, nfd, nfd+".txt"), []byte("menu"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	ls, err := NewLocalStorage(root, SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	// 磁盘上是分解形式，两种形式的请求都应当找到同一个文件
+	for _, p := range []string{nfd + "/" + nfd + ".txt", nfc + "/" + nfc + ".txt", nfc + "/" + nfd + ".txt"} {
+		if got, err := readAll(t, ls, p); err != nil || got != "menu" {
+			t.Errorf("读取 %q 得到 %q, %v", p, got, err)
+		}
+	}
+	entries, _, err := ls.ListDirectory(context.Background(), nfc, ListOptions{})
+	if err != nil || len(entries) != 1 || entries[0].Name != nfd+".txt" {
+		t.Errorf("列目录应当返回磁盘上的文件名: %+v, %v", entries, err)
+	}
+	if err := ls.DeleteFile(context.Background(), nfc+"/"+nfc+".txt", false); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, nfd, nfd+".txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("分解形式的文件应当被删除: %v", err)
+	}
+
+	// 两种形式的文件同时存在时各自按字节访问
+	for name, content := range map[string]string{nfd: "decomposed", nfc: "composed"} {
+		if err := os.WriteFile(filepath.Join(root, name+".txt"), []byte(content), 0644); err != nil {
+			t.Fatalf("写入测试文件失败: %v", err)
+		}
+	}
+	for name, want := range map[string]string{nfd + ".txt": "decomposed", nfc + ".txt": "composed"} {
+		if got, err := readAll(t, ls, name); err != nil || got != want {
+			t.Errorf("读取 %q 得到 %q, %v", name, got, err)
+		}
+	}
+}
+
+// newSymlinkStorage 创建包含各种符号链接的本地存储，根目录之外有一个 outside/secret.txt
+func newSymlinkStorage(t testing.TB, policy SymlinkPolicy) *LocalStorage {
+	t.Helper()
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "docs", "sub"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("创建目录失败: %v", err)
+		}
+	}
+	for p, content := range map[string]string{
+		filepath.Join(root, "docs", "a.txt"):        "inside",
+		filepath.Join(root, "docs", "sub", "b.txt"): "nested",
+		filepath.Join(outside, "secret.txt"):        "secret",
+	} {
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("写入测试文件失败: %v", err)
+		}
+	}
+	links := map[string]string{
+		"in":                "docs",
+		"abs":               filepath.Join(root, "docs"),
+		"docs/up":           "../docs/sub",
+		"file.txt":          "docs/a.txt",
+		"out":               "../outside",
+		"outabs":            outside,
+		"sneaky":            "docs/../../outside",
+		"docs/sub/escape":   "../../../outside/secret.txt",
+		"hop":               "out",
+		"loop":              "loop",
+		"dangling":          "missing",
+		"docs/sub/relative": "../../in/a.txt",
+		"docs/sub/detour":   "nonexist/../evil",
+		"docs/sub/evil":     outside,
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skipf("无法创建符号链接: %v", err)
+		}
+	}
+	ls, err := NewLocalStorage(root, policy)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	return ls
+}
+
+func readAll(t *testing.T, ls *LocalStorage, p string) (string, error) {
+	t.Helper()
+	r, err := ls.DownloadFile(context.Background(), p, 0, 0)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	return string(data), err
+}
+
+func TestSymlinkFollow(t *testing.T) {
+	ls := newSymlinkStorage(t, SymlinkFollow)
+	for p, want := range map[string]string{
+		"in/a.txt":                 "inside",
+		"abs/a.txt":                "inside",
+		"file.txt":                 "inside",
+		"docs/up/b.txt":            "nested",
+		"docs/sub/relative":        "inside",
+		"in/../docs/sub/../a.txt":  "inside",
+		"/docs/sub/../../file.txt": "inside",
+	} {
+		if got, err := readAll(t, ls, p); err != nil || got != want {
+			t.Errorf("读取 %s 得到 %q, %v", p, got, err)
+		}
+	}
+	for _, p := range []string{"out/secret.txt", "outabs/secret.txt", "sneaky/secret.txt", "docs/sub/escape", "hop/secret.txt", "../outside/secret.txt", "docs/sub/detour/secret.txt"} {
+		if _, err := readAll(t, ls, p); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("读取 %s 应当被拒绝: %v", p, err)
+		}
+		if err := ls.UploadFile(context.Background(), p, strings.NewReader("x")); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("写入 %s 应当被拒绝: %v", p, err)
+		}
+	}
+	if _, err := readAll(t, ls, "loop"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("循环链接应当返回 ErrInvalidArgument: %v", err)
+	}
+
+	// 列目录时链接显示为目标，指向根目录之外或不存在的链接不显示
+	entries, _, err := ls.ListDirectory(context.Background(), "", ListOptions{})
+	if err != nil {
+		t.Fatalf("列出目录失败: %v", err)
+	}
+	names := map[string]FileInfo{}
+	for _, e := range entries {
+		names[e.Name] = e
+	}
+	if e, ok := names["in"]; !ok || !e.IsDirectory || e.ChildCount != 3 {
+		t.Errorf("in 应当显示为目录: %+v", e)
+	}
+	if e, ok := names["file.txt"]; !ok || e.Size != int64(len("inside")) {
+		t.Errorf("file.txt 应当显示为目标文件: %+v", e)
+	}
+	for _, name := range []string{"out", "outabs", "sneaky", "hop", "loop", "dangling"} {
+		if _, ok := names[name]; ok {
+			t.Errorf("%s 不应当出现在列表中", name)
+		}
+	}
+	var walked []string
+	err = ls.Walk(context.Background(), "", func(p string, info FileInfo) error {
+		walked = append(walked, p)
+		return nil
+	})
+	if err != nil || strings.Contains(strings.Join(walked, " "), "secret") || !strings.Contains(strings.Join(walked, " "), "file.txt") {
+		t.Errorf("遍历结果不正确: %v, %v", walked, err)
+	}
+
+	walked = nil
+	err = ls.Walk(context.Background(), "in", func(p string, info FileInfo) error {
+		walked = append(walked, p)
+		return nil
+	})
+	if err != nil || strings.Join(walked, " ") != "in/a.txt in/sub in/sub/b.txt in/sub/relative in/up" {
+		t.Errorf("经由链接遍历时应当报告链接下的路径: %v, %v", walked, err)
+	}
+
+	// 删除链接只删除链接本身
+	if err := ls.DeleteFile(context.Background(), "out", false); err != nil {
+		t.Fatalf("删除链接失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(ls.root), "outside", "secret.txt")); err != nil {
+		t.Errorf("删除链接不应影响目标: %v", err)
+	}
+}
+
+func TestSymlinkDeny(t *testing.T) {
+	ls := newSymlinkStorage(t, SymlinkDeny)
+	for _, p := range []string{"in/a.txt", "file.txt", "docs/up/b.txt", "out/secret.txt"} {
+		if _, err := readAll(t, ls, p); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("读取 %s 应当被拒绝: %v", p, err)
+		}
+	}
+	if _, err := ls.Stat(context.Background(), "in"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("查看链接应当被拒绝: %v", err)
+	}
+	if got, err := readAll(t, ls, "docs/a.txt"); err != nil || got != "inside" {
+		t.Errorf("读取普通文件得到 %q, %v", got, err)
+	}
+	entries, _, err := ls.ListDirectory(context.Background(), "docs", ListOptions{})
+	if err != nil || len(entries) != 2 {
+		t.Errorf("列目录时不应显示符号链接: %+v, %v", entries, err)
+	}
+}
+
+func TestSymlinkLink(t *testing.T) {
+	ls := newSymlinkStorage(t, SymlinkLink)
+	info, err := ls.Stat(context.Background(), "out")
+	if err != nil || info.Mode&os.ModeSymlink == 0 || info.IsDirectory || !info.IsSymlink || info.LinkTarget != "../outside" {
+		t.Errorf("链接应当显示为链接本身: %+v, %v", info, err)
+	}
+	for _, p := range []string{"file.txt", "in/a.txt", "out/secret.txt"} {
+		if _, err := readAll(t, ls, p); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("读取 %s 应当被拒绝: %v", p, err)
+		}
+	}
+	entries, _, err := ls.ListDirectory(context.Background(), "", ListOptions{})
+	if err != nil || len(entries) != 10 {
+		t.Errorf("应当列出全部条目，包括所有链接: %d, %v", len(entries), err)
+	}
+	for _, e := range entries {
+		if e.IsSymlink != (e.Name != "docs") {
+			t.Errorf("%s 的链接标记不正确: %+v", e.Name, e)
+		}
+	}
+	if e := entries[len(entries)-1]; e.Name != "sneaky" || e.LinkTarget != "docs/../../outside" {
+		t.Errorf("列目录时应当返回链接的目标: %+v", e)
+	}
+	if err := ls.Move(context.Background(), "out", "docs"); err != nil {
+		t.Fatalf("移动链接失败: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(ls.root, "docs", "out")); err != nil || target != "../outside" {
+		t.Errorf("移动后的链接不正确: %q, %v", target, err)
+	}
+}
+
+func FuzzLocalResolve(f *testing.F) {
+	for _, seed := range []string{"in/a.txt", "out/secret.txt", "sneaky", "docs/sub/escape", "docs/up/../../out", "hop/x", "loop/x", "dangling/../../x", `in\..\..\outside`, "abs/sub/relative", "docs/sub/detour/secret.txt"} {
+		f.Add(seed)
+	}
+	ls := newSymlinkStorage(f, SymlinkFollow)
+	f.Fuzz(func(t *testing.T, p string) {
+		for _, entry := range []bool{false, true} {
+			var full string
+			var err error
+			if entry {
+				full, err = ls.resolveEntry(p)
+			} else {
+				full, err = ls.resolve(p)
+			}
+			if err != nil {
+				continue
+			}
+			if !within(ls.root, full) {
+				t.Fatalf("%q 解析为根目录之外的 %q", p, full)
+			}
+			// 条目本身可以是链接，检查其所在目录；其余情况下已存在的最长前缀解析后必须仍在根目录内
+			if entry && full != ls.root {
+				full = filepath.Dir(full)
+			}
+			for {
+				if _, err := os.Lstat(full); err == nil {
+					break
+				}
+				full = filepath.Dir(full)
+			}
+			real, err := filepath.EvalSymlinks(full)
+			if err == nil && !within(ls.root, real) {
+				t.Fatalf("%q 解析为 %q，实际指向根目录之外的 %q", p, full, real)
+			}
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// 存储层返回的错误类别，具体错误通过 %w 包装，调用方使用 errors.Is 判断
+var (
+	ErrNotFound         = errors.New("文件或目录不存在")
+	ErrPermissionDenied = errors.New("访问被拒绝")
+	ErrIsDirectory      = errors.New("是目录")
+	ErrNotDirectory     = errors.New("不是目录")
+	ErrAlreadyExists    = errors.New("目标已存在")
+	ErrNotEmpty         = errors.New("目录非空")
+	ErrInvalidArgument  = errors.New("参数不合法")
+	ErrUnavailable      = errors.New("存储后端不可用")
+	ErrNoSpace          = errors.New("存储空间不足")
+)
+
+// storageErrors 所有错误类别，用于判断错误是否已经分类
+var storageErrors = []error{
+	ErrNotFound, ErrPermissionDenied, ErrIsDirectory, ErrNotDirectory,
+	ErrAlreadyExists, ErrNotEmpty, ErrInvalidArgument, ErrUnavailable, ErrNoSpace,
+}
+
+func classified(err error) bool {
+	for _, target := range storageErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// localError 将文件系统返回的错误归类，错误信息只包含相对于存储根目录的路径
+func localError(path string, err error) error {
+	if err == nil || classified(err) {
+		return err
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("%w: %s", ErrPermissionDenied, path)
+	case errors.Is(err, syscall.ENOTEMPTY):
+		// ENOTEMPTY 同时满足 fs.ErrExist，需要先判断
+		return fmt.Errorf("%w: %s", ErrNotEmpty, path)
+	case errors.Is(err, fs.ErrExist):
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, path)
+	case errors.Is(err, syscall.EISDIR):
+		return fmt.Errorf("%w: %s", ErrIsDirectory, path)
+	case errors.Is(err, syscall.ENOTDIR):
+		return fmt.Errorf("%w: %s", ErrNotDirectory, path)
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT):
+		// 磁盘已满或超出配额，不是请求本身的问题，清理空间后可以重试
+		return fmt.Errorf("%w: %s", ErrNoSpace, path)
+	case errors.Is(err, syscall.EIO), errors.Is(err, syscall.ENXIO), errors.Is(err, syscall.ENODEV), errors.Is(err, syscall.ESTALE):
+		// 磁盘故障、设备被移除或网络文件系统断开，稍后可能恢复
+		return fmt.Errorf("%w: %s", ErrUnavailable, path)
+	}
+	return err
+}
+
+// s3Error 将S3返回的错误归类：对象不存在、无权访问，以及网络或服务端故障导致的不可用
+func s3Error(path string, err error) error {
+	if err == nil || classified(err) {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var notFound *types.NotFound
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &notFound) || errors.As(err, &noSuchKey) {
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		// 没有收到S3的响应，通常是网络问题
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	switch apiErr.ErrorCode() {
+	case "NoSuchKey", "NotFound":
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	case "AccessDenied", "Forbidden", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return fmt.Errorf("%w: %s", ErrPermissionDenied, apiErr.ErrorMessage())
+	case "NoSuchBucket", "ServiceUnavailable", "SlowDown", "RequestTimeout", "InternalError":
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return err
+}
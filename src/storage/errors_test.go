@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestLocalErrorUnavailable(t *testing.T) {
+	for _, errno := range []error{syscall.EIO, syscall.ESTALE, syscall.ENODEV} {
+		err := localError("a.txt", fmt.Errorf("read: %w", errno))
+		if !errors.Is(err, ErrUnavailable) {
+			t.Errorf("%v 应当归类为 ErrUnavailable，实际: %v", errno, err)
+		}
+	}
+
+	// 根目录本身不存在时，所有请求都报告后端不可用
+	root := t.TempDir()
+	ls, err := NewLocalStorage(root, SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	if _, err := ls.Stat(context.Background(), "missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("根目录存在时应当返回 ErrNotFound，实际: %v", err)
+	}
+	if err := os.RemoveAll(root); err != nil {
+		t.Fatalf("删除根目录失败: %v", err)
+	}
+	if _, err := ls.Stat(context.Background(), "missing.txt"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("根目录不存在时应当返回 ErrUnavailable，实际: %v", err)
+	}
+}
+
+// noSpaceWriter 模拟磁盘已满或超出配额的文件，写入时返回与 *os.File 相同形式的错误
+type noSpaceWriter struct {
+	errno syscall.Errno
+}
+
+func (w noSpaceWriter) Write(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: "/var/lib/zfs/docs/.upload-123", Err: w.errno}
+}
+
+// noSpaceReader 在上传过程中以写入失败的错误结束，模拟 io.Copy 写入临时文件时磁盘已满
+type noSpaceReader struct {
+	w noSpaceWriter
+}
+
+func (r noSpaceReader) Read(p []byte) (int, error) {
+	return r.w.Write(p)
+}
+
+func TestLocalErrorNoSpace(t *testing.T) {
+	for _, errno := range []syscall.Errno{syscall.ENOSPC, syscall.EDQUOT} {
+		_, err := io.Copy(noSpaceWriter{errno}, strings.NewReader("data"))
+		err = localError("docs/a.txt", err)
+		if !errors.Is(err, ErrNoSpace) {
+			t.Errorf("%v 应当归类为 ErrNoSpace，实际: %v", errno, err)
+		}
+		if strings.Contains(err.Error(), "/var/lib") {
+			t.Errorf("错误信息不应包含绝对路径: %v", err)
+		}
+	}
+
+	// 上传时写入失败，返回 ErrNoSpace 且不留下临时文件
+	root := t.TempDir()
+	ls, err := NewLocalStorage(root, SymlinkFollow)
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	err = ls.UploadFile(context.Background(), "docs/a.txt", noSpaceReader{noSpaceWriter{syscall.ENOSPC}})
+	if !errors.Is(err, ErrNoSpace) {
+		t.Errorf("磁盘已满时上传应当返回 ErrNoSpace，实际: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "docs")); len(entries) != 0 {
+		t.Errorf("上传失败后不应留下临时文件: %v", entries)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"ZFS/config"
 	"context"
 	"fmt"
+	"time"
 )
 
 // NewStorage 根据配置创建存储实例
@@ -14,7 +15,11 @@ func NewStorage(ctx context.Context, cfg *config.Config) (Storage, error) {
 		if root == "" {
 			root = "./storage" // 默认值
 		}
-		return NewLocalStorage(root)
+		symlinks, err := ParseSymlinkPolicy(cfg.Storage.Symlinks)
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalStorage(root, symlinks)
 		
 	case "s3":
 		s3cfg := S3StorageConfig{
@@ -25,9 +30,14 @@ func NewStorage(ctx context.Context, cfg *config.Config) (Storage, error) {
 			SecretAccessKey: cfg.Storage.S3.SecretAccessKey,
 			Endpoint:        cfg.Storage.S3.Endpoint,
 			ForcePathStyle:  cfg.Storage.S3.ForcePathStyle,
+			WatchInterval:   time.Duration(cfg.Storage.S3.WatchInterval) * time.Second,
+			Quota:           cfg.Storage.S3.Quota,
 		}
 		return NewS3Storage(ctx, s3cfg)
 		
+	case "memory":
+		return NewMemoryStorage(cfg.Storage.Memory.Seed, cfg.Storage.Memory.MaxBytes)
+		
 	default:
 		return nil, fmt.Errorf("不支持的存储类型: %s", cfg.Storage.Type)
 	}
@@ -1,21 +1,27 @@
 package storage
 
 import (
-	"ZFS/utils"
+	"container/heap"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 // LocalStorage 本地文件系统存储实现
 type LocalStorage struct {
-	root string // 存储根目录
+	root     string        // 存储根目录，已解析其中的符号链接
+	symlinks SymlinkPolicy // 处理存储目录内符号链接的策略
 }
 
-// NewLocalStorage 创建本地存储实例
-func NewLocalStorage(root string) (*LocalStorage, error) {
+// NewLocalStorage 创建本地存储实例，symlinks 指定如何处理存储目录内的符号链接
+func NewLocalStorage(root string, symlinks SymlinkPolicy) (*LocalStorage, error) {
 	// 确保根目录存在
 	if err := os.MkdirAll(root, os.ModePerm); err != nil {
 		return nil, err
@@ -25,132 +31,431 @@ func NewLocalStorage(root string) (*LocalStorage, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 根目录本身可以位于符号链接之下（如 macOS 的 /tmp），解析后才能判断链接目标是否在根目录内
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return nil, err
+	}
 	
 	return &LocalStorage{
-		root: absRoot,
+		root:     realRoot,
+		symlinks: symlinks,
 	}, nil
 }
 
+// localError 在 localError 的基础上，将存储根目录本身不可访问（被删除或卸载）时的错误归类为 ErrUnavailable，
+// 而不是让每个请求都报告文件不存在
+func (ls *LocalStorage) localError(path string, err error) error {
+	err = localError(path, err)
+	if errors.Is(err, ErrNotFound) {
+		if _, statErr := os.Stat(ls.root); statErr != nil {
+			return fmt.Errorf("%w: 存储根目录不可访问", ErrUnavailable)
+		}
+	}
+	return err
+}
+
 // GetRoot 获取存储根路径
 func (ls *LocalStorage) GetRoot() string {
 	return ls.root
 }
 
-// IsPathAllowed 检查路径是否在允许访问的范围内
-func (ls *LocalStorage) IsPathAllowed(path string) (bool, error) {
-	fullPath := filepath.Join(ls.root, path)
-	return utils.IsInStorage(ls.root, fullPath)
+// Type 返回存储类型
+func (ls *LocalStorage) Type() string {
+	return "local"
 }
 
-// ListDirectory 列出目录下的所有文件和子目录
-func (ls *LocalStorage) ListDirectory(ctx context.Context, path string) ([]FileInfo, error) {
-	fullPath := filepath.Join(ls.root, path)
-	
-	// 检查路径权限
-	allowed, err := ls.IsPathAllowed(path)
+// Capacity 返回存储根目录所在文件系统的容量和可用空间
+func (ls *LocalStorage) Capacity(ctx context.Context) (CapacityInfo, error) {
+	info, err := diskCapacity(ls.root)
 	if err != nil {
-		return nil, err
+		return CapacityInfo{}, ls.localError("", err)
+	}
+	return info, nil
+}
+
+// Ping 检查存储根目录是否仍然存在
+func (ls *LocalStorage) Ping(ctx context.Context) error {
+	info, err := os.Stat(ls.root)
+	if err != nil {
+		return err
 	}
-	if !allowed {
-		return nil, errors.New("访问被拒绝：只能访问storage目录下的内容")
+	if !info.IsDir() {
+		return fmt.Errorf("存储根目录不是目录: %s", ls.root)
+	}
+	return nil
+}
+
+// IsPathAllowed 检查路径解析符号链接后是否仍在存储根目录内
+func (ls *LocalStorage) IsPathAllowed(path string) (bool, error) {
+	_, err := ls.resolve(path)
+	return pathAllowed(err)
+}
+
+// ListDirectory 分页列出目录下的文件和子目录，游标为上一页最后一个条目的名称。
+// 目录按批读取，每页只保留名称最小的PageSize个条目，避免将超大目录整体读入内存
+func (ls *LocalStorage) ListDirectory(ctx context.Context, path string, opts ListOptions) ([]FileInfo, string, error) {
+	// 解析路径并检查是否在存储根目录内
+	fullPath, err := ls.resolve(path)
+	if err != nil {
+		return nil, "", err
 	}
 	
 	// 检查目录是否存在
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		return []FileInfo{}, nil
-	} else if err != nil {
-		return nil, err
+	if info, err := os.Stat(fullPath); err != nil {
+		return nil, "", ls.localError(path, err)
+	} else if !info.IsDir() {
+		return nil, "", fmt.Errorf("%w: %s", ErrNotDirectory, path)
 	}
 	
 	// 读取目录内容
-	files, err := os.ReadDir(fullPath)
+	dir, err := os.Open(fullPath)
 	if err != nil {
-		return nil, err
+		return nil, "", ls.localError(path, err)
+	}
+	defer dir.Close()
+	
+	// 多保留一个条目，用于判断是否还有下一页
+	limit := opts.PageSize + 1
+	var files direntHeap
+	for {
+		batch, err := dir.ReadDir(1024)
+		for _, file := range batch {
+			if opts.PageToken != "" && file.Name() <= opts.PageToken {
+				continue
+			}
+			if opts.PageSize <= 0 {
+				files = append(files, file)
+				continue
+			}
+			if len(files) < limit {
+				heap.Push(&files, file)
+			} else if file.Name() < files[0].Name() {
+				files[0] = file
+				heap.Fix(&files, 0)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", ls.localError(path, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	
+	var nextToken string
+	if opts.PageSize > 0 && len(files) > opts.PageSize {
+		files = files[:opts.PageSize]
+		nextToken = files[len(files)-1].Name()
 	}
 	
-	var entries []FileInfo
+	entries := []FileInfo{}
 	for _, file := range files {
 		info, err := file.Info()
 		if err != nil {
 			continue
 		}
 		
-		entry := FileInfo{
-			Name:        file.Name(),
-			IsDirectory: file.IsDir(),
-			Size:        info.Size(),
+		if entry, ok := ls.entryInfo(filepath.Join(fullPath, file.Name()), info, true); ok {
+			entries = append(entries, entry)
 		}
-		entries = append(entries, entry)
 	}
 	
-	return entries, nil
+	return entries, nextToken, nil
+}
+
+// direntHeap 按名称排序的目录项大顶堆，堆顶为名称最大的条目
+type direntHeap []os.DirEntry
+
+func (h direntHeap) Len() int           { return len(h) }
+func (h direntHeap) Less(i, j int) bool { return h[i].Name() > h[j].Name() }
+func (h direntHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *direntHeap) Push(x any)        { *h = append(*h, x.(os.DirEntry)) }
+func (h *direntHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// Stat 获取单个文件或目录的信息，符号链接按策略显示为目标或链接本身
+func (ls *LocalStorage) Stat(ctx context.Context, path string) (FileInfo, error) {
+	fullPath, err := ls.resolveEntry(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return FileInfo{}, ls.localError(path, err)
+	}
+	if info.Mode()&fs.ModeSymlink != 0 && ls.symlinks != SymlinkLink {
+		// 跟随策略下解析链接的目标，拒绝策略下返回相应的错误
+		if fullPath, err = ls.resolve(path); err != nil {
+			return FileInfo{}, err
+		}
+		if info, err = os.Stat(fullPath); err != nil {
+			return FileInfo{}, ls.localError(path, err)
+		}
+	}
+	return localFileInfo(fullPath, info), nil
+}
+
+// localFileInfo 将os.FileInfo转换为FileInfo，目录会额外统计直接子项数量，符号链接会读取链接的目标
+func localFileInfo(fullPath string, info os.FileInfo) FileInfo {
+	entry := localEntryInfo(info)
+	if entry.IsSymlink {
+		entry.LinkTarget, _ = os.Readlink(fullPath)
+	}
+	if info.IsDir() {
+		if dir, err := os.Open(fullPath); err == nil {
+			if names, err := dir.Readdirnames(-1); err == nil {
+				entry.ChildCount = int64(len(names))
+			}
+			dir.Close()
+		}
+	}
+	return entry
+}
+
+// localEntryInfo 将os.FileInfo转换为FileInfo，不统计目录的子项数量
+func localEntryInfo(info os.FileInfo) FileInfo {
+	entry := FileInfo{
+		Name:        info.Name(),
+		IsDirectory: info.IsDir(),
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		Mode:        info.Mode(),
+		ContentType: contentTypeByName(info.Name(), info.IsDir()),
+		ChildCount:  -1,
+		IsSymlink:   info.Mode()&fs.ModeSymlink != 0,
+	}
+	if info.IsDir() {
+		entry.Size = 0
+	}
+	return entry
+}
+
+// Walk 按名称顺序递归遍历目录，无法读取的子目录会被跳过
+func (ls *LocalStorage) Walk(ctx context.Context, path string, fn WalkFunc) error {
+	base, err := CleanPath(path)
+	if err != nil {
+		return err
+	}
+	fullPath, err := ls.confine(base, true)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return ls.localError(path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s", ErrNotDirectory, path)
+	}
+	return filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+		if p == fullPath {
+			return ls.localError(path, err)
+		}
+		if err != nil {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entry, ok := ls.entryInfo(p, info, false)
+		if !ok {
+			return nil
+		}
+		// 相对于请求的路径报告，经由符号链接遍历时也不暴露链接目标的位置
+		rel, err := filepath.Rel(fullPath, p)
+		if err != nil {
+			return err
+		}
+		return fn(pathpkg.Join(base, filepath.ToSlash(rel)), entry)
+	})
 }
 
 // DownloadFile 下载文件，返回一个可读取的流
-func (ls *LocalStorage) DownloadFile(ctx context.Context, path string) (io.ReadCloser, error) {
-	fullPath := filepath.Join(ls.root, path)
-	
-	// 检查路径权限
-	allowed, err := ls.IsPathAllowed(path)
+func (ls *LocalStorage) DownloadFile(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	// 解析路径并检查是否在存储根目录内
+	fullPath, err := ls.resolve(path)
 	if err != nil {
 		return nil, err
 	}
-	if !allowed {
-		return nil, errors.New("访问被拒绝：只能下载storage目录下的文件")
-	}
 	
 	// 打开文件
 	file, err := os.Open(fullPath)
 	if err != nil {
-		return nil, err
+		return nil, ls.localError(path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ls.localError(path, err)
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s", ErrIsDirectory, path)
+	}
+	if offset == 0 && length <= 0 {
+		return file, nil
 	}
 	
-	return file, nil
+	// 定位到请求的范围
+	if offset < 0 || offset > info.Size() {
+		file.Close()
+		return nil, fmt.Errorf("%w: 读取范围不合法: offset=%d, 文件大小=%d", ErrInvalidArgument, offset, info.Size())
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if length <= 0 {
+		return file, nil
+	}
+	return rangeReadCloser{Reader: io.LimitReader(file, length), Closer: file}, nil
 }
 
 // UploadFile 上传文件
 func (ls *LocalStorage) UploadFile(ctx context.Context, path string, reader io.Reader) error {
-	fullPath := filepath.Join(ls.root, path)
-	
-	// 检查路径权限
-	allowed, err := ls.IsPathAllowed(path)
+	// 解析路径并检查是否在存储根目录内
+	fullPath, err := ls.resolve(path)
 	if err != nil {
 		return err
 	}
-	if !allowed {
-		return errors.New("访问被拒绝：只能上传到storage目录下")
-	}
 	
 	// 确保父目录存在
 	dir := filepath.Dir(fullPath)
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		return err
+		return ls.localError(filepath.Dir(path), err)
+	}
+	
+	// 目录不能被文件覆盖
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(fullPath); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%w: %s", ErrIsDirectory, path)
+		}
+		mode = info.Mode().Perm()
 	}
 	
-	// 创建文件
-	file, err := os.Create(fullPath)
+	// 先写入同一目录下的临时文件，完整接收后再替换目标文件，
+	// 上传失败或被取消时已有的文件保持不变
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return ls.localError(filepath.Dir(path), err)
+	}
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		// 写入失败（如磁盘已满）时错误中是临时文件的绝对路径，需要归类；读取上传数据的错误原样返回
+		return ls.localError(path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return ls.localError(path, err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		os.Remove(tmp.Name())
+		return ls.localError(path, err)
+	}
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		os.Remove(tmp.Name())
+		return ls.localError(path, err)
+	}
+	return nil
+}
+
+// DeleteFile 删除文件或目录
+func (ls *LocalStorage) DeleteFile(ctx context.Context, path string, recursive bool) error {
+	// 删除的是条目本身，符号链接只删除链接
+	fullPath, err := ls.resolveEntry(path)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	if fullPath == ls.root {
+		return fmt.Errorf("%w：不允许删除存储根目录", ErrPermissionDenied)
+	}
 	
-	// 复制数据
-	_, err = io.Copy(file, reader)
-	return err
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return ls.localError(path, err)
+	}
+	if info.IsDir() && recursive {
+		return ls.localError(path, os.RemoveAll(fullPath))
+	}
+	return ls.localError(path, os.Remove(fullPath))
 }
 
-// DeleteFile 删除文件
-func (ls *LocalStorage) DeleteFile(ctx context.Context, path string) error {
-	fullPath := filepath.Join(ls.root, path)
-	
-	// 检查路径权限
-	allowed, err := ls.IsPathAllowed(path)
+// MakeDirectory 创建目录
+func (ls *LocalStorage) MakeDirectory(ctx context.Context, path string) error {
+	// 解析路径并检查是否在存储根目录内
+	fullPath, err := ls.resolve(path)
 	if err != nil {
 		return err
 	}
-	if !allowed {
-		return errors.New("访问被拒绝：只能删除storage目录下的文件")
+
+	return ls.localError(path, os.MkdirAll(fullPath, os.ModePerm))
+}
+
+// Rename 在原目录内重命名文件或目录
+func (ls *LocalStorage) Rename(ctx context.Context, path string, newName string) error {
+	if newName == "" || newName == "." || newName == ".." || strings.ContainsAny(newName, `/\`) {
+		return fmt.Errorf("%w: 新名称不合法: %s", ErrInvalidArgument, newName)
 	}
-	
-	return os.Remove(fullPath)
+	// 先规范化再取上级目录，"a/.."、反斜杠等写法和 Move 看到的是同一个位置
+	clean, err := CleanPath(path)
+	if err != nil {
+		return err
+	}
+	return ls.Move(ctx, clean, filepath.Join(parentPath(clean), newName))
+}
+
+// Move 移动文件或目录
+func (ls *LocalStorage) Move(ctx context.Context, src string, dst string) error {
+	// 移动的是条目本身，符号链接只移动链接；目标按普通路径解析
+	srcPath, err := ls.resolveEntry(src)
+	if err != nil {
+		return err
+	}
+	dstPath, err := ls.resolve(dst)
+	if err != nil {
+		return err
+	}
+	if srcPath == ls.root {
+		return fmt.Errorf("%w：不允许移动存储根目录", ErrPermissionDenied)
+	}
+	if _, err := os.Lstat(srcPath); err != nil {
+		return ls.localError(src, err)
+	}
+
+	// 目标为已存在的目录时，移动到该目录下
+	if info, err := os.Stat(dstPath); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%w: %s", ErrAlreadyExists, dst)
+		}
+		dstPath = filepath.Join(dstPath, filepath.Base(srcPath))
+		if _, err := os.Stat(dstPath); err == nil {
+			return fmt.Errorf("%w: %s", ErrAlreadyExists, filepath.Join(dst, filepath.Base(srcPath)))
+		}
+	}
+	// 不能把目录移动到自身或其子目录下
+	if rel, err := filepath.Rel(srcPath, dstPath); err == nil && !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%w: 不能将目录移动到其自身之下", ErrInvalidArgument)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), os.ModePerm); err != nil {
+		return ls.localError(filepath.Dir(dst), err)
+	}
+	return ls.localError(src, os.Rename(srcPath, dstPath))
 }
@@ -0,0 +1,632 @@
+package storage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryWatchInterval 内存存储的 Watch 比较快照的间隔，快照只需遍历内存中的目录树
+const memoryWatchInterval = time.Second
+
+// MemoryStorage 内存存储实现，节点退出后内容全部丢失，用于测试和临时节点。
+// 文件内容写入后不再修改，覆盖时替换为新的切片，因此已打开的读取流不受后续写入影响
+type MemoryStorage struct {
+	mu       sync.RWMutex
+	root     *memNode
+	maxBytes int64 // 文件内容总大小的上限（字节），0表示不限
+	used     int64 // 文件内容的总大小，持有写锁时随写入和删除更新
+}
+
+// memNode 内存存储中的文件或目录
+type memNode struct {
+	name     string
+	isDir    bool
+	data     []byte
+	modTime  time.Time
+	children map[string]*memNode // 仅目录使用
+}
+
+func newMemDir(name string, modTime time.Time) *memNode {
+	return &memNode{name: name, isDir: true, modTime: modTime, children: make(map[string]*memNode)}
+}
+
+// info 转换为FileInfo，根目录的名称为/
+func (n *memNode) info() FileInfo {
+	entry := FileInfo{
+		Name:        n.name,
+		IsDirectory: n.isDir,
+		Size:        int64(len(n.data)),
+		ModTime:     n.modTime,
+		Mode:        0644,
+		ContentType: contentTypeByName(n.name, n.isDir),
+		ChildCount:  -1,
+	}
+	if n.isDir {
+		entry.Mode = fs.ModeDir | 0755
+		entry.ChildCount = int64(len(n.children))
+	}
+	return entry
+}
+
+// size 文件内容的大小，目录为其下所有文件的总大小
+func (n *memNode) size() int64 {
+	total := int64(len(n.data))
+	for _, child := range n.children {
+		total += child.size()
+	}
+	return total
+}
+
+// sortedChildren 按名称排序的子项
+func (n *memNode) sortedChildren() []*memNode {
+	children := make([]*memNode, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	return children
+}
+
+// NewMemoryStorage 创建内存存储实例，seed 不为空时载入该目录或tar文件（可以是gzip压缩的）的内容。
+// maxBytes 大于0时限制文件内容的总大小，种子的内容同样计入
+func NewMemoryStorage(seed string, maxBytes int64) (*MemoryStorage, error) {
+	ms := &MemoryStorage{root: newMemDir("/", time.Now()), maxBytes: maxBytes}
+	if seed == "" {
+		return ms, nil
+	}
+	info, err := os.Stat(seed)
+	if err != nil {
+		return nil, fmt.Errorf("读取种子失败: %w", err)
+	}
+	if info.IsDir() {
+		err = ms.seedDirectory(seed)
+	} else {
+		err = ms.seedTar(seed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("载入种子 %s 失败: %w", seed, err)
+	}
+	return ms, nil
+}
+
+// seedDirectory 复制本地目录下的文件和子目录，不跟随符号链接
+func (ms *MemoryStorage) seedDirectory(dir string) error {
+	dirTimes := make(map[string]time.Time)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return ms.seedEntry(filepath.ToSlash(rel), true, nil, info.ModTime(), dirTimes)
+		case info.Mode().IsRegular():
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			return ms.seedEntry(filepath.ToSlash(rel), false, data, info.ModTime(), dirTimes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ms.restoreDirTimes(dirTimes)
+	return nil
+}
+
+// seedTar 载入tar文件中的目录和普通文件，其他类型的条目（链接、设备等）被忽略
+func (ms *MemoryStorage) seedTar(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = bufio.NewReader(file)
+	// 按内容而不是扩展名判断是否经过gzip压缩
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	dirTimes := make(map[string]time.Time)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			ms.restoreDirTimes(dirTimes)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = ms.seedEntry(header.Name, true, nil, header.ModTime, dirTimes)
+		case tar.TypeReg:
+			var data []byte
+			if data, err = io.ReadAll(tr); err == nil {
+				err = ms.seedEntry(header.Name, false, data, header.ModTime, dirTimes)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// seedEntry 按种子中的修改时间创建目录或文件，路径与请求中的路径一样需要通过检查。
+// 之后载入的条目会更新上级目录的修改时间，因此目录的修改时间记录在 dirTimes 中，全部载入后再恢复
+func (ms *MemoryStorage) seedEntry(p string, isDir bool, data []byte, modTime time.Time, dirTimes map[string]time.Time) error {
+	clean, err := CleanPath(p)
+	if err != nil {
+		return fmt.Errorf("路径不合法 %s: %w", p, err)
+	}
+	if isDir {
+		dirTimes[clean] = modTime
+	}
+	if clean == "" {
+		return nil
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if isDir {
+		_, err = ms.mkdirAll(clean, modTime)
+		return err
+	}
+	return ms.put(clean, data, modTime)
+}
+
+// restoreDirTimes 将目录的修改时间恢复为种子中记录的时间
+func (ms *MemoryStorage) restoreDirTimes(dirTimes map[string]time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for clean, modTime := range dirTimes {
+		if n, err := ms.lookup(clean); err == nil && n.isDir {
+			n.modTime = modTime
+		}
+	}
+}
+
+// GetRoot 获取存储根路径
+func (ms *MemoryStorage) GetRoot() string {
+	return "memory://"
+}
+
+// Type 返回存储类型
+func (ms *MemoryStorage) Type() string {
+	return "memory"
+}
+
+// Capacity 返回文件内容的总大小，配置了 maxBytes 时以其作为总容量
+func (ms *MemoryStorage) Capacity(ctx context.Context) (CapacityInfo, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	info := CapacityInfo{Total: ms.maxBytes, Used: ms.used}
+	if ms.maxBytes > 0 {
+		info.Free = max(ms.maxBytes-ms.used, 0)
+	}
+	return info, nil
+}
+
+// Ping 内存存储总是可用
+func (ms *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+// IsPathAllowed 检查路径是否在允许访问的范围内，内存存储没有符号链接，只需规范路径
+func (ms *MemoryStorage) IsPathAllowed(path string) (bool, error) {
+	_, err := CleanPath(path)
+	return pathAllowed(err)
+}
+
+// RealPath 内存存储没有符号链接，实际位置就是规范后的路径
+func (ms *MemoryStorage) RealPath(path string, followLast bool) (string, error) {
+	return CleanPath(path)
+}
+
+// lookup 查找已规范的路径对应的节点，调用方需持有锁
+func (ms *MemoryStorage) lookup(clean string) (*memNode, error) {
+	n := ms.root
+	for _, name := range splitPath(clean) {
+		if !n.isDir {
+			return nil, fmt.Errorf("%w: %s", ErrNotDirectory, pathpkg.Dir(clean))
+		}
+		child, ok := n.children[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, clean)
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// parentPath 已规范路径的上级目录，根目录下的条目返回空字符串
+func parentPath(clean string) string {
+	return strings.TrimPrefix(pathpkg.Dir("/"+clean), "/")
+}
+
+// mkdirAll 创建目录及不存在的上级目录，调用方需持有写锁
+func (ms *MemoryStorage) mkdirAll(clean string, modTime time.Time) (*memNode, error) {
+	n := ms.root
+	for _, name := range splitPath(clean) {
+		child, ok := n.children[name]
+		if !ok {
+			child = newMemDir(name, modTime)
+			n.children[name] = child
+			n.modTime = modTime
+		} else if !child.isDir {
+			return nil, fmt.Errorf("%w: %s", ErrNotDirectory, clean)
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// put 写入文件，必要时创建上级目录，超出 maxBytes 时返回 ErrNoSpace，调用方需持有写锁
+func (ms *MemoryStorage) put(clean string, data []byte, modTime time.Time) error {
+	if clean == "" {
+		return fmt.Errorf("%w: %s", ErrIsDirectory, clean)
+	}
+	if err := ms.reserve(clean, int64(len(data))); err != nil {
+		return err
+	}
+	parent, err := ms.mkdirAll(parentPath(clean), modTime)
+	if err != nil {
+		return err
+	}
+	name := pathpkg.Base(clean)
+	existing, ok := parent.children[name]
+	if ok && existing.isDir {
+		return fmt.Errorf("%w: %s", ErrIsDirectory, clean)
+	}
+	if ok {
+		ms.used -= int64(len(existing.data))
+	}
+	parent.children[name] = &memNode{name: name, data: data, modTime: modTime}
+	parent.modTime = modTime
+	ms.used += int64(len(data))
+	return nil
+}
+
+// available 写入clean时最多可以使用的字节数，覆盖已有文件时其原有内容的空间可以重用；
+// 没有限制时返回-1，调用方需持有锁
+func (ms *MemoryStorage) available(clean string) int64 {
+	if ms.maxBytes <= 0 {
+		return -1
+	}
+	free := ms.maxBytes - ms.used
+	if n, err := ms.lookup(clean); err == nil && !n.isDir {
+		free += int64(len(n.data))
+	}
+	return max(free, 0)
+}
+
+// reserve 检查写入size字节的内容到clean后是否超出 maxBytes，调用方需持有锁
+func (ms *MemoryStorage) reserve(clean string, size int64) error {
+	if free := ms.available(clean); free >= 0 && size > free {
+		return fmt.Errorf("%w：内存存储已用 %d 字节，上限 %d 字节，无法写入 %s", ErrNoSpace, ms.used, ms.maxBytes, clean)
+	}
+	return nil
+}
+
+// ListDirectory 按名称顺序分页列出目录下的文件和子目录，游标为上一页最后一个条目的名称
+func (ms *MemoryStorage) ListDirectory(ctx context.Context, path string, opts ListOptions) ([]FileInfo, string, error) {
+	clean, err := CleanPath(path)
+	if err != nil {
+		return nil, "", err
+	}
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	dir, err := ms.lookup(clean)
+	if err != nil {
+		return nil, "", err
+	}
+	if !dir.isDir {
+		return nil, "", fmt.Errorf("%w: %s", ErrNotDirectory, path)
+	}
+
+	entries := []FileInfo{}
+	var nextToken string
+	for _, child := range dir.sortedChildren() {
+		if opts.PageToken != "" && child.name <= opts.PageToken {
+			continue
+		}
+		if opts.PageSize > 0 && len(entries) == opts.PageSize {
+			nextToken = entries[len(entries)-1].Name
+			break
+		}
+		entries = append(entries, child.info())
+	}
+	return entries, nextToken, nil
+}
+
+// Stat 获取单个文件或目录的信息
+func (ms *MemoryStorage) Stat(ctx context.Context, path string) (FileInfo, error) {
+	clean, err := CleanPath(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	n, err := ms.lookup(clean)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return n.info(), nil
+}
+
+// Walk 按名称顺序递归遍历目录。遍历前先在读锁内记录下全部条目，
+// fn中可以调用存储的其他方法，遍历期间的修改不会反映在结果中
+func (ms *MemoryStorage) Walk(ctx context.Context, path string, fn WalkFunc) error {
+	clean, err := CleanPath(path)
+	if err != nil {
+		return err
+	}
+	type walkEntry struct {
+		path string
+		info FileInfo
+	}
+	var entries []walkEntry
+	ms.mu.RLock()
+	dir, err := ms.lookup(clean)
+	if err == nil && !dir.isDir {
+		err = fmt.Errorf("%w: %s", ErrNotDirectory, path)
+	}
+	if err == nil {
+		var visit func(p string, n *memNode)
+		visit = func(p string, n *memNode) {
+			for _, child := range n.sortedChildren() {
+				childPath := pathpkg.Join(p, child.name)
+				entries = append(entries, walkEntry{childPath, child.info()})
+				visit(childPath, child)
+			}
+		}
+		visit(clean, dir)
+	}
+	ms.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(e.path, e.info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DownloadFile 下载文件，返回一个可读取的流
+func (ms *MemoryStorage) DownloadFile(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	clean, err := CleanPath(path)
+	if err != nil {
+		return nil, err
+	}
+	ms.mu.RLock()
+	n, err := ms.lookup(clean)
+	var data []byte
+	if err == nil && n.isDir {
+		err = fmt.Errorf("%w: %s", ErrIsDirectory, path)
+	} else if err == nil {
+		data = n.data
+	}
+	ms.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset > int64(len(data)) {
+		return nil, fmt.Errorf("%w: 读取范围不合法: offset=%d, 文件大小=%d", ErrInvalidArgument, offset, len(data))
+	}
+	data = data[offset:]
+	if length > 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// UploadFile 上传文件，内容完整读取后才写入，失败时不会留下不完整的文件。
+// 配置了 maxBytes 时最多读取剩余空间再多一个字节，超出时不再继续读取
+func (ms *MemoryStorage) UploadFile(ctx context.Context, path string, reader io.Reader) error {
+	clean, err := CleanPath(path)
+	if err != nil {
+		return err
+	}
+	ms.mu.RLock()
+	free := ms.available(clean)
+	ms.mu.RUnlock()
+	if free >= 0 {
+		reader = io.LimitReader(reader, free+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.put(clean, data, time.Now())
+}
+
+// DeleteFile 删除文件或目录，非空目录需要指定recursive
+func (ms *MemoryStorage) DeleteFile(ctx context.Context, path string, recursive bool) error {
+	clean, err := CleanPath(path)
+	if err != nil {
+		return err
+	}
+	if clean == "" {
+		return fmt.Errorf("%w：不允许删除存储根目录", ErrPermissionDenied)
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	n, err := ms.lookup(clean)
+	if err != nil {
+		return err
+	}
+	if n.isDir && len(n.children) > 0 && !recursive {
+		return fmt.Errorf("%w: %s", ErrNotEmpty, path)
+	}
+	parent, _ := ms.lookup(parentPath(clean))
+	delete(parent.children, n.name)
+	parent.modTime = time.Now()
+	ms.used -= n.size()
+	return nil
+}
+
+// MakeDirectory 创建目录（包括不存在的父目录）
+func (ms *MemoryStorage) MakeDirectory(ctx context.Context, path string) error {
+	clean, err := CleanPath(path)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	_, err = ms.mkdirAll(clean, time.Now())
+	return err
+}
+
+// Rename 在原目录内重命名文件或目录
+func (ms *MemoryStorage) Rename(ctx context.Context, path string, newName string) error {
+	if newName == "" || newName == "." || newName == ".." || strings.ContainsAny(newName, `/\`) {
+		return fmt.Errorf("%w: 新名称不合法: %s", ErrInvalidArgument, newName)
+	}
+	clean, err := CleanPath(path)
+	if err != nil {
+		return err
+	}
+	return ms.Move(ctx, clean, pathpkg.Join(parentPath(clean), newName))
+}
+
+// Move 移动文件或目录，dst为已存在的目录时移动到该目录下
+func (ms *MemoryStorage) Move(ctx context.Context, src string, dst string) error {
+	srcClean, err := CleanPath(src)
+	if err != nil {
+		return err
+	}
+	dstClean, err := CleanPath(dst)
+	if err != nil {
+		return err
+	}
+	if srcClean == "" {
+		return fmt.Errorf("%w：不允许移动存储根目录", ErrPermissionDenied)
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	n, err := ms.lookup(srcClean)
+	if err != nil {
+		return err
+	}
+
+	// 目标为已存在的目录时，移动到该目录下
+	if target, err := ms.lookup(dstClean); err == nil {
+		if !target.isDir {
+			return fmt.Errorf("%w: %s", ErrAlreadyExists, dst)
+		}
+		dstClean = pathpkg.Join(dstClean, n.name)
+		if _, err := ms.lookup(dstClean); err == nil {
+			return fmt.Errorf("%w: %s", ErrAlreadyExists, dstClean)
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	// 不能把目录移动到自身或其子目录下
+	if dstClean == srcClean || strings.HasPrefix(dstClean, srcClean+"/") {
+		return fmt.Errorf("%w: 不能将目录移动到其自身之下", ErrInvalidArgument)
+	}
+
+	now := time.Now()
+	parent, err := ms.mkdirAll(parentPath(dstClean), now)
+	if err != nil {
+		return err
+	}
+	srcParent, _ := ms.lookup(parentPath(srcClean))
+	delete(srcParent.children, n.name)
+	srcParent.modTime = now
+	n.name = pathpkg.Base(dstClean)
+	parent.children[n.name] = n
+	parent.modTime = now
+	return nil
+}
+
+// Watch 与S3存储一样定期比较目录的快照。目录本身被删除时先发送其中条目的删除事件，
+// 下一次比较时结束监视
+func (ms *MemoryStorage) Watch(ctx context.Context, p string, recursive bool) (<-chan WatchEvent, error) {
+	dir, err := CleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := ms.snapshot(ctx, dir, recursive)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	var removed bool
+	list := func(ctx context.Context) (map[string]FileInfo, error) {
+		if removed {
+			cancel()
+			return nil, ctx.Err()
+		}
+		entries, err := ms.snapshot(ctx, dir, recursive)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrNotDirectory) {
+			removed = true
+			return map[string]FileInfo{}, nil
+		}
+		return entries, err
+	}
+	events := make(chan WatchEvent, watchBuffer)
+	go func() {
+		defer cancel()
+		pollWatch(ctx, memoryWatchInterval, previous, list, events)
+	}()
+	return events, nil
+}
+
+// snapshot 列出dir下的条目，key为相对于存储根目录的路径
+func (ms *MemoryStorage) snapshot(ctx context.Context, dir string, recursive bool) (map[string]FileInfo, error) {
+	entries := make(map[string]FileInfo)
+	if !recursive {
+		files, _, err := ms.ListDirectory(ctx, dir, ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			entries[pathpkg.Join(dir, f.Name)] = f
+		}
+		return entries, nil
+	}
+	err := ms.Walk(ctx, dir, func(p string, info FileInfo) error {
+		entries[p] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
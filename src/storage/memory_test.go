@@ -0,0 +1,410 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestMemoryStorage(t testing.TB, files map[string]string) *MemoryStorage {
+	t.Helper()
+	ms, err := NewMemoryStorage("", 0)
+	if err != nil {
+		t.Fatalf("创建内存存储失败: %v", err)
+	}
+	for p, content := range files {
+		if err := ms.UploadFile(context.Background(), p, strings.NewReader(content)); err != nil {
+			t.Fatalf("上传 %s 失败: %v", p, err)
+		}
+	}
+	return ms
+}
+
+func readMemory(t *testing.T, ms *MemoryStorage, p string, offset, length int64) (string, error) {
+	t.Helper()
+	r, err := ms.DownloadFile(context.Background(), p, offset, length)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	return string(data), err
+}
+
+func TestMemoryStorage(t *testing.T) {
+	ms := newTestMemoryStorage(t, map[string]string{
+		"docs/a.txt":       "hello world",
+		`docs\sub\b.txt`:   "nested",
+		"/report.csv":      "1,2,3",
+		"docs/sub/../c.md": "# c",
+	})
+	ctx := context.Background()
+
+	if got, err := readMemory(t, ms, "docs/a.txt", 6, 3); err != nil || got != "wor" {
+		t.Errorf("按范围读取得到 %q, %v", got, err)
+	}
+	if got, err := readMemory(t, ms, "docs/a.txt", 11, 0); err != nil || got != "" {
+		t.Errorf("从文件末尾读取得到 %q, %v", got, err)
+	}
+	info, err := ms.Stat(ctx, "docs")
+	if err != nil || !info.IsDirectory || info.ChildCount != 3 || info.Name != "docs" {
+		t.Errorf("目录信息不正确: %+v, %v", info, err)
+	}
+	info, err = ms.Stat(ctx, "docs/c.md")
+	if err != nil || info.Size != 3 || info.ContentType == "" {
+		t.Errorf("文件信息不正确: %+v, %v", info, err)
+	}
+
+	// 分页列出
+	var names []string
+	for token := ""; ; {
+		entries, next, err := ms.ListDirectory(ctx, "docs", ListOptions{PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatalf("列出目录失败: %v", err)
+		}
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	if strings.Join(names, " ") != "a.txt c.md sub" {
+		t.Errorf("分页列出的结果为 %v", names)
+	}
+
+	var walked []string
+	err = ms.Walk(ctx, "", func(p string, info FileInfo) error {
+		walked = append(walked, p)
+		// 遍历过程中可以修改存储
+		return ms.MakeDirectory(ctx, "later")
+	})
+	if err != nil || strings.Join(walked, " ") != "docs docs/a.txt docs/c.md docs/sub docs/sub/b.txt report.csv" {
+		t.Errorf("遍历结果为 %v, %v", walked, err)
+	}
+
+	// 覆盖文件不影响已经打开的读取流
+	r, err := ms.DownloadFile(ctx, "report.csv", 0, 0)
+	if err != nil {
+		t.Fatalf("下载失败: %v", err)
+	}
+	if err := ms.UploadFile(ctx, "report.csv", strings.NewReader("4,5,6,7")); err != nil {
+		t.Fatalf("覆盖文件失败: %v", err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != "1,2,3" {
+		t.Errorf("已打开的读取流读到了 %q", data)
+	}
+
+	if err := ms.Rename(ctx, "docs/sub", "renamed"); err != nil {
+		t.Fatalf("重命名失败: %v", err)
+	}
+	if err := ms.Move(ctx, "report.csv", "docs"); err != nil {
+		t.Fatalf("移动失败: %v", err)
+	}
+	if got, err := readMemory(t, ms, "docs/renamed/b.txt", 0, 0); err != nil || got != "nested" {
+		t.Errorf("重命名后读取得到 %q, %v", got, err)
+	}
+	if err := ms.Move(ctx, "docs/report.csv", "archive/2026/report.csv"); err != nil {
+		t.Fatalf("移动到不存在的目录失败: %v", err)
+	}
+	if _, err := ms.Stat(ctx, "archive/2026/report.csv"); err != nil {
+		t.Errorf("移动后找不到文件: %v", err)
+	}
+
+	capacity, err := ms.Capacity(ctx)
+	if err != nil || capacity.Total != 0 || capacity.Used != int64(len("hello world")+len("nested")+len("# c")+len("4,5,6,7")) {
+		t.Errorf("容量信息不正确: %+v, %v", capacity, err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"查看不存在的文件", func() error { _, err := ms.Stat(ctx, "missing"); return err }(), ErrNotFound},
+		{"查看文件之下的路径", func() error { _, err := ms.Stat(ctx, "docs/a.txt/x"); return err }(), ErrNotDirectory},
+		{"列出文件", func() error { _, _, err := ms.ListDirectory(ctx, "docs/a.txt", ListOptions{}); return err }(), ErrNotDirectory},
+		{"下载目录", func() error { _, err := ms.DownloadFile(ctx, "docs", 0, 0); return err }(), ErrIsDirectory},
+		{"读取范围超出文件", func() error { _, err := ms.DownloadFile(ctx, "docs/a.txt", 12, 0); return err }(), ErrInvalidArgument},
+		{"上传到目录", ms.UploadFile(ctx, "docs", strings.NewReader("x")), ErrIsDirectory},
+		{"上传到文件之下", ms.UploadFile(ctx, "docs/a.txt/x", strings.NewReader("x")), ErrNotDirectory},
+		{"上传到根目录之外", ms.UploadFile(ctx, "../x", strings.NewReader("x")), ErrPermissionDenied},
+		{"删除非空目录", ms.DeleteFile(ctx, "docs", false), ErrNotEmpty},
+		{"删除存储根目录", ms.DeleteFile(ctx, "/", true), ErrPermissionDenied},
+		{"移动到已存在的文件", ms.Move(ctx, "docs/c.md", "docs/a.txt"), ErrAlreadyExists},
+		{"移动到自身之下", ms.Move(ctx, "docs", "docs/renamed"), ErrInvalidArgument},
+		{"非法的新名称", ms.Rename(ctx, "docs/a.txt", "a/b"), ErrInvalidArgument},
+		{"路径包含NUL", ms.MakeDirectory(ctx, "a\x00b"), ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.want) {
+			t.Errorf("%s: 返回 %v，期望 %v", tt.name, tt.err, tt.want)
+		}
+	}
+
+	if err := ms.DeleteFile(ctx, "docs", true); err != nil {
+		t.Fatalf("递归删除失败: %v", err)
+	}
+	if _, err := ms.Stat(ctx, "docs/a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("删除后仍然存在: %v", err)
+	}
+}
+
+func FuzzMemoryLookup(f *testing.F) {
+	for _, seed := range []string{"", "docs", "docs/a.txt", `docs\sub\b.txt`, "docs/sub/../a.txt", "../docs", "docs/a.txt/x", "top.txt/..", "a\x00b", "\xff"} {
+		f.Add(seed)
+	}
+	ms := newTestMemoryStorage(f, map[string]string{"docs/a.txt": "a", "docs/sub/b.txt": "b", "top.txt": "top"})
+	known := map[string]bool{"": true, "docs": true, "docs/a.txt": true, "docs/sub": true, "docs/sub/b.txt": true, "top.txt": true}
+	f.Fuzz(func(t *testing.T, p string) {
+		info, err := ms.Stat(context.Background(), p)
+		if err != nil {
+			if !classified(err) {
+				t.Fatalf("Stat(%q) 返回了未分类的错误: %v", p, err)
+			}
+			return
+		}
+		// 能找到的条目一定是已存在的某个路径，且与按规范路径查找得到的是同一个
+		clean, err := CleanPath(p)
+		if err != nil || !known[clean] {
+			t.Fatalf("Stat(%q) 成功，但规范路径为 %q, %v", p, clean, err)
+		}
+		if real, err := ms.RealPath(p, true); err != nil || real != clean {
+			t.Fatalf("RealPath(%q) = %q, %v，期望 %q", p, real, err, clean)
+		}
+		ms.mu.RLock()
+		n, err := ms.lookup(clean)
+		ms.mu.RUnlock()
+		if err != nil || n.info().Name != info.Name || n.info().Size != info.Size {
+			t.Fatalf("lookup(%q) 与 Stat(%q) 不一致: %+v, %v", clean, p, info, err)
+		}
+	})
+}
+
+func TestMemoryStorageMaxBytes(t *testing.T) {
+	ms, err := NewMemoryStorage("", 10)
+	if err != nil {
+		t.Fatalf("创建内存存储失败: %v", err)
+	}
+	ctx := context.Background()
+	if err := ms.UploadFile(ctx, "a.txt", strings.NewReader("123456")); err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	if err := ms.UploadFile(ctx, "b.txt", strings.NewReader("12345")); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("超出上限的上传应当返回 ErrNoSpace: %v", err)
+	}
+	if _, err := ms.Stat(ctx, "b.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("失败的上传不应留下文件: %v", err)
+	}
+	// 覆盖时原有内容的空间可以重用
+	if err := ms.UploadFile(ctx, "a.txt", strings.NewReader("1234567890")); err != nil {
+		t.Errorf("覆盖为不超过上限的内容应当成功: %v", err)
+	}
+	capacity, err := ms.Capacity(ctx)
+	if err != nil || capacity != (CapacityInfo{Total: 10, Used: 10, Free: 0}) {
+		t.Errorf("容量信息不正确: %+v, %v", capacity, err)
+	}
+	if err := ms.DeleteFile(ctx, "a.txt", false); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := ms.MakeDirectory(ctx, "docs"); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := ms.UploadFile(ctx, "docs/b.txt", strings.NewReader("12345")); err != nil {
+		t.Errorf("删除后应当可以再次写入: %v", err)
+	}
+	if err := ms.DeleteFile(ctx, "docs", true); err != nil {
+		t.Fatalf("删除目录失败: %v", err)
+	}
+	if capacity, err := ms.Capacity(ctx); err != nil || capacity.Used != 0 || capacity.Free != 10 {
+		t.Errorf("递归删除后容量信息不正确: %+v, %v", capacity, err)
+	}
+
+	// 种子的内容同样计入上限
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "big.bin"), make([]byte, 11), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	if _, err := NewMemoryStorage(dir, 10); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("种子超出上限时应当失败: %v", err)
+	}
+}
+
+func TestMemoryStorageSeed(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "docs", "empty"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "docs", "a.txt"), []byte("from dir"), 0644); err != nil {
+		t.Fatalf("写入测试文件失败: %v", err)
+	}
+	dirTime := time.Date(2026, 8, 1, 8, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "docs"), dirTime, dirTime); err != nil {
+		t.Fatalf("修改目录时间失败: %v", err)
+	}
+	ms, err := NewMemoryStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("从目录载入失败: %v", err)
+	}
+	// 载入其中的文件不会改变目录的修改时间
+	if info, err := ms.Stat(context.Background(), "docs"); err != nil || !info.ModTime.Equal(dirTime) {
+		t.Errorf("目录的修改时间应当与种子一致: %+v, %v", info, err)
+	}
+	if got, err := readMemory(t, ms, "docs/a.txt", 0, 0); err != nil || got != "from dir" {
+		t.Errorf("读取载入的文件得到 %q, %v", got, err)
+	}
+	if info, err := ms.Stat(context.Background(), "docs/empty"); err != nil || !info.IsDirectory {
+		t.Errorf("空目录应当被载入: %+v, %v", info, err)
+	}
+
+	modTime := time.Date(2026, 9, 1, 8, 0, 0, 0, time.UTC)
+	writeTar := func(name string, compress bool, entries ...*tar.Header) string {
+		p := filepath.Join(t.TempDir(), name)
+		f, err := os.Create(p)
+		if err != nil {
+			t.Fatalf("创建tar文件失败: %v", err)
+		}
+		defer f.Close()
+		var w io.Writer = f
+		if compress {
+			gz := gzip.NewWriter(f)
+			defer gz.Close()
+			w = gz
+		}
+		tw := tar.NewWriter(w)
+		defer tw.Close()
+		for _, h := range entries {
+			if h.ModTime.IsZero() {
+				h.ModTime = modTime
+			}
+			if err := tw.WriteHeader(h); err != nil {
+				t.Fatalf("写入tar文件失败: %v", err)
+			}
+			if h.Typeflag == tar.TypeReg {
+				if _, err := tw.Write([]byte(strings.Repeat("x", int(h.Size)))); err != nil {
+					t.Fatalf("写入tar文件失败: %v", err)
+				}
+			}
+		}
+		return p
+	}
+	for _, compress := range []bool{false, true} {
+		archive := writeTar("seed.tar", compress,
+			&tar.Header{Name: "./data/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: dirTime},
+			&tar.Header{Name: "./data/b.bin", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+			&tar.Header{Name: "./data/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+			&tar.Header{Name: "top.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 2},
+		)
+		ms, err := NewMemoryStorage(archive, 0)
+		if err != nil {
+			t.Fatalf("从tar文件载入失败（压缩：%v）: %v", compress, err)
+		}
+		info, err := ms.Stat(context.Background(), "data/b.bin")
+		if err != nil || info.Size != 5 || !info.ModTime.Equal(modTime) {
+			t.Errorf("载入的文件信息不正确: %+v, %v", info, err)
+		}
+		if info, err := ms.Stat(context.Background(), "data"); err != nil || !info.ModTime.Equal(dirTime) {
+			t.Errorf("目录的修改时间应当与tar文件一致: %+v, %v", info, err)
+		}
+		if _, err := ms.Stat(context.Background(), "data/link"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("tar文件中的符号链接应当被忽略: %v", err)
+		}
+		if _, err := ms.Stat(context.Background(), "top.txt"); err != nil {
+			t.Errorf("缺少 top.txt: %v", err)
+		}
+	}
+
+	escape := writeTar("escape.tar", false, &tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1})
+	if _, err := NewMemoryStorage(escape, 0); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("tar文件中超出根目录的路径应当被拒绝: %v", err)
+	}
+	if _, err := NewMemoryStorage(filepath.Join(dir, "missing.tar"), 0); err == nil {
+		t.Error("种子不存在时应当失败")
+	}
+}
+
+func TestMemoryStorageConcurrent(t *testing.T) {
+	ms := newTestMemoryStorage(t, nil)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				p := fmt.Sprintf("dir%d/file%d.txt", i%3, j%5)
+				if err := ms.UploadFile(ctx, p, strings.NewReader(strings.Repeat("x", j))); err != nil {
+					t.Errorf("上传失败: %v", err)
+					return
+				}
+				if r, err := ms.DownloadFile(ctx, p, 0, 0); err == nil {
+					io.Copy(io.Discard, r)
+					r.Close()
+				}
+				ms.ListDirectory(ctx, fmt.Sprintf("dir%d", i%3), ListOptions{})
+				ms.Walk(ctx, "", func(string, FileInfo) error { return nil })
+				ms.Capacity(ctx)
+				if j%10 == 9 {
+					ms.DeleteFile(ctx, p, false)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	entries, _, err := ms.ListDirectory(ctx, "", ListOptions{})
+	if err != nil || len(entries) != 3 {
+		t.Errorf("并发写入后的目录不正确: %+v, %v", entries, err)
+	}
+}
+
+func TestMemoryStorageWatch(t *testing.T) {
+	ms := newTestMemoryStorage(t, map[string]string{"inbox/old.txt": "old"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := ms.Watch(ctx, "inbox", true)
+	if err != nil {
+		t.Fatalf("监视目录失败: %v", err)
+	}
+	if err := ms.UploadFile(ctx, "inbox/new.txt", strings.NewReader("new")); err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	select {
+	case ev := <-events:
+		if ev.Op != WatchCreated || ev.Path != "inbox/new.txt" {
+			t.Errorf("事件不正确: %+v", ev)
+		}
+	case <-time.After(5 * memoryWatchInterval):
+		t.Fatal("没有收到新建事件")
+	}
+
+	// 目录本身被删除时先收到其中条目的删除事件，随后通道关闭
+	if err := ms.DeleteFile(ctx, "inbox", true); err != nil {
+		t.Fatalf("删除目录失败: %v", err)
+	}
+	var deleted []string
+	timeout := time.After(5 * memoryWatchInterval)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				if strings.Join(deleted, " ") != "inbox/new.txt inbox/old.txt" {
+					t.Errorf("删除事件为 %v", deleted)
+				}
+				return
+			}
+			deleted = append(deleted, ev.Path)
+		case <-timeout:
+			t.Fatal("目录被删除后通道应当关闭")
+		}
+	}
+}
@@ -1,18 +1,25 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	pathpkg "path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 // S3Storage S3存储实现
@@ -21,6 +28,14 @@ type S3Storage struct {
 	bucket         string
 	prefix         string // 对象key前缀
 	region         string
+	watchInterval  time.Duration // Watch轮询列表的间隔
+	quota          int64         // 存储配额（字节），0表示不限
+
+	usedMu      sync.Mutex    // 保护已用空间的缓存
+	used        int64         // 最近一次统计的已用空间
+	usedAt      time.Time     // 最近一次成功统计的时间
+	usedErr     error         // 最近一次统计的错误
+	usedRefresh chan struct{} // 进行中的统计，完成时关闭；没有进行中的统计时为nil
 }
 
 // S3Config S3配置
@@ -32,6 +47,8 @@ type S3StorageConfig struct {
 	SecretAccessKey string
 	Endpoint        string
 	ForcePathStyle  bool
+	WatchInterval   time.Duration // Watch轮询列表的间隔，小于等于0时使用默认值
+	Quota           int64         // 存储配额（字节），0表示不限
 }
 
 // NewS3Storage 创建S3存储实例
@@ -96,6 +113,8 @@ func NewS3Storage(ctx context.Context, cfg S3StorageConfig) (*S3Storage, error)
 		bucket: cfg.Bucket,
 		prefix: prefix,
 		region: cfg.Region,
+		watchInterval: cfg.WatchInterval,
+		quota: cfg.Quota,
 	}, nil
 }
 
@@ -104,45 +123,129 @@ func (s3s *S3Storage) GetRoot() string {
 	return fmt.Sprintf("s3://%s/%s", s3s.bucket, s3s.prefix)
 }
 
-// buildKey 构建完整的S3对象key
-func (s3s *S3Storage) buildKey(path string) string {
-	// 清理路径
-	cleanPath := filepath.Clean(path)
-	// 移除开头的斜杠（如果有）
-	cleanPath = strings.TrimPrefix(cleanPath, "/")
-	// 将Windows路径分隔符转换为/
-	cleanPath = strings.ReplaceAll(cleanPath, "\\", "/")
-	
-	if s3s.prefix == "" {
-		return cleanPath
+// Type 返回存储类型
+func (s3s *S3Storage) Type() string {
+	return "s3"
+}
+
+// capacityCacheTTL S3已用空间的缓存时间，统计已用空间需要列出前缀下的全部对象
+const capacityCacheTTL = time.Minute
+
+// capacityRefreshTimeout 后台统计已用空间的超时时间
+const capacityRefreshTimeout = 10 * time.Minute
+
+// Capacity S3存储桶没有固定容量，以配置的配额作为总容量，未配置配额时容量未知
+func (s3s *S3Storage) Capacity(ctx context.Context) (CapacityInfo, error) {
+	used, err := s3s.usedBytes(ctx)
+	if err != nil {
+		return CapacityInfo{}, err
+	}
+	info := CapacityInfo{Total: s3s.quota, Used: used}
+	if s3s.quota > 0 {
+		info.Free = max(s3s.quota-used, 0)
 	}
-	return s3s.prefix + cleanPath
+	return info, nil
 }
 
-// IsPathAllowed 检查路径是否在允许访问的范围内
-func (s3s *S3Storage) IsPathAllowed(path string) (bool, error) {
-	// S3存储中，我们通过prefix来限制访问范围
-	// 检查路径是否包含".."，防止路径遍历攻击
-	cleanPath := filepath.Clean(path)
-	if strings.Contains(cleanPath, "..") {
-		return false, nil
+// usedBytes 返回前缀下全部对象的总大小。统计结果超过 capacityCacheTTL 后在后台重新统计，
+// 统计期间返回上一次的结果；只有还没有任何结果时才等待统计完成
+func (s3s *S3Storage) usedBytes(ctx context.Context) (int64, error) {
+	s3s.usedMu.Lock()
+	if (s3s.usedAt.IsZero() || time.Since(s3s.usedAt) >= capacityCacheTTL) && s3s.usedRefresh == nil {
+		s3s.refreshUsed()
 	}
-	return true, nil
+	if !s3s.usedAt.IsZero() {
+		used := s3s.used
+		s3s.usedMu.Unlock()
+		return used, nil
+	}
+	done := s3s.usedRefresh
+	s3s.usedMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-done:
+	}
+	s3s.usedMu.Lock()
+	defer s3s.usedMu.Unlock()
+	if s3s.usedAt.IsZero() {
+		return 0, s3s.usedErr
+	}
+	return s3s.used, nil
 }
 
-// ListDirectory 列出目录下的所有文件和子目录
-func (s3s *S3Storage) ListDirectory(ctx context.Context, path string) ([]FileInfo, error) {
+// refreshUsed 在后台列出全部对象统计已用空间，不受发起请求的上下文影响；调用方需持有 usedMu
+func (s3s *S3Storage) refreshUsed() {
+	done := make(chan struct{})
+	s3s.usedRefresh = done
+	go func() {
+		defer close(done)
+		ctx, cancel := context.WithTimeout(context.Background(), capacityRefreshTimeout)
+		defer cancel()
+		var used int64
+		err := s3s.walkKeys(ctx, "", func(path string, info FileInfo) error {
+			used += info.Size
+			return nil
+		})
+		s3s.usedMu.Lock()
+		defer s3s.usedMu.Unlock()
+		if err == nil {
+			s3s.used, s3s.usedAt = used, time.Now()
+		}
+		s3s.usedErr = err
+		s3s.usedRefresh = nil
+	}()
+}
+
+// Ping 通过HeadBucket检查存储桶是否可访问
+func (s3s *S3Storage) Ping(ctx context.Context) error {
+	_, err := s3s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s3s.bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("访问S3存储桶失败: %w", s3Error(s3s.bucket, err))
+	}
+	return nil
+}
+
+// buildKey 构建完整的S3对象key，路径不合法时返回 CleanPath 的错误
+func (s3s *S3Storage) buildKey(path string) (string, error) {
+	cleanPath, err := CleanPath(path)
+	if err != nil {
+		return "", err
+	}
+	return s3s.prefix + cleanPath, nil
+}
+
+// IsPathAllowed 检查路径是否在允许访问的范围内。S3没有符号链接，
+// 只需与其他后端一样规范路径，拒绝超出前缀的 ..，a..b.txt 这样的名称不受影响
+func (s3s *S3Storage) IsPathAllowed(path string) (bool, error) {
+	_, err := CleanPath(path)
+	return pathAllowed(err)
+}
+
+// RealPath S3没有符号链接，实际位置就是规范后的路径
+func (s3s *S3Storage) RealPath(path string, followLast bool) (string, error) {
+	return CleanPath(path)
+}
+
+// ListDirectory 分页列出目录下的文件和子目录，游标即S3的ContinuationToken
+func (s3s *S3Storage) ListDirectory(ctx context.Context, path string, opts ListOptions) ([]FileInfo, string, error) {
 	// 检查路径权限
 	allowed, err := s3s.IsPathAllowed(path)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	if !allowed {
-		return nil, errors.New("访问被拒绝：路径不合法")
+		return nil, "", fmt.Errorf("%w：路径不合法", ErrPermissionDenied)
 	}
 
 	// 构建S3前缀
-	prefix := s3s.buildKey(path)
+	prefix, err := s3s.buildKey(path)
+	if err != nil {
+		return nil, "", err
+	}
 	if prefix != "" && !strings.HasSuffix(prefix, "/") {
 		prefix += "/"
 	}
@@ -153,12 +256,33 @@ func (s3s *S3Storage) ListDirectory(ctx context.Context, path string) ([]FileInf
 		Prefix:    aws.String(prefix),
 		Delimiter: aws.String("/"), // 使用delimiter来模拟目录结构
 	}
+	if opts.PageSize > 0 {
+		input.MaxKeys = aws.Int32(int32(opts.PageSize))
+	}
+	if opts.PageToken != "" {
+		input.ContinuationToken = aws.String(opts.PageToken)
+	}
 
-	result, err := s3s.client.ListObjectsV2(ctx, input)
-	if err != nil {
-		return nil, fmt.Errorf("列出S3对象失败: %w", err)
+	// 不分页时依次读取所有页，单次ListObjectsV2最多返回1000个对象
+	entries := []FileInfo{}
+	for {
+		result, err := s3s.client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, "", fmt.Errorf("列出S3对象失败: %w", s3Error(path, err))
+		}
+		entries = append(entries, pageEntries(result)...)
+		if !aws.ToBool(result.IsTruncated) {
+			return entries, "", nil
+		}
+		if opts.PageSize > 0 {
+			return entries, aws.ToString(result.NextContinuationToken), nil
+		}
+		input.ContinuationToken = result.NextContinuationToken
 	}
+}
 
+// pageEntries 将一页ListObjectsV2结果转换为按名称排序的FileInfo
+func pageEntries(result *s3.ListObjectsV2Output) []FileInfo {
 	var entries []FileInfo
 
 	// 处理"目录"（CommonPrefixes）
@@ -174,6 +298,7 @@ func (s3s *S3Storage) ListDirectory(ctx context.Context, path string) ([]FileInf
 			Name:        dirName,
 			IsDirectory: true,
 			Size:        0,
+			ChildCount:  -1,
 		})
 	}
 
@@ -200,34 +325,236 @@ func (s3s *S3Storage) ListDirectory(ctx context.Context, path string) ([]FileInf
 			Name:        fileName,
 			IsDirectory: false,
 			Size:        size,
+			ModTime:     aws.ToTime(obj.LastModified),
+			ContentType: contentTypeByName(fileName, false),
+			ETag:        strings.Trim(aws.ToString(obj.ETag), `"`),
+			ChildCount:  -1,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// Stat 获取单个文件或目录的信息，目录即以该路径为前缀的对象集合
+func (s3s *S3Storage) Stat(ctx context.Context, path string) (FileInfo, error) {
+	// 检查路径权限
+	allowed, err := s3s.IsPathAllowed(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if !allowed {
+		return FileInfo{}, fmt.Errorf("%w：路径不合法", ErrPermissionDenied)
+	}
+
+	key, err := s3s.buildKey(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	name := pathpkg.Base("/" + strings.TrimPrefix(key, s3s.prefix))
+	if key != s3s.prefix {
+		head, err := s3s.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(s3s.bucket),
+			Key:    aws.String(key),
 		})
+		if err == nil {
+			contentType := aws.ToString(head.ContentType)
+			if contentType == "" {
+				contentType = contentTypeByName(name, false)
+			}
+			return FileInfo{
+				Name:        name,
+				Size:        aws.ToInt64(head.ContentLength),
+				ModTime:     aws.ToTime(head.LastModified),
+				ContentType: contentType,
+				ETag:        strings.Trim(aws.ToString(head.ETag), `"`),
+				ChildCount:  -1,
+			}, nil
+		}
+		var nf *types.NotFound
+		if !errors.As(err, &nf) {
+			return FileInfo{}, fmt.Errorf("查询S3对象失败: %w", s3Error(path, err))
+		}
+		key += "/"
 	}
 
-	return entries, nil
+	// 按目录处理：统计直接子项数量
+	var count int64
+	var exists bool
+	paginator := s3.NewListObjectsV2Paginator(s3s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s3s.bucket),
+		Prefix:    aws.String(key),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return FileInfo{}, fmt.Errorf("列出S3对象失败: %w", s3Error(path, err))
+		}
+		count += int64(len(page.CommonPrefixes))
+		for _, obj := range page.Contents {
+			exists = true
+			// 目录标记对象本身不计入子项
+			if aws.ToString(obj.Key) != key {
+				count++
+			}
+		}
+		if len(page.CommonPrefixes) > 0 {
+			exists = true
+		}
+	}
+	if !exists && key != s3s.prefix {
+		return FileInfo{}, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	return FileInfo{
+		Name:        name,
+		IsDirectory: true,
+		ChildCount:  count,
+	}, nil
+}
+
+// Walk 按key顺序列出前缀下的所有对象，目录由对象key推断，在其第一个子项之前报告
+func (s3s *S3Storage) Walk(ctx context.Context, path string, fn WalkFunc) error {
+	info, err := s3s.Stat(ctx, path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDirectory {
+		return fmt.Errorf("%w: %s", ErrNotDirectory, path)
+	}
+	return s3s.walkKeys(ctx, path, fn)
+}
+
+// walkKeys 遍历以path为前缀的所有对象，不检查目录是否存在
+func (s3s *S3Storage) walkKeys(ctx context.Context, path string, fn WalkFunc) error {
+	prefix, err := s3s.buildKey(path)
+	if err != nil {
+		return err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	dir := strings.TrimSuffix(strings.TrimPrefix(prefix, s3s.prefix), "/")
+
+	seen := make(map[string]bool)
+	// visitDirs 报告rel的所有尚未报告过的上级目录，由浅到深
+	visitDirs := func(rel string) error {
+		var parents []string
+		for parent := pathpkg.Dir(rel); parent != "." && parent != dir && !seen[parent]; parent = pathpkg.Dir(parent) {
+			parents = append(parents, parent)
+		}
+		for i := len(parents) - 1; i >= 0; i-- {
+			seen[parents[i]] = true
+			err := fn(parents[i], FileInfo{Name: pathpkg.Base(parents[i]), IsDirectory: true, ChildCount: -1})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	paginator := s3.NewListObjectsV2Paginator(s3s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s3s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("列出S3对象失败: %w", s3Error(path, err))
+		}
+		for _, obj := range page.Contents {
+			rel := strings.TrimPrefix(aws.ToString(obj.Key), s3s.prefix)
+			// 目录标记对象
+			if strings.HasSuffix(rel, "/") {
+				rel = strings.TrimSuffix(rel, "/")
+				if rel == dir || seen[rel] {
+					continue
+				}
+				if err := visitDirs(rel); err != nil {
+					return err
+				}
+				seen[rel] = true
+				if err := fn(rel, FileInfo{Name: pathpkg.Base(rel), IsDirectory: true, ChildCount: -1}); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := visitDirs(rel); err != nil {
+				return err
+			}
+			name := pathpkg.Base(rel)
+			err := fn(rel, FileInfo{
+				Name:        name,
+				Size:        aws.ToInt64(obj.Size),
+				ModTime:     aws.ToTime(obj.LastModified),
+				ContentType: contentTypeByName(name, false),
+				ETag:        strings.Trim(aws.ToString(obj.ETag), `"`),
+				ChildCount:  -1,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // DownloadFile 下载文件，返回一个可读取的流
-func (s3s *S3Storage) DownloadFile(ctx context.Context, path string) (io.ReadCloser, error) {
+func (s3s *S3Storage) DownloadFile(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
 	// 检查路径权限
 	allowed, err := s3s.IsPathAllowed(path)
 	if err != nil {
 		return nil, err
 	}
 	if !allowed {
-		return nil, errors.New("访问被拒绝：路径不合法")
+		return nil, fmt.Errorf("%w：路径不合法", ErrPermissionDenied)
 	}
 
 	// 构建S3对象key
-	key := s3s.buildKey(path)
+	key, err := s3s.buildKey(path)
+	if err != nil {
+		return nil, err
+	}
 
 	// 获取对象
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(s3s.bucket),
 		Key:    aws.String(key),
 	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: 读取范围不合法: offset=%d", ErrInvalidArgument, offset)
+	}
+	if offset > 0 || length > 0 {
+		if length > 0 {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		} else {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+		}
+	}
 
+	// 直接发起范围请求，并发分段下载时每段只需一次往返
 	result, err := s3s.client.GetObject(ctx, input)
 	if err != nil {
+		// S3对超出对象大小的Range返回InvalidRange，续传已完成的文件时需要返回空流
+		var apiErr smithy.APIError
+		if offset > 0 && errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange" {
+			head, headErr := s3s.client.HeadObject(ctx, &s3.HeadObjectInput{
+				Bucket: aws.String(s3s.bucket),
+				Key:    aws.String(key),
+			})
+			if headErr == nil && offset == aws.ToInt64(head.ContentLength) {
+				return io.NopCloser(bytes.NewReader(nil)), nil
+			}
+			if headErr == nil {
+				return nil, fmt.Errorf("%w: 读取范围不合法: offset=%d, 文件大小=%d", ErrInvalidArgument, offset, aws.ToInt64(head.ContentLength))
+			}
+		}
+		err = s3Error(path, err)
+		if errors.Is(err, ErrNotFound) {
+			// 不存在同名对象时，路径可能是一个目录前缀
+			if isDir, dirErr := s3s.prefixExists(ctx, key+"/"); dirErr == nil && isDir {
+				return nil, fmt.Errorf("%w: %s", ErrIsDirectory, path)
+			}
+		}
 		return nil, fmt.Errorf("下载S3对象失败: %w", err)
 	}
 
@@ -242,11 +569,14 @@ func (s3s *S3Storage) UploadFile(ctx context.Context, path string, reader io.Rea
 		return err
 	}
 	if !allowed {
-		return errors.New("访问被拒绝：路径不合法")
+		return fmt.Errorf("%w：路径不合法", ErrPermissionDenied)
 	}
 
 	// 构建S3对象key
-	key := s3s.buildKey(path)
+	key, err := s3s.buildKey(path)
+	if err != nil {
+		return err
+	}
 
 	// 上传对象
 	input := &s3.PutObjectInput{
@@ -257,41 +587,269 @@ func (s3s *S3Storage) UploadFile(ctx context.Context, path string, reader io.Rea
 
 	_, err = s3s.client.PutObject(ctx, input)
 	if err != nil {
-		return fmt.Errorf("上传S3对象失败: %w", err)
+		return fmt.Errorf("上传S3对象失败: %w", s3Error(path, err))
 	}
 
 	return nil
 }
 
-// DeleteFile 删除文件
-func (s3s *S3Storage) DeleteFile(ctx context.Context, path string) error {
+// DeleteFile 删除文件或目录（目录即以该路径为前缀的所有对象）
+func (s3s *S3Storage) DeleteFile(ctx context.Context, path string, recursive bool) error {
 	// 检查路径权限
 	allowed, err := s3s.IsPathAllowed(path)
 	if err != nil {
 		return err
 	}
 	if !allowed {
-		return errors.New("访问被拒绝：路径不合法")
+		return fmt.Errorf("%w：路径不合法", ErrPermissionDenied)
 	}
 
 	// 构建S3对象key
-	key := s3s.buildKey(path)
+	key, err := s3s.buildKey(path)
+	if err != nil {
+		return err
+	}
+	if key == s3s.prefix {
+		return fmt.Errorf("%w：不允许删除存储根目录", ErrPermissionDenied)
+	}
+
+	exists, err := s3s.objectExists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		_, err = s3s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s3s.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("删除S3对象失败: %w", s3Error(path, err))
+		}
+		return nil
+	}
+
+	// 按目录处理
+	dirPrefix := key + "/"
+	keys, err := s3s.listKeys(ctx, dirPrefix)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	if !recursive && (len(keys) > 1 || keys[0] != dirPrefix) {
+		return fmt.Errorf("%w: %s", ErrNotEmpty, path)
+	}
+	return s3s.deleteKeys(ctx, keys)
+}
+
+// MakeDirectory 创建目录，S3中以"/"结尾的空对象作为目录标记
+func (s3s *S3Storage) MakeDirectory(ctx context.Context, path string) error {
+	// 检查路径权限
+	allowed, err := s3s.IsPathAllowed(path)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%w：路径不合法", ErrPermissionDenied)
+	}
+
+	key, err := s3s.buildKey(path)
+	if err != nil {
+		return err
+	}
+	if key == s3s.prefix {
+		return nil
+	}
+	_, err = s3s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s3s.bucket),
+		Key:    aws.String(key + "/"),
+		Body:   bytes.NewReader(nil),
+	})
+	if err != nil {
+		return fmt.Errorf("创建S3目录标记失败: %w", s3Error(path, err))
+	}
+	return nil
+}
+
+// Rename 在原目录内重命名文件或目录
+func (s3s *S3Storage) Rename(ctx context.Context, path string, newName string) error {
+	if newName == "" || newName == "." || newName == ".." || strings.ContainsAny(newName, `/\`) {
+		return fmt.Errorf("%w: 新名称不合法: %s", ErrInvalidArgument, newName)
+	}
+	// 先规范化再取上级目录，"a/.."、反斜杠等写法和 Move 看到的是同一个位置
+	clean, err := CleanPath(path)
+	if err != nil {
+		return err
+	}
+	return s3s.Move(ctx, clean, filepath.Join(parentPath(clean), newName))
+}
+
+// Move 移动文件或目录，S3没有原生的移动操作，通过复制后删除实现
+func (s3s *S3Storage) Move(ctx context.Context, src string, dst string) error {
+	// 检查路径权限
+	for _, p := range []string{src, dst} {
+		allowed, err := s3s.IsPathAllowed(p)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("%w：路径不合法", ErrPermissionDenied)
+		}
+	}
+	srcKey, err := s3s.buildKey(src)
+	if err != nil {
+		return err
+	}
+	dstKey, err := s3s.buildKey(dst)
+	if err != nil {
+		return err
+	}
+	if srcKey == s3s.prefix {
+		return fmt.Errorf("%w：不允许移动存储根目录", ErrPermissionDenied)
+	}
 
-	// 删除对象
-	input := &s3.DeleteObjectInput{
+	// 目标为已存在的目录时，移动到该目录下
+	if dstKey == s3s.prefix {
+		dstKey = s3s.prefix + filepath.Base(srcKey)
+	} else if dstIsDir, err := s3s.prefixExists(ctx, dstKey+"/"); err != nil {
+		return err
+	} else if dstIsDir {
+		dstKey = dstKey + "/" + filepath.Base(srcKey)
+	}
+	if exists, err := s3s.objectExists(ctx, dstKey); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, dst)
+	}
+
+	srcIsFile, err := s3s.objectExists(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	if srcIsFile {
+		if err := s3s.copyObject(ctx, srcKey, dstKey); err != nil {
+			return err
+		}
+		return s3s.deleteKeys(ctx, []string{srcKey})
+	}
+
+	// 按目录处理：逐个复制前缀下的对象
+	srcPrefix := srcKey + "/"
+	dstPrefix := dstKey + "/"
+	if strings.HasPrefix(dstPrefix, srcPrefix) {
+		return fmt.Errorf("%w: 不能将目录移动到其自身之下", ErrInvalidArgument)
+	}
+	keys, err := s3s.listKeys(ctx, srcPrefix)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, src)
+	}
+	if exists, err := s3s.prefixExists(ctx, dstPrefix); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, dst)
+	}
+	for _, key := range keys {
+		if err := s3s.copyObject(ctx, key, dstPrefix+strings.TrimPrefix(key, srcPrefix)); err != nil {
+			return err
+		}
+	}
+	return s3s.deleteKeys(ctx, keys)
+}
+
+// objectExists 检查key对应的对象是否存在
+func (s3s *S3Storage) objectExists(ctx context.Context, key string) (bool, error) {
+	_, err := s3s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s3s.bucket),
 		Key:    aws.String(key),
+	})
+	if err != nil {
+		var nf *types.NotFound
+		if errors.As(err, &nf) {
+			return false, nil
+		}
+		return false, fmt.Errorf("查询S3对象失败: %w", s3Error(key, err))
 	}
+	return true, nil
+}
 
-	_, err = s3s.client.DeleteObject(ctx, input)
+// prefixExists 检查是否存在以prefix为前缀的对象
+func (s3s *S3Storage) prefixExists(ctx context.Context, prefix string) (bool, error) {
+	result, err := s3s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s3s.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(1),
+	})
 	if err != nil {
-		// 检查是否是NoSuchKey错误
-		var nsk *types.NoSuchKey
-		if errors.As(err, &nsk) {
-			return fmt.Errorf("文件不存在: %s", path)
+		return false, fmt.Errorf("列出S3对象失败: %w", s3Error(prefix, err))
+	}
+	return len(result.Contents) > 0, nil
+}
+
+// listKeys 列出以prefix为前缀的所有对象key
+func (s3s *S3Storage) listKeys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s3s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s3s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("列出S3对象失败: %w", s3Error(prefix, err))
+		}
+		for _, obj := range page.Contents {
+			if obj.Key != nil {
+				keys = append(keys, *obj.Key)
+			}
 		}
-		return fmt.Errorf("删除S3对象失败: %w", err)
 	}
+	return keys, nil
+}
+
+// copyObject 在同一个bucket内复制对象
+func (s3s *S3Storage) copyObject(ctx context.Context, srcKey, dstKey string) error {
+	// CopySource需要对key进行URL编码
+	segments := strings.Split(s3s.bucket+"/"+srcKey, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	_, err := s3s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s3s.bucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(strings.Join(segments, "/")),
+	})
+	if err != nil {
+		return fmt.Errorf("复制S3对象失败: %w", s3Error(srcKey, err))
+	}
+	return nil
+}
 
+// deleteKeys 批量删除对象，每次请求最多删除1000个
+func (s3s *S3Storage) deleteKeys(ctx context.Context, keys []string) error {
+	const batchSize = 1000
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		var objects []types.ObjectIdentifier
+		for _, key := range keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+		result, err := s3s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s3s.bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("删除S3对象失败: %w", s3Error(keys[start], err))
+		}
+		if len(result.Errors) > 0 {
+			return fmt.Errorf("删除S3对象失败: %s", aws.ToString(result.Errors[0].Message))
+		}
+	}
 	return nil
 }
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestS3BuildKey(t *testing.T) {
+	s3s := &S3Storage{prefix: "data/"}
+	if key, err := s3s.buildKey(`/docs\a.txt`); err != nil || key != "data/docs/a.txt" {
+		t.Errorf("buildKey 得到 %q, %v", key, err)
+	}
+	if key, err := s3s.buildKey(""); err != nil || key != "data/" {
+		t.Errorf("根目录的 key 应当是前缀本身: %q, %v", key, err)
+	}
+	// 不合法的路径返回错误，而不是退化为前缀本身
+	for _, p := range []string{"../x", "a\x00b"} {
+		if key, err := s3s.buildKey(p); !errors.Is(err, ErrPermissionDenied) && !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("buildKey(%q) 应当失败: %q, %v", p, key, err)
+		}
+	}
+}
+
+func FuzzS3BuildKey(f *testing.F) {
+	for _, seed := range []string{"", "/", "docs/a.txt", `/docs\a.txt`, "../x", "docs/../../x", "a..b", "C:x", "a\x00b", "\xff"} {
+		f.Add(seed)
+	}
+	s3s := &S3Storage{prefix: "data/"}
+	f.Fuzz(func(t *testing.T, p string) {
+		key, err := s3s.buildKey(p)
+		if err != nil {
+			if !errors.Is(err, ErrPermissionDenied) && !errors.Is(err, ErrInvalidArgument) {
+				t.Fatalf("buildKey(%q) 返回了未分类的错误: %v", p, err)
+			}
+			return
+		}
+		// key 总在前缀之下，前缀之后是规范的相对路径，不会借 .. 或多余的 / 指向前缀之外的对象
+		rest, ok := strings.CutPrefix(key, s3s.prefix)
+		if !ok {
+			t.Fatalf("buildKey(%q) = %q 不在前缀 %q 之下", p, key, s3s.prefix)
+		}
+		for _, part := range strings.Split(rest, "/") {
+			if rest != "" && (part == "" || part == "." || part == ".." || strings.Contains(part, `\`)) {
+				t.Fatalf("buildKey(%q) = %q 包含不合法的部分 %q", p, key, part)
+			}
+		}
+		if again, err := s3s.buildKey(rest); err != nil || again != key {
+			t.Fatalf("同一位置的 key 不一致: %q -> %q -> %q, %v", p, key, again, err)
+		}
+	})
+}
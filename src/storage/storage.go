@@ -3,32 +3,111 @@ package storage
 import (
 	"context"
 	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 // FileInfo 文件信息
 type FileInfo struct {
-	Name        string // 文件或目录名
-	IsDirectory bool   // 是否为目录
-	Size        int64  // 文件大小（字节）
+	Name        string      // 文件或目录名
+	IsDirectory bool        // 是否为目录
+	Size        int64       // 文件大小（字节）
+	ModTime     time.Time   // 最后修改时间
+	Mode        os.FileMode // 权限模式，后端不支持时为0
+	ContentType string      // MIME类型
+	ETag        string      // 内容标识（如S3 ETag），无法低成本获取时为空
+	ChildCount  int64       // 目录的直接子项数量，-1表示未知
+	IsSymlink   bool        // 是否为符号链接本身，只在本地存储的 link 策略下出现
+	LinkTarget  string      // 符号链接的目标，按链接中保存的内容原样返回
 }
 
+// ListOptions 分页列出目录的参数
+type ListOptions struct {
+	PageSize  int    // 每页最多返回的条目数，小于等于0时不分页
+	PageToken string // 上一页返回的游标，为空时从头开始
+}
+
+// contentTypeByName 根据文件扩展名推断MIME类型，目录返回空字符串
+func contentTypeByName(name string, isDir bool) string {
+	if isDir {
+		return ""
+	}
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// CapacityInfo 存储空间信息
+type CapacityInfo struct {
+	Total int64 // 总容量（字节），0表示后端无法得知容量
+	Used  int64 // 已使用的空间（字节）
+	Free  int64 // 可用空间（字节），容量未知时无意义
+}
+
+// WalkFunc Walk对每个条目调用的函数，path为相对于存储根目录、以/分隔的路径
+type WalkFunc func(path string, info FileInfo) error
+
 // Storage 存储接口，定义统一的存储操作
 type Storage interface {
-	// ListDirectory 列出目录下的所有文件和子目录
-	ListDirectory(ctx context.Context, path string) ([]FileInfo, error)
+	// ListDirectory 按名称顺序分页列出目录下的文件和子目录，
+	// 返回本页的条目和下一页的游标，游标为空表示已经列出全部内容
+	ListDirectory(ctx context.Context, path string, opts ListOptions) ([]FileInfo, string, error)
+
+	// Stat 获取单个文件或目录的信息
+	Stat(ctx context.Context, path string) (FileInfo, error)
+
+	// Walk 递归遍历目录下的所有文件和子目录（不包括目录本身），不跟随符号链接；
+	// fn返回错误时停止遍历并返回该错误
+	Walk(ctx context.Context, path string, fn WalkFunc) error
 
 	// DownloadFile 下载文件，返回一个可读取的流
-	DownloadFile(ctx context.Context, path string) (io.ReadCloser, error)
+	// 从offset处开始读取，length为读取的字节数，小于等于0时读取到文件末尾
+	DownloadFile(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
 
-	// UploadFile 上传文件（可选，用于未来扩展）
+	// UploadFile 上传文件
 	UploadFile(ctx context.Context, path string, reader io.Reader) error
 
-	// DeleteFile 删除文件（可选，用于未来扩展）
-	DeleteFile(ctx context.Context, path string) error
+	// DeleteFile 删除文件或目录，非空目录需要指定recursive
+	DeleteFile(ctx context.Context, path string, recursive bool) error
+
+	// MakeDirectory 创建目录（包括不存在的父目录）
+	MakeDirectory(ctx context.Context, path string) error
+
+	// Rename 在原目录内将文件或目录重命名为newName
+	Rename(ctx context.Context, path string, newName string) error
+
+	// Move 将文件或目录移动到dst，dst为已存在的目录时移动到该目录下
+	Move(ctx context.Context, src string, dst string) error
 
 	// IsPathAllowed 检查路径是否在允许访问的范围内
 	IsPathAllowed(path string) (bool, error)
 
+	// RealPath 返回对path的操作实际访问的位置，即展开途经的符号链接之后相对于存储根目录、以/分隔的路径；
+	// followLast为false时不展开最后一部分，对应删除、移动等作用于条目本身的操作。用于访问控制
+	RealPath(path string, followLast bool) (string, error)
+
 	// GetRoot 获取存储根路径
 	GetRoot() string
+
+	// Type 返回存储类型，与配置中的 storage.type 一致
+	Type() string
+
+	// Capacity 查询存储的总容量、已用空间和可用空间
+	Capacity(ctx context.Context) (CapacityInfo, error)
+
+	// Ping 检查存储后端是否可用，用于健康检查
+	Ping(ctx context.Context) error
+
+	// Watch 监视目录下的新建、修改和删除，recursive为true时同时监视所有子目录。
+	// 监视建立后才返回，ctx取消或目录本身被删除时关闭返回的通道
+	Watch(ctx context.Context, path string, recursive bool) (<-chan WatchEvent, error)
+}
+
+// rangeReadCloser 将限制读取长度后的Reader与原始的Closer组合
+type rangeReadCloser struct {
+	io.Reader
+	io.Closer
 }
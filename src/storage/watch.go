@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchOp 目录变化事件的类型
+type WatchOp int
+
+const (
+	WatchCreated  WatchOp = iota + 1 // 新建文件或目录
+	WatchModified                    // 文件内容被修改
+	WatchDeleted                     // 文件或目录被删除（包括被移走）
+)
+
+func (op WatchOp) String() string {
+	switch op {
+	case WatchCreated:
+		return "created"
+	case WatchModified:
+		return "modified"
+	case WatchDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// WatchEvent 目录变化事件
+type WatchEvent struct {
+	Op   WatchOp
+	Path string   // 相对于存储根目录的路径，以/分隔
+	Info FileInfo // 变化后的文件信息，删除事件只有Name和IsDirectory
+}
+
+// defaultWatchInterval 不支持变化通知的后端轮询列表的默认间隔
+const defaultWatchInterval = 5 * time.Second
+
+// watchBuffer 事件通道的缓冲大小
+const watchBuffer = 64
+
+// Watch 使用inotify等系统通知监视本地目录，目录本身被删除或移走时结束
+func (ls *LocalStorage) Watch(ctx context.Context, p string, recursive bool) (<-chan WatchEvent, error) {
+	base, err := CleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+	fullPath, err := ls.confine(base, true)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, ls.localError(p, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrNotDirectory, p)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("创建文件监视器失败: %w", err)
+	}
+	w := &localWatch{
+		storage:   ls,
+		watcher:   watcher,
+		root:      fullPath,
+		base:      base,
+		recursive: recursive,
+		dirs:      make(map[string]bool),
+		events:    make(chan WatchEvent, watchBuffer),
+	}
+	if err := w.add(fullPath); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("监视目录失败: %w", err)
+	}
+	go w.run(ctx)
+	return w.events, nil
+}
+
+// localWatch 一次本地目录监视的状态
+type localWatch struct {
+	storage     *LocalStorage
+	watcher     *fsnotify.Watcher
+	root        string          // 被监视目录的绝对路径
+	base        string          // 请求中被监视目录的规范路径，事件的路径相对于它报告
+	recursive   bool            // 是否监视子目录
+	dirs        map[string]bool // 已知的子目录，用于判断被删除的条目是否为目录
+	lastDeleted string          // 上一个删除事件的路径，目录被移走时会同时收到父目录和自身的通知
+	events      chan WatchEvent
+}
+
+// add 监视dir，递归监视时同时监视其下所有子目录
+func (w *localWatch) add(dir string) error {
+	if !w.recursive {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				w.dirs[filepath.Join(dir, entry.Name())] = true
+			}
+		}
+		return w.watcher.Add(dir)
+	}
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		w.dirs[p] = true
+		return w.watcher.Add(p)
+	})
+}
+
+func (w *localWatch) run(ctx context.Context) {
+	defer close(w.events)
+	defer w.watcher.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-w.watcher.Events:
+			if !ok || !w.handle(ctx, ev) {
+				return
+			}
+		case _, ok := <-w.watcher.Errors:
+			// 事件队列溢出等错误只影响个别事件，继续监视
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// handle 将系统通知转换为目录变化事件，返回false表示结束监视
+func (w *localWatch) handle(ctx context.Context, ev fsnotify.Event) bool {
+	switch {
+	case ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename):
+		if ev.Name == w.root {
+			return false
+		}
+		if ev.Name == w.lastDeleted {
+			return true
+		}
+		w.lastDeleted = ev.Name
+		isDir := w.dirs[ev.Name]
+		if isDir {
+			w.forget(ev.Name)
+		}
+		return w.send(ctx, WatchDeleted, ev.Name, FileInfo{Name: filepath.Base(ev.Name), IsDirectory: isDir, ChildCount: -1})
+	case ev.Has(fsnotify.Create):
+		info, err := os.Lstat(ev.Name)
+		if err != nil {
+			// 创建后已被删除，之后会收到删除通知
+			return true
+		}
+		if ev.Name == w.lastDeleted {
+			w.lastDeleted = ""
+		}
+		if !w.send(ctx, WatchCreated, ev.Name, localFileInfo(ev.Name, info)) {
+			return false
+		}
+		if info.IsDir() {
+			w.dirs[ev.Name] = true
+			if w.recursive {
+				return w.addCreated(ctx, ev.Name)
+			}
+		}
+	case ev.Has(fsnotify.Write):
+		info, err := os.Stat(ev.Name)
+		if err != nil || info.IsDir() {
+			return true
+		}
+		return w.send(ctx, WatchModified, ev.Name, localFileInfo(ev.Name, info))
+	}
+	return true
+}
+
+// addCreated 监视新建的目录，开始监视之前已经在其中创建的条目补发新建事件
+func (w *localWatch) addCreated(ctx context.Context, dir string) bool {
+	ok := true
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			w.dirs[p] = true
+			w.watcher.Add(p)
+		}
+		if p == dir {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if !w.send(ctx, WatchCreated, p, localFileInfo(p, info)) {
+			ok = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return ok
+}
+
+// forget 停止监视被删除或移走的目录及其子目录
+func (w *localWatch) forget(dir string) {
+	prefix := dir + string(filepath.Separator)
+	for p := range w.dirs {
+		if p == dir || strings.HasPrefix(p, prefix) {
+			delete(w.dirs, p)
+			w.watcher.Remove(p)
+		}
+	}
+}
+
+// send 与 Walk 一样相对于请求的路径报告，经由符号链接监视时也不暴露链接目标的位置
+func (w *localWatch) send(ctx context.Context, op WatchOp, fullPath string, info FileInfo) bool {
+	rel, err := filepath.Rel(w.root, fullPath)
+	if err != nil {
+		return true
+	}
+	select {
+	case w.events <- WatchEvent{Op: op, Path: path.Join(w.base, filepath.ToSlash(rel)), Info: info}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Watch S3没有变化通知，定期列出目录并与上一次的结果比较
+func (s3s *S3Storage) Watch(ctx context.Context, p string, recursive bool) (<-chan WatchEvent, error) {
+	info, err := s3s.Stat(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDirectory {
+		return nil, fmt.Errorf("%w: %s", ErrNotDirectory, p)
+	}
+	dir, err := CleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+	list := func(ctx context.Context) (map[string]FileInfo, error) {
+		return s3s.snapshot(ctx, dir, recursive)
+	}
+	previous, err := list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	interval := s3s.watchInterval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	events := make(chan WatchEvent, watchBuffer)
+	go pollWatch(ctx, interval, previous, list, events)
+	return events, nil
+}
+
+// snapshot 列出dir下的条目，key为相对于存储根目录的路径
+func (s3s *S3Storage) snapshot(ctx context.Context, dir string, recursive bool) (map[string]FileInfo, error) {
+	entries := make(map[string]FileInfo)
+	if !recursive {
+		files, _, err := s3s.ListDirectory(ctx, dir, ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			entries[path.Join(dir, f.Name)] = f
+		}
+		return entries, nil
+	}
+
+	// 目录中的对象被全部删除后目录也随之消失，因此不像Walk那样要求目录存在
+	err := s3s.walkKeys(ctx, dir, func(p string, info FileInfo) error {
+		entries[p] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// pollWatch 按间隔调用list，将两次结果的差异作为事件发送，ctx取消时关闭events
+func pollWatch(ctx context.Context, interval time.Duration, previous map[string]FileInfo, list func(context.Context) (map[string]FileInfo, error), events chan<- WatchEvent) {
+	defer close(events)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := list(ctx)
+		if err != nil {
+			// 网络抖动等暂时性错误，下次继续尝试
+			continue
+		}
+		for _, ev := range diffSnapshots(previous, current) {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+		previous = current
+	}
+}
+
+// diffSnapshots 比较两次列表的结果，按路径顺序返回新建、修改和删除事件
+func diffSnapshots(previous, current map[string]FileInfo) []WatchEvent {
+	var events []WatchEvent
+	for p, info := range current {
+		old, ok := previous[p]
+		switch {
+		case !ok || old.IsDirectory != info.IsDirectory:
+			events = append(events, WatchEvent{Op: WatchCreated, Path: p, Info: info})
+		case !info.IsDirectory && (old.Size != info.Size || old.ETag != info.ETag || !old.ModTime.Equal(info.ModTime)):
+			events = append(events, WatchEvent{Op: WatchModified, Path: p, Info: info})
+		}
+	}
+	for p, old := range previous {
+		if info, ok := current[p]; !ok || info.IsDirectory != old.IsDirectory {
+			events = append(events, WatchEvent{Op: WatchDeleted, Path: p, Info: FileInfo{Name: old.Name, IsDirectory: old.IsDirectory, ChildCount: -1}})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Path != events[j].Path {
+			return events[i].Path < events[j].Path
+		}
+		// 同一路径类型改变时先删除再新建
+		return events[i].Op == WatchDeleted && events[j].Op != WatchDeleted
+	})
+	return events
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ACL 中可以授权的操作
+const (
+	ACLList   = "list"   // 列出目录、查看文件信息
+	ACLRead   = "read"   // 下载文件、计算校验值
+	ACLWrite  = "write"  // 上传文件、创建目录、作为移动和复制的目标
+	ACLDelete = "delete" // 删除文件、作为移动的来源
+	ACLAdmin  = "admin"  // 查看限速状态等节点管理信息，只在根节点的规则中有意义
+)
+
+// ACLRule 一条访问规则：Peers 中的节点或证书身份对当前子树允许或拒绝哪些操作，
+// "*" 匹配任意节点（包括未认证的调用方）或任意操作
+type ACLRule struct {
+	Peers []string `yaml:"peers"`
+	Allow []string `yaml:"allow,omitempty"`
+	Deny  []string `yaml:"deny,omitempty"`
+}
+
+// LoadACL 读取并校验 acl 文件，文件为空时返回nil，表示不做访问控制
+func LoadACL(filename string) (*ZFSNode, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var root *ZFSNode
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if err := root.Validate(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// Validate 检查规则中的操作名称是否合法
+func (n *ZFSNode) Validate() error {
+	if n == nil {
+		return nil
+	}
+	for _, rule := range n.Rules {
+		if len(rule.Peers) == 0 {
+			return fmt.Errorf("%s 中的规则没有指定 peers", n.Name)
+		}
+		for _, op := range append(append([]string{}, rule.Allow...), rule.Deny...) {
+			switch op {
+			case ACLList, ACLRead, ACLWrite, ACLDelete, ACLAdmin, "*":
+			default:
+				return fmt.Errorf("%s 中的规则包含未知操作: %s", n.Name, op)
+			}
+		}
+	}
+	for _, child := range n.Children {
+		if err := child.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Allowed 判断 identity 能否对 p 执行 op。树的根节点对应存储根目录，子节点名称依次对应路径中的各级目录。
+// 沿路径从根向下，每一级中与 identity 匹配且提到 op 的规则会覆盖上级的结论，同一级中拒绝优先于允许；
+// 没有任何规则提到该操作时拒绝。路径和规则中的名称按 Unicode NFC 形式比较，
+// 分解形式的文件名与预组形式受同一条规则约束。树为nil时不做访问控制
+func (n *ZFSNode) Allowed(p, identity, op string) bool {
+	if n == nil {
+		return true
+	}
+	allowed := false
+	node := n
+	segments := strings.Split(strings.Trim(path.Clean("/"+norm.NFC.String(p)), "/"), "/")
+	for i := 0; ; i++ {
+		if decided, ok := node.decide(identity, op); ok {
+			allowed = decided
+		}
+		if i >= len(segments) || segments[i] == "" {
+			break
+		}
+		next := node.child(segments[i])
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return allowed
+}
+
+// decide 计算本级规则对操作的结论，没有规则提到该操作时 ok 为 false
+func (n *ZFSNode) decide(identity, op string) (allowed bool, ok bool) {
+	for _, rule := range n.Rules {
+		if !containsOrWildcard(rule.Peers, identity) {
+			continue
+		}
+		if containsOrWildcard(rule.Deny, op) {
+			return false, true
+		}
+		if containsOrWildcard(rule.Allow, op) {
+			allowed, ok = true, true
+		}
+	}
+	return allowed, ok
+}
+
+func (n *ZFSNode) child(name string) *ZFSNode {
+	for _, child := range n.Children {
+		if child.Name == name || norm.NFC.String(child.Name) == name {
+			return child
+		}
+	}
+	return nil
+}
+
+func containsOrWildcard(items []string, target string) bool {
+	for _, item := range items {
+		if item == "*" || (item == target && target != "") {
+			return true
+		}
+	}
+	return false
+}
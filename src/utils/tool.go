@@ -2,12 +2,15 @@ package utils
 
 import (
 	"ZFS/logger"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v2"
+	"hash"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
 )
 
@@ -28,12 +31,7 @@ func InitACL(filename string) *ZFSNode {
 		}(file)
 		return root
 	} else {
-		data, err := os.ReadFile(filename)
-		if err != nil {
-			logger.Log.Error("读取acl文件失败", zap.Error(err))
-			log.Fatal(err)
-		}
-		err = yaml.Unmarshal(data, &root)
+		root, err := LoadACL(filename)
 		if err != nil {
 			logger.Log.Error("读取acl文件失败", zap.Error(err))
 			log.Fatal(err)
@@ -60,21 +58,20 @@ func FormatFileSize(size int64) string {
 	}
 }
 
-func IsInStorage(root, target string) (bool, error) {
-	absRoot, err := filepath.Abs(root)
-	if err != nil {
-		return false, err
-	}
-	absTarget, err := filepath.Abs(target)
-	if err != nil {
-		return false, err
-	}
-	relative, err := filepath.Rel(absRoot, absTarget)
-	if err != nil {
-		return false, err
+// NewHash 根据算法名称创建哈希实例，名称为空时使用sha256
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "", "sha256":
+		return sha256.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "md5":
+		return md5.New(), nil
+	default:
+		return nil, fmt.Errorf("不支持的校验算法: %s", algorithm)
 	}
-	// 如果relative以".."开头，则说明target不在root下
-	return !strings.HasPrefix(relative, ".."), nil
 }
 
 func Rename(name string, count int8) string {
@@ -85,5 +82,6 @@ func Rename(name string, count int8) string {
 
 type ZFSNode struct {
 	Name     string     `yaml:"name"`
+	Rules    []ACLRule  `yaml:"rules,omitempty"` // 作用于该节点及其子树的访问规则
 	Children []*ZFSNode `yaml:"children,omitempty"`
 }
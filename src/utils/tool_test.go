@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"gopkg.in/yaml.v2"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 // 假设 ZFSNode 的定义如下：
@@ -110,3 +114,120 @@ func TestRename(t *testing.T) {
 		t.Fatalf("重命名出错，ret=%s, expected=%s", ret, expected)
 	}
 }
+
+func TestNewHash(t *testing.T) {
+	h, err := NewHash("")
+	if err != nil {
+		t.Fatalf("创建默认哈希失败: %v", err)
+	}
+	h.Write([]byte("ZFS"))
+	expected := "6531c9bf699f5a57c33c1113dbedb51b83d5e8b7b9ee5505e77283ae17d5c5fa"
+	if ret := hex.EncodeToString(h.Sum(nil)); ret != expected {
+		t.Fatalf("默认算法应为sha256，ret=%s, expected=%s", ret, expected)
+	}
+	if _, err := NewHash("MD5"); err != nil {
+		t.Fatalf("算法名称应当不区分大小写: %v", err)
+	}
+	if _, err := NewHash("crc32"); err == nil {
+		t.Fatalf("不支持的算法应当返回错误")
+	}
+}
+
+func TestIssueCertificate(t *testing.T) {
+	caCert, caKey, err := GenerateCA("ZFS Test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("生成CA失败: %v", err)
+	}
+	certPEM, keyPEM, err := IssueCertificate(caCert, caKey, "node1", []string{"localhost", "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("签发证书失败: %v", err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("解析节点证书失败: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatalf("解析节点证书失败: %v", err)
+	}
+	if cert.Subject.CommonName != "node1" || len(cert.DNSNames) != 1 || len(cert.IPAddresses) != 1 {
+		t.Errorf("节点证书内容不正确: CN=%s, DNS=%v, IP=%v", cert.Subject.CommonName, cert.DNSNames, cert.IPAddresses)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caCert)
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{usage}}); err != nil {
+			t.Errorf("节点证书应当能被CA验证: %v", err)
+		}
+	}
+
+	// 节点证书不能再用来签发证书
+	if _, _, err := IssueCertificate(certPEM, keyPEM, "node2", nil, time.Hour); err == nil {
+		t.Error("使用非CA证书签发应当失败")
+	}
+}
+
+func TestACLAllowed(t *testing.T) {
+	root := &ZFSNode{
+		Name:  "root",
+		Rules: []ACLRule{{Peers: []string{"*"}, Allow: []string{ACLList}}, {Peers: []string{"node1"}, Allow: []string{"*"}}},
+		Children: []*ZFSNode{
+			{
+				Name:  "public",
+				Rules: []ACLRule{{Peers: []string{"*"}, Allow: []string{ACLRead}}},
+			},
+			{
+				Name:  "secret",
+				Rules: []ACLRule{{Peers: []string{"*"}, Deny: []string{"*"}}, {Peers: []string{"node1"}, Allow: []string{ACLRead}}},
+				Children: []*ZFSNode{
+					{Name: "shared", Rules: []ACLRule{{Peers: []string{"node2"}, Allow: []string{ACLList, ACLRead}}}},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		path     string
+		identity string
+		op       string
+		allowed  bool
+	}{
+		{".", "", ACLList, true},
+		{"docs/a.txt", "node2", ACLRead, false},
+		{"docs/a.txt", "node1", ACLDelete, true},
+		{"public/a.txt", "", ACLRead, true},
+		{"/public/sub/a.txt", "node2", ACLRead, true},
+		{"public/a.txt", "node2", ACLWrite, false},
+		{"secret", "node2", ACLList, false},
+		{"secret/a.txt", "node1", ACLRead, false}, // 同一级中拒绝优先
+		{"secret/shared/a.txt", "node2", ACLRead, true},
+		{"secret/shared/a.txt", "node2", ACLDelete, false},
+		{"secret/../public/a.txt", "", ACLRead, true},
+	}
+	for _, tt := range tests {
+		if got := root.Allowed(tt.path, tt.identity, tt.op); got != tt.allowed {
+			t.Errorf("Allowed(%q, %q, %q) = %v，预期 %v", tt.path, tt.identity, tt.op, got, tt.allowed)
+		}
+	}
+	var empty *ZFSNode
+	if !empty.Allowed("any", "", ACLDelete) {
+		t.Error("没有ACL时应当允许所有操作")
+	}
+}
+
+func TestLoadACL(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/acl.yaml"
+	os.WriteFile(file, nil, 0644)
+	if root, err := LoadACL(file); err != nil || root != nil {
+		t.Errorf("空文件应当返回nil: %v, %v", root, err)
+	}
+	os.WriteFile(file, []byte("name: root\nrules:\n- peers: [\"*\"]\n  allow: [list, read]\n"), 0644)
+	if root, err := LoadACL(file); err != nil || !root.Allowed("a.txt", "", ACLRead) {
+		t.Errorf("加载ACL失败: %v", err)
+	}
+	os.WriteFile(file, []byte("name: root\nrules:\n- peers: [\"*\"]\n  allow: [execute]\n"), 0644)
+	if _, err := LoadACL(file); err == nil {
+		t.Error("未知操作应当报错")
+	}
+}